@@ -0,0 +1,225 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"dingospeed/internal/bundle"
+	"dingospeed/pkg/util"
+)
+
+const exportUsage = `usage: dingospeed export [flags] -o <output> <repoId>[@revision]...
+
+将仓库指定版本已缓存的api元数据、blobs及resolve符号链接导出为离线包，用于向离线集群传输。
+未缓存完整的文件不导出，请先通过预热任务下载。
+
+flags:
+  -repos DIR         repos目录，默认./repos
+  -type TYPE         仓库类型，models、datasets或spaces，默认models
+  -revision REV      未指定@revision时导出的版本，默认main
+  -o FILE            输出文件，同时生成FILE.sha256
+  -zstd              使用zstd压缩
+  -chunk-size SIZE   按大小分卷，如4G，输出FILE.000、FILE.001...，默认不分卷
+`
+
+const importUsage = `usage: dingospeed import [-repos DIR] <bundle>
+
+校验离线包并合并到repos目录，bundle可以是离线包文件、分卷前缀或第一个分卷。
+存在FILE.sha256时先校验每个分卷，解压后按清单校验每个文件，本地已有的完整blob保留不变。
+建议在服务停止时执行。
+`
+
+const importHfCacheUsage = `usage: dingospeed import-hf-cache [-repos DIR] [-cache DIR] [repoId]...
+
+将huggingface_hub的本地缓存（<type>--<org>--<repo>/{blobs,snapshots,refs}）导入repos目录，
+校验blob后复制，并合成meta及paths-info缓存，供离线节点直接使用，无需重新下载。
+合成的文件列表只包含已缓存的文件，已有的api缓存不覆盖。未指定repoId时导入全部仓库。
+
+flags:
+  -repos DIR         repos目录，默认./repos
+  -cache DIR         huggingface_hub缓存目录，默认依次使用$HF_HUB_CACHE、$HF_HOME/hub、~/.cache/huggingface/hub
+`
+
+const exportHfCacheUsage = `usage: dingospeed export-hf-cache [-repos DIR] -o <hub>
+
+在hub目录下以huggingface_hub缓存目录的结构链接repos中的文件，作业设置HF_HUB_CACHE=<hub>及HF_HUB_OFFLINE=1后
+可以直接读取文件而不经过http。只链接已转换为普通文件的blob，并清理指向已删除文件的链接。
+服务开启hubCache时会定期执行相同的操作。
+
+flags:
+  -repos DIR         repos目录，默认./repos
+  -o DIR             huggingface_hub缓存目录，应与repos位于同一个共享存储
+`
+
+func newBundleFlagSet(name, usage string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+	}
+	repos := fs.String("repos", "./repos", "repos目录")
+	return fs, repos
+}
+
+// parseByteSize 解析带K、M、G、T后缀的大小，按1024进位
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	unit := int64(1)
+	if n := len(s); n > 0 {
+		if i := strings.IndexByte("KMGT", s[n-1]); i >= 0 {
+			unit <<= 10 * (i + 1)
+			s = s[:n-1]
+		}
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %s", s)
+	}
+	return v * unit, nil
+}
+
+func runExportCommand(args []string) error {
+	fs, repos := newBundleFlagSet("export", exportUsage)
+	repoType := fs.String("type", "models", "仓库类型")
+	revision := fs.String("revision", "main", "默认导出的版本")
+	output := fs.String("o", "", "输出文件")
+	useZstd := fs.Bool("zstd", false, "使用zstd压缩")
+	chunkSize := fs.String("chunk-size", "0", "分卷大小")
+	_ = fs.Parse(args)
+	if *output == "" || fs.NArg() == 0 {
+		fmt.Fprint(os.Stderr, exportUsage)
+		return errors.New("missing output or repoId")
+	}
+	size, err := parseByteSize(*chunkSize)
+	if err != nil {
+		return err
+	}
+	refs := make([]bundle.Repo, 0, fs.NArg())
+	for _, arg := range fs.Args() {
+		ref := bundle.Repo{RepoType: *repoType, RepoId: arg, Revision: *revision}
+		if i := strings.LastIndex(arg, "@"); i >= 0 {
+			ref.RepoId, ref.Revision = arg[:i], arg[i+1:]
+		}
+		refs = append(refs, ref)
+	}
+	manifest, files, err := bundle.Export(bundle.ExportOptions{Repos: *repos, Output: *output, Zstd: *useZstd, ChunkSize: size}, refs)
+	if err != nil {
+		return err
+	}
+	for _, r := range manifest.Repos {
+		fmt.Printf("%s/%s@%s  commit:%s  files:%d  bytes:%s", r.RepoType, r.RepoId, r.Revision, r.Commit, r.Files, util.ConvertBytesToHumanReadable(r.Bytes))
+		if r.Incomplete > 0 {
+			fmt.Printf("  incomplete:%d (not exported)", r.Incomplete)
+		}
+		fmt.Println()
+	}
+	for _, f := range files {
+		fmt.Printf("  wrote %s\n", f)
+	}
+	return nil
+}
+
+func runImportCommand(args []string) error {
+	fs, repos := newBundleFlagSet("import", importUsage)
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprint(os.Stderr, importUsage)
+		return errors.New("missing bundle")
+	}
+	result, err := bundle.Import(bundle.ImportOptions{Repos: *repos, Input: fs.Arg(0)})
+	if err != nil {
+		return err
+	}
+	if !result.Verified {
+		fmt.Fprintln(os.Stderr, "warning: checksum file not found, parts are not verified before extracting")
+	}
+	for _, r := range result.Manifest.Repos {
+		fmt.Printf("%s/%s@%s  commit:%s  files:%d  bytes:%s\n", r.RepoType, r.RepoId, r.Revision, r.Commit, r.Files, util.ConvertBytesToHumanReadable(r.Bytes))
+	}
+	fmt.Printf("imported %d file(s), skipped %d existing blob(s)\n", result.Imported, result.Skipped)
+	if len(result.Incomplete) > 0 {
+		fmt.Printf("kept %d incomplete local blob(s), the server downloads the rest when they are requested:\n", len(result.Incomplete))
+		for _, p := range result.Incomplete {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+	return nil
+}
+
+// defaultHfCache 与huggingface_hub确定缓存目录的方式一致
+func defaultHfCache() string {
+	if dir := os.Getenv("HF_HUB_CACHE"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("HF_HOME"); dir != "" {
+		return filepath.Join(dir, "hub")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".cache", "huggingface", "hub")
+}
+
+func runImportHfCacheCommand(args []string) error {
+	fs, repos := newBundleFlagSet("import-hf-cache", importHfCacheUsage)
+	cache := fs.String("cache", defaultHfCache(), "huggingface_hub缓存目录")
+	_ = fs.Parse(args)
+	results, err := bundle.ImportHfCache(bundle.HfCacheOptions{Repos: *repos, Cache: *cache, Only: fs.Args()})
+	failed := 0
+	for _, r := range results {
+		fmt.Printf("%s/%s@%s", r.RepoType, r.RepoId, r.Commit)
+		if len(r.Refs) > 0 {
+			fmt.Printf(" (%s)", strings.Join(r.Refs, ","))
+		}
+		fmt.Printf("  files:%d  bytes:%s  existing:%d\n", r.Files, util.ConvertBytesToHumanReadable(r.Bytes), r.Existing)
+		for _, f := range r.Failed {
+			fmt.Printf("  failed: %s\n", f)
+		}
+		failed += len(r.Failed)
+	}
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no snapshot found in %s", *cache)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d file(s) failed", failed)
+	}
+	return nil
+}
+
+func runExportHfCacheCommand(args []string) error {
+	fs, repos := newBundleFlagSet("export-hf-cache", exportHfCacheUsage)
+	output := fs.String("o", "", "huggingface_hub缓存目录")
+	_ = fs.Parse(args)
+	if *output == "" {
+		fmt.Fprint(os.Stderr, exportHfCacheUsage)
+		return errors.New("missing output")
+	}
+	result, err := bundle.LinkHfLayout(*repos, *output)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("linked %d file(s), %d ref(s), removed %d link(s)\n", result.Linked, result.Refs, result.Removed)
+	if result.Pending > 0 {
+		fmt.Printf("%d file(s) are not plain blobs yet, enable download.materializeBlob to link them\n", result.Pending)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"dingospeed/internal/downloader"
+)
+
+const cacheUsage = `usage: dingospeed cache <command> [flags] <path>...
+
+缓存文件的离线工具，path可以是缓存文件或目录（递归处理其中的缓存文件），请在服务停止时执行。
+
+commands:
+  inspect  [-json] <path>...                          查看版本、块大小、文件大小、缓存进度及缺失的数据块
+  migrate  [-version N] [-block-size N] <path>...     转换缓存文件的版本及块大小，默认升级为当前版本
+  verify   [-json] [-oid OID] <path>...               校验数据块校验和，缓存完整时校验整个文件与oid是否一致
+  extract  <path> <output>                            将缓存完整的文件导出为普通文件
+`
+
+func runCacheCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, cacheUsage)
+		return errors.New("missing cache command")
+	}
+	switch args[0] {
+	case "inspect":
+		return cacheInspect(args[1:])
+	case "migrate":
+		return cacheMigrate(args[1:])
+	case "verify":
+		return cacheVerify(args[1:])
+	case "extract":
+		return cacheExtract(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, cacheUsage)
+		return fmt.Errorf("unknown cache command %s", args[0])
+	}
+}
+
+func newCacheFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("cache "+name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, cacheUsage)
+	}
+	return fs
+}
+
+// walkCachePaths 依次处理每个路径下的缓存文件，单个文件失败不影响其他文件，最后汇总失败数量
+func walkCachePaths(paths []string, fn func(path string) error) error {
+	if len(paths) == 0 {
+		fmt.Fprint(os.Stderr, cacheUsage)
+		return errors.New("missing path")
+	}
+	failed := 0
+	for _, p := range paths {
+		err := downloader.WalkCacheFiles(p, func(path string) error {
+			if err := fn(path); err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			}
+			return nil
+		})
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s: %v\n", p, err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d file(s) failed", failed)
+	}
+	return nil
+}
+
+func printJson(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+func cacheInspect(args []string) error {
+	fs := newCacheFlagSet("inspect")
+	jsonOutput := fs.Bool("json", false, "以json格式输出，每个文件一行")
+	_ = fs.Parse(args)
+	return walkCachePaths(fs.Args(), func(path string) error {
+		info, err := downloader.InspectCacheFile(path)
+		if err != nil {
+			return err
+		}
+		if *jsonOutput {
+			return printJson(info)
+		}
+		fmt.Printf("%s\n", info.Path)
+		fmt.Printf("  version: %d, checksum: %v\n", info.Version, info.HasChecksum)
+		fmt.Printf("  block size: %d, file size: %d, header size: %d, disk size: %d\n", info.BlockSize, info.FileSize, info.HeaderSize, info.DiskSize)
+		fmt.Printf("  blocks: %d/%d (%.2f%%)\n", info.CachedBlocks, info.BlockNumber, info.Percent())
+		if len(info.MissingRanges) > 0 {
+			ranges := make([]string, 0, len(info.MissingRanges))
+			for _, r := range info.MissingRanges {
+				if r.End-r.Start == 1 {
+					ranges = append(ranges, fmt.Sprintf("%d", r.Start))
+				} else {
+					ranges = append(ranges, fmt.Sprintf("%d-%d", r.Start, r.End-1))
+				}
+			}
+			fmt.Printf("  missing blocks: %s\n", strings.Join(ranges, ","))
+		}
+		return nil
+	})
+}
+
+func cacheMigrate(args []string) error {
+	fs := newCacheFlagSet("migrate")
+	version := fs.Int64("version", downloader.CURRENT_OLAH_CACHE_VERSION, "目标版本")
+	blockSize := fs.Int64("block-size", 0, "目标块大小，0表示保持原块大小")
+	_ = fs.Parse(args)
+	return walkCachePaths(fs.Args(), func(path string) error {
+		converted, err := downloader.ConvertCacheFile(path, *version, *blockSize)
+		if err != nil {
+			return err
+		}
+		if converted {
+			fmt.Printf("%s: migrated\n", path)
+		} else {
+			fmt.Printf("%s: skipped\n", path)
+		}
+		return nil
+	})
+}
+
+func cacheVerify(args []string) error {
+	fs := newCacheFlagSet("verify")
+	jsonOutput := fs.Bool("json", false, "以json格式输出，每个文件一行")
+	oid := fs.String("oid", "", "期望的sha256（lfs文件）或git sha1，默认使用文件名")
+	_ = fs.Parse(args)
+	return walkCachePaths(fs.Args(), func(path string) error {
+		result, err := downloader.VerifyCacheFile(path, *oid)
+		if err != nil {
+			return err
+		}
+		if *jsonOutput {
+			err = printJson(result)
+		} else {
+			fmt.Printf("%s: %s", path, result.Status)
+			if result.Actual != "" {
+				fmt.Printf(", %s actual %s", result.Algorithm, result.Actual)
+			}
+			if len(result.CorruptedBlocks) > 0 {
+				fmt.Printf(", corrupted blocks %v", result.CorruptedBlocks)
+			}
+			fmt.Println()
+		}
+		if err == nil && (result.Status == downloader.BlobVerifyStatusMismatch || result.Status == downloader.BlobVerifyStatusCorrupted) {
+			err = errors.New(result.Status)
+		}
+		return err
+	})
+}
+
+func cacheExtract(args []string) error {
+	fs := newCacheFlagSet("extract")
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fmt.Fprint(os.Stderr, cacheUsage)
+		return errors.New("extract requires <path> and <output>")
+	}
+	if err := downloader.ExtractCacheFile(fs.Arg(0), fs.Arg(1)); err != nil {
+		return err
+	}
+	fmt.Printf("%s: extracted to %s\n", fs.Arg(0), fs.Arg(1))
+	return nil
+}
@@ -35,11 +35,33 @@ var (
 	Version    string
 )
 
+// 子命令，如dingospeed cache inspect <path>、dingospeed prefetch start <repoId>，不带子命令时启动服务
+var commands = map[string]func(args []string) error{
+	"cache":           runCacheCommand,
+	"prefetch":        runPrefetchCommand,
+	"export":          runExportCommand,
+	"import":          runImportCommand,
+	"import-hf-cache": runImportHfCacheCommand,
+	"export-hf-cache": runExportHfCacheCommand,
+}
+
 func init() {
 	flag.StringVar(&configPath, "config", "./config/config.yaml", "配置文件路径")
 	flag.Parse()
 }
 
+func runCommand(args []string) {
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %s\n", args[0])
+		os.Exit(2)
+	}
+	if err := command(args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
 func newApp(s *server.HTTPServer) *app.App {
 	app := app.New(app.ID(id), app.Name(Name), app.Version(Version),
 		app.Server(s))
@@ -47,6 +69,10 @@ func newApp(s *server.HTTPServer) *app.App {
 }
 
 func main() {
+	if flag.NArg() > 0 {
+		runCommand(flag.Args())
+		return
+	}
 	conf, err := config.Scan(configPath)
 	if err != nil {
 		panic(err)
@@ -0,0 +1,240 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"dingospeed/internal/model"
+	"dingospeed/pkg/consts"
+)
+
+const prefetchUsage = `usage: dingospeed prefetch <command> [flags] [args]
+
+通过运行中的服务管理仓库预热任务，预热任务在服务后台将仓库文件下载到缓存。
+
+commands:
+  start  [-type models] [-revision main] [-allow P]... [-ignore P]... [-token T] [-wait] <repoId>
+                                   创建预热任务，allow/ignore为glob模式，可重复指定
+  list                             列出所有任务
+  status [-wait] <id>              查看任务进度，-wait等待任务结束
+  cancel <id>                      取消任务，已下载的文件保留在缓存中
+
+common flags:
+  -server URL                      服务地址，默认http://localhost:8090
+  -admin-token T                   服务配置的adminToken，默认读取环境变量DINGOSPEED_ADMIN_TOKEN
+`
+
+// stringList 可重复指定的flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func runPrefetchCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, prefetchUsage)
+		return errors.New("missing prefetch command")
+	}
+	switch args[0] {
+	case "start":
+		return prefetchStart(args[1:])
+	case "list":
+		return prefetchList(args[1:])
+	case "status":
+		return prefetchStatus(args[1:])
+	case "cancel":
+		return prefetchCancel(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, prefetchUsage)
+		return fmt.Errorf("unknown prefetch command %s", args[0])
+	}
+}
+
+// prefetchServer 运行中的服务，访问管理接口时携带adminToken
+type prefetchServer struct {
+	url        string
+	adminToken string
+}
+
+func newPrefetchFlagSet(name string) (*flag.FlagSet, *prefetchServer) {
+	fs := flag.NewFlagSet("prefetch "+name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, prefetchUsage)
+	}
+	server := &prefetchServer{}
+	fs.StringVar(&server.url, "server", "http://localhost:8090", "服务地址")
+	fs.StringVar(&server.adminToken, "admin-token", os.Getenv("DINGOSPEED_ADMIN_TOKEN"), "服务配置的adminToken")
+	return fs, server
+}
+
+// request 请求服务的预热接口，token为访问私有仓库的token，成功时将返回的json解析到out
+func (s *prefetchServer) request(method, path, token string, body interface{}, out interface{}) error {
+	url := s.url + path
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if s.adminToken != "" {
+		req.Header.Set(consts.HeaderAdminToken, s.adminToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %d %s", method, url, resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return json.Unmarshal(b, out)
+}
+
+func printPrefetchJob(job *model.PrefetchJob) {
+	fmt.Printf("%s  %-9s  %s/%s@%s  files:%d/%d  bytes:%d/%d", job.Id, job.Status, job.RepoType, job.RepoId, job.Revision, job.DoneFiles, job.TotalFiles, job.DoneBytes, job.TotalBytes)
+	if job.Error != "" {
+		fmt.Printf("  error:%s", job.Error)
+	}
+	fmt.Println()
+	for _, f := range job.FailedFiles {
+		fmt.Printf("  failed: %s\n", f)
+	}
+}
+
+// waitPrefetchJob 定期查询任务进度直到任务结束，任务失败或被取消时返回错误
+func waitPrefetchJob(server *prefetchServer, id string) error {
+	for {
+		var job model.PrefetchJob
+		if err := server.request(http.MethodGet, "/admin/prefetch/"+id, "", nil, &job); err != nil {
+			return err
+		}
+		if job.Finished() {
+			printPrefetchJob(&job)
+			if job.Status != model.PrefetchStatusCompleted {
+				return fmt.Errorf("prefetch job %s %s", job.Id, job.Status)
+			}
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "%s  files:%d/%d  bytes:%d/%d\n", job.Status, job.DoneFiles, job.TotalFiles, job.DoneBytes, job.TotalBytes)
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func prefetchStart(args []string) error {
+	fs, server := newPrefetchFlagSet("start")
+	var req model.PrefetchRequest
+	var allow, ignore stringList
+	fs.StringVar(&req.RepoType, "type", "models", "仓库类型，models、datasets或spaces")
+	fs.StringVar(&req.Revision, "revision", "main", "分支、标签或commit")
+	fs.Var(&allow, "allow", "只下载匹配的文件")
+	fs.Var(&ignore, "ignore", "不下载匹配的文件")
+	token := fs.String("token", "", "访问私有仓库的token")
+	wait := fs.Bool("wait", false, "等待任务结束")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprint(os.Stderr, prefetchUsage)
+		return errors.New("missing repoId")
+	}
+	req.RepoId = fs.Arg(0)
+	req.Allow, req.Ignore = allow, ignore
+	var job model.PrefetchJob
+	if err := server.request(http.MethodPost, "/admin/prefetch", *token, req, &job); err != nil {
+		return err
+	}
+	printPrefetchJob(&job)
+	if *wait {
+		return waitPrefetchJob(server, job.Id)
+	}
+	return nil
+}
+
+func prefetchList(args []string) error {
+	fs, server := newPrefetchFlagSet("list")
+	_ = fs.Parse(args)
+	var jobs []model.PrefetchJob
+	if err := server.request(http.MethodGet, "/admin/prefetch", "", nil, &jobs); err != nil {
+		return err
+	}
+	for i := range jobs {
+		printPrefetchJob(&jobs[i])
+	}
+	return nil
+}
+
+func prefetchStatus(args []string) error {
+	fs, server := newPrefetchFlagSet("status")
+	wait := fs.Bool("wait", false, "等待任务结束")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprint(os.Stderr, prefetchUsage)
+		return errors.New("missing job id")
+	}
+	if *wait {
+		return waitPrefetchJob(server, fs.Arg(0))
+	}
+	var job model.PrefetchJob
+	if err := server.request(http.MethodGet, "/admin/prefetch/"+fs.Arg(0), "", nil, &job); err != nil {
+		return err
+	}
+	printPrefetchJob(&job)
+	return nil
+}
+
+func prefetchCancel(args []string) error {
+	fs, server := newPrefetchFlagSet("cancel")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprint(os.Stderr, prefetchUsage)
+		return errors.New("missing job id")
+	}
+	var job model.PrefetchJob
+	if err := server.request(http.MethodDelete, "/admin/prefetch/"+fs.Arg(0), "", nil, &job); err != nil {
+		return err
+	}
+	printPrefetchJob(&job)
+	return nil
+}
@@ -32,7 +32,10 @@ func wireApp(configConfig *config.Config) (*app.App, func(), error) {
 	metaService := service.NewMetaService(fileDao, metaDao)
 	metaHandler := handler.NewMetaHandler(metaService)
 	sysHandler := handler.NewSysHandler(sysService)
-	httpRouter := router.NewHttpRouter(echo, fileHandler, metaHandler, sysHandler)
+	prefetchService := service.NewPrefetchService(fileDao)
+	syncService := service.NewSyncService(fileDao, prefetchService)
+	prefetchHandler := handler.NewPrefetchHandler(prefetchService, syncService)
+	httpRouter := router.NewHttpRouter(echo, fileHandler, metaHandler, sysHandler, prefetchHandler)
 	httpServer := server.NewServer(configConfig, echo, httpRouter)
 	appApp := newApp(httpServer)
 	return appApp, func() {
@@ -0,0 +1,303 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dingospeed/internal/dao"
+	"dingospeed/internal/downloader"
+	"dingospeed/pkg/util"
+)
+
+var testCommit = strings.Repeat("a1", 20)
+
+// testRepo repos目录中的一个仓库，files为文件名到内容的映射，incomplete中的文件以未下载任何数据块的缓存文件存放
+type testRepo struct {
+	repoType   string
+	repoId     string
+	revision   string
+	commit     string
+	files      map[string][]byte
+	incomplete []string
+}
+
+func blobOid(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeTestRepo 按服务的目录结构写入revision的meta缓存、blob及resolve符号链接
+func writeTestRepo(t *testing.T, root string, r testRepo) {
+	t.Helper()
+	siblings := make([]dao.Sibling, 0, len(r.files))
+	for name := range r.files {
+		siblings = append(siblings, dao.Sibling{Rfilename: name})
+	}
+	content, err := json.Marshal(dao.CommitHfSha{Sha: r.commit, Siblings: siblings})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rev := range []string{r.revision, r.commit} {
+		metaPath := filepath.Join(root, "api", r.repoType, r.repoId, "revision", url.PathEscape(rev), "meta_get.json")
+		if err = util.MakeDirs(metaPath); err != nil {
+			t.Fatal(err)
+		}
+		if err = (&dao.FileDao{}).WriteCacheRequest(metaPath, http.StatusOK, map[string]string{"content-type": "application/json"}, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repoDir := filepath.Join(root, "files", r.repoType, r.repoId)
+	for name, data := range r.files {
+		blobsFile := filepath.Join(repoDir, "blobs", blobOid(data))
+		if err = util.MakeDirs(blobsFile); err != nil {
+			t.Fatal(err)
+		}
+		if contains(r.incomplete, name) {
+			writeEmptyCacheFile(t, blobsFile, int64(len(data)))
+		} else if err = os.WriteFile(blobsFile, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		filesPath := filepath.Join(repoDir, "resolve", r.commit, filepath.FromSlash(name))
+		if err = util.MakeDirs(filesPath); err != nil {
+			t.Fatal(err)
+		}
+		if err = util.CreateSymlinkIfNotExists(blobsFile, filesPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeEmptyCacheFile 写入只有头部的缓存文件，即服务刚开始下载的blob
+func writeEmptyCacheFile(t *testing.T, path string, fileSize int64) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err = downloader.NewDingCacheHeader(downloader.CURRENT_OLAH_CACHE_VERSION, 1024, fileSize).Write(f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotTree 返回目录下的普通文件内容及符号链接目标，用于比较两个repos目录
+func snapshotTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	tree := make(map[string]string)
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		if d.Type()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(p)
+			tree[filepath.ToSlash(rel)] = "-> " + filepath.ToSlash(link)
+			return err
+		}
+		b, err := os.ReadFile(p)
+		tree[filepath.ToSlash(rel)] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func exportTestBundle(t *testing.T, root string, repos ...Repo) (*Manifest, string) {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "bundle.tar.zst")
+	// 分卷大小小于文件，验证跨分卷读取
+	manifest, files, err := Export(ExportOptions{Repos: root, Output: out, Zstd: true, ChunkSize: 512}, repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 2 {
+		t.Fatalf("bundle is written to %d part(s), want more than 1", len(files))
+	}
+	return manifest, out
+}
+
+// 导出后导入到空的repos目录，内容与源目录中已缓存完整的部分一致
+func TestExportImport(t *testing.T) {
+	src := t.TempDir()
+	repo := testRepo{
+		repoType: "models", repoId: "org/repo", revision: "main", commit: testCommit,
+		files: map[string][]byte{
+			"config.json":       []byte(`{"model_type":"test"}`),
+			"sub/model.bin":     bytes.Repeat([]byte("weights"), 300),
+			"incomplete.bin":    bytes.Repeat([]byte("partial"), 300),
+			"sub/duplicate.bin": []byte(`{"model_type":"test"}`), // 与config.json共用一个blob
+		},
+		incomplete: []string{"incomplete.bin"},
+	}
+	writeTestRepo(t, src, repo)
+	manifest, out := exportTestBundle(t, src, Repo{RepoType: "models", RepoId: "org/repo", Revision: "main"})
+	if r := manifest.Repos[0]; r.Commit != testCommit || r.Files != 4 || r.Incomplete != 1 {
+		t.Fatalf("exported repo %+v, want commit %s, 4 files and 1 incomplete", r, testCommit)
+	}
+
+	dst := filepath.Join(t.TempDir(), "repos")
+	result, err := Import(ImportOptions{Repos: dst, Input: out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Verified || result.Imported != len(manifest.Files) || result.Skipped != 0 || len(result.Incomplete) != 0 {
+		t.Fatalf("import result %+v, want %d imported", result, len(manifest.Files))
+	}
+	want := snapshotTree(t, src)
+	incompleteLink := "files/models/org/repo/resolve/" + testCommit + "/incomplete.bin"
+	delete(want, incompleteLink)
+	delete(want, "files/models/org/repo/blobs/"+blobOid(repo.files["incomplete.bin"]))
+	got := snapshotTree(t, dst)
+	if len(got) != len(want) {
+		t.Fatalf("imported %d file(s), want %d", len(got), len(want))
+	}
+	for p, content := range want {
+		if got[p] != content {
+			t.Fatalf("%s is not imported as exported", p)
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(dst, "files/models/org/repo/resolve", testCommit, "sub/model.bin")); err != nil || !bytes.Equal(b, repo.files["sub/model.bin"]) {
+		t.Fatalf("read imported file through the resolve link: %v", err)
+	}
+}
+
+// 导入不覆盖本地已有的blob：完整的跳过，未完成的保留原文件，由服务继续下载
+func TestImportKeepsExistingBlobs(t *testing.T) {
+	src := t.TempDir()
+	repo := testRepo{
+		repoType: "models", repoId: "org/repo", revision: "main", commit: testCommit,
+		files: map[string][]byte{
+			"complete.bin":    bytes.Repeat([]byte("complete"), 300),
+			"downloading.bin": bytes.Repeat([]byte("downloading"), 300),
+			"new.bin":         bytes.Repeat([]byte("new"), 300),
+		},
+	}
+	writeTestRepo(t, src, repo)
+	_, out := exportTestBundle(t, src, Repo{RepoType: "models", RepoId: "org/repo", Revision: "main"})
+
+	dst := t.TempDir()
+	local := repo
+	local.incomplete = []string{"downloading.bin"}
+	local.files = map[string][]byte{"complete.bin": repo.files["complete.bin"], "downloading.bin": repo.files["downloading.bin"]}
+	writeTestRepo(t, dst, local)
+	downloading := filepath.Join(dst, "files/models/org/repo/blobs", blobOid(repo.files["downloading.bin"]))
+	// 模拟运行中的服务打开了未完成的blob
+	f, err := os.Open(downloading)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	before, _ := f.Stat()
+
+	result, err := Import(ImportOptions{Repos: dst, Input: out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Skipped != 1 || len(result.Incomplete) != 1 || !strings.HasSuffix(result.Incomplete[0], blobOid(repo.files["downloading.bin"])) {
+		t.Fatalf("import result %+v, want 1 skipped and 1 incomplete", result)
+	}
+	after, err := os.Stat(downloading)
+	if err != nil || !os.SameFile(before, after) || !downloader.IsCacheFile(downloading) {
+		t.Fatalf("incomplete local blob is replaced: %v", err)
+	}
+	for _, name := range []string{"complete.bin", "new.bin"} {
+		if b, err := os.ReadFile(filepath.Join(dst, "files/models/org/repo/resolve", testCommit, name)); err != nil || !bytes.Equal(b, repo.files[name]) {
+			t.Fatalf("read %s after import: %v", name, err)
+		}
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dst, ".import-*")); len(leftovers) != 0 {
+		t.Fatalf("staging directory is not removed: %v", leftovers)
+	}
+}
+
+// writeTarBundle 写入未压缩的离线包，entries为路径到内容的映射，清单按实际内容生成
+func writeTarBundle(t *testing.T, entries map[string][]byte) string {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "bundle.tar")
+	f, err := os.Create(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	manifest := Manifest{Version: manifestVersion}
+	for name, content := range entries {
+		if err = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+		manifest.Files = append(manifest.Files, ManifestFile{Path: name, Size: int64(len(content)), Sha256: blobOid(content)})
+	}
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tw.WriteHeader(&tar.Header{Name: ManifestName, Mode: 0644, Size: int64(len(b)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// 离线包中api和files目录以外的条目（如预热任务、跟踪的仓库）不导入，整个离线包被拒绝
+func TestImportRejectsServiceState(t *testing.T) {
+	meta := []byte(`{"sha":"a1"}`)
+	for _, name := range []string{"tracked.json", "prefetch/job.json", "apis/x.json"} {
+		dst := t.TempDir()
+		out := writeTarBundle(t, map[string][]byte{"api/models/org/repo/revision/main/meta_get.json": meta, name: []byte("[]")})
+		if _, err := Import(ImportOptions{Repos: dst, Input: out}); err == nil || !strings.Contains(err.Error(), name) {
+			t.Fatalf("import a bundle with %s err = %v", name, err)
+		}
+		if tree := snapshotTree(t, dst); len(tree) != 0 {
+			t.Fatalf("files are imported from a rejected bundle: %v", tree)
+		}
+	}
+
+	// 清单中列出的条目同样需要校验
+	manifest := &Manifest{Version: manifestVersion, Files: []ManifestFile{{Path: "tracked.json", Size: 2, Sha256: blobOid([]byte("[]"))}}}
+	extracted := map[string]ManifestFile{"tracked.json": manifest.Files[0]}
+	if err := checkManifest(manifest, extracted); err == nil {
+		t.Fatal("manifest with tracked.json is accepted")
+	}
+}
@@ -0,0 +1,215 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package bundle
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func chunkName(base string, index int) string {
+	return fmt.Sprintf("%s.%03d", base, index)
+}
+
+// chunkWriter 将输出按size切分为base.000、base.001...，size为0时不分卷。
+// 关闭时在base.sha256中按sha256sum的格式写入每个文件的校验和，便于拷贝后先行校验介质。
+type chunkWriter struct {
+	base    string
+	size    int64
+	index   int
+	written int64
+	f       *os.File
+	h       hash.Hash
+	w       io.Writer
+	sums    []string
+	files   []string
+}
+
+func newChunkWriter(base string, size int64) *chunkWriter {
+	return &chunkWriter{base: base, size: size}
+}
+
+func (w *chunkWriter) next() error {
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+	name := w.base
+	if w.size > 0 {
+		name = chunkName(w.base, w.index)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w.index++
+	w.written = 0
+	w.f = f
+	w.h = sha256.New()
+	w.w = io.MultiWriter(f, w.h)
+	w.files = append(w.files, name)
+	return nil
+}
+
+func (w *chunkWriter) closeFile() error {
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Sync()
+	if closeErr := w.f.Close(); err == nil {
+		err = closeErr
+	}
+	w.sums = append(w.sums, fmt.Sprintf("%s  %s", hex.EncodeToString(w.h.Sum(nil)), filepath.Base(w.f.Name())))
+	w.f = nil
+	return err
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if w.f == nil || (w.size > 0 && w.written >= w.size) {
+			if err := w.next(); err != nil {
+				return total, err
+			}
+		}
+		n := len(p)
+		if w.size > 0 && int64(n) > w.size-w.written {
+			n = int(w.size - w.written)
+		}
+		m, err := w.w.Write(p[:n])
+		total += m
+		w.written += int64(m)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Close 关闭最后一个文件并写入校验和文件，返回生成的所有文件
+func (w *chunkWriter) Close() ([]string, error) {
+	if w.f == nil && len(w.files) == 0 {
+		if err := w.next(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.closeFile(); err != nil {
+		return w.files, err
+	}
+	sumFile := w.base + chunkSumSuffix
+	if err := os.WriteFile(sumFile, []byte(strings.Join(w.sums, "\n")+"\n"), 0644); err != nil {
+		return w.files, err
+	}
+	return append(w.files, sumFile), nil
+}
+
+// bundleParts 返回离线包的所有分卷，input可以是完整的文件、分卷的前缀或第一个分卷，以及对应的校验和文件
+func bundleParts(input string) ([]string, string, error) {
+	base := strings.TrimSuffix(input, ".000")
+	if _, err := os.Stat(chunkName(base, 0)); err != nil {
+		if _, err = os.Stat(input); err != nil {
+			return nil, "", err
+		}
+		return []string{input}, input + chunkSumSuffix, nil
+	}
+	parts := make([]string, 0)
+	for i := 0; ; i++ {
+		name := chunkName(base, i)
+		if _, err := os.Stat(name); err != nil {
+			break
+		}
+		parts = append(parts, name)
+	}
+	return parts, base + chunkSumSuffix, nil
+}
+
+// verifyParts 按校验和文件校验每个分卷，校验和文件不存在时跳过
+func verifyParts(parts []string, sumFile string) (bool, error) {
+	f, err := os.Open(sumFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 {
+			sums[fields[1]] = fields[0]
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return false, err
+	}
+	if len(sums) != len(parts) {
+		return false, fmt.Errorf("%s lists %d part(s), found %d", sumFile, len(sums), len(parts))
+	}
+	for _, part := range parts {
+		expected, ok := sums[filepath.Base(part)]
+		if !ok {
+			return false, fmt.Errorf("%s is not listed in %s", part, sumFile)
+		}
+		actual, err := fileSha256(part)
+		if err != nil {
+			return false, err
+		}
+		if actual != expected {
+			return false, fmt.Errorf("%s checksum mismatch, expected %s actual %s", part, expected, actual)
+		}
+	}
+	return true, nil
+}
+
+func fileSha256(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// openParts 按顺序连接所有分卷
+func openParts(parts []string) (io.Reader, func(), error) {
+	files := make([]*os.File, 0, len(parts))
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		f, err := os.Open(part)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		files = append(files, f)
+		readers = append(readers, f)
+	}
+	return io.MultiReader(readers...), closeAll, nil
+}
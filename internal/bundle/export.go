@@ -0,0 +1,280 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package bundle
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"dingospeed/internal/downloader"
+	"dingospeed/pkg/common"
+	"dingospeed/pkg/consts"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Repo 导出的仓库，Revision为分支、标签或commit
+type Repo struct {
+	RepoType string
+	RepoId   string
+	Revision string
+}
+
+func (r Repo) String() string {
+	return fmt.Sprintf("%s/%s@%s", r.RepoType, r.RepoId, r.Revision)
+}
+
+type ExportOptions struct {
+	Repos     string // repos目录
+	Output    string
+	Zstd      bool
+	ChunkSize int64 // 分卷大小，0表示不分卷
+}
+
+type exporter struct {
+	root     string
+	seen     map[string]bool
+	entries  []ManifestFile
+	manifest *Manifest
+}
+
+// Export 将仓库指定版本已缓存的api元数据、blobs及resolve符号链接写入离线包，未缓存完整的文件跳过并计入Incomplete。
+// 返回清单及生成的文件。
+func Export(opts ExportOptions, repos []Repo) (*Manifest, []string, error) {
+	e := &exporter{
+		root:     opts.Repos,
+		seen:     make(map[string]bool),
+		manifest: &Manifest{Version: manifestVersion, CreatedAt: time.Now(), Repos: make([]ManifestRepo, 0, len(repos))},
+	}
+	for _, r := range repos {
+		if err := e.addRepo(r); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", r, err)
+		}
+	}
+	sort.Slice(e.entries, func(i, j int) bool {
+		return e.entries[i].Path < e.entries[j].Path
+	})
+
+	cw := newChunkWriter(opts.Output, opts.ChunkSize)
+	var out io.Writer = cw
+	var zw *zstd.Encoder
+	if opts.Zstd {
+		var err error
+		if zw, err = zstd.NewWriter(cw); err != nil {
+			return nil, nil, err
+		}
+		out = zw
+	}
+	tw := tar.NewWriter(out)
+	err := e.writeEntries(tw)
+	if err == nil {
+		err = tw.Close()
+	}
+	if zw != nil {
+		if closeErr := zw.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	files, closeErr := cw.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, files, err
+	}
+	return e.manifest, files, nil
+}
+
+// resolveCommit 从已缓存的版本信息中获取revision对应的commit
+func resolveCommit(root string, r Repo) (string, error) {
+	metaPath := filepath.Join(root, "api", r.RepoType, r.RepoId, "revision", url.PathEscape(r.Revision), fmt.Sprintf("meta_%s.json", consts.RequestTypeGet))
+	b, err := os.ReadFile(metaPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("revision %s is not cached", r.Revision)
+		}
+		return "", err
+	}
+	var cacheContent common.CacheContent
+	if err = json.Unmarshal(b, &cacheContent); err != nil {
+		return "", fmt.Errorf("parse %s: %w", metaPath, err)
+	}
+	content, err := hex.DecodeString(cacheContent.Content)
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %w", metaPath, err)
+	}
+	var info struct {
+		Sha string `json:"sha"`
+	}
+	if err = json.Unmarshal(content, &info); err != nil || info.Sha == "" {
+		return "", fmt.Errorf("%s has no commit sha", metaPath)
+	}
+	return info.Sha, nil
+}
+
+func (e *exporter) addRepo(r Repo) error {
+	commit, err := resolveCommit(e.root, r)
+	if err != nil {
+		return err
+	}
+	e.manifest.Repos = append(e.manifest.Repos, ManifestRepo{RepoType: r.RepoType, RepoId: r.RepoId, Revision: r.Revision, Commit: commit})
+	repo := len(e.manifest.Repos) - 1
+	revisions := []string{commit}
+	if r.Revision != commit {
+		revisions = append(revisions, url.PathEscape(r.Revision))
+	}
+	// api缓存按api/<type>/<repo>/<接口>/<revision>/...存放，revision为转义后的版本，只导出该版本的部分
+	apiDirs, err := filepath.Glob(filepath.Join(e.root, "api", r.RepoType, r.RepoId, "*"))
+	if err != nil {
+		return err
+	}
+	for _, apiDir := range apiDirs {
+		for _, revision := range revisions {
+			if err = e.addTree(filepath.Join(apiDir, revision), repo); err != nil {
+				return err
+			}
+		}
+	}
+	for _, revision := range revisions {
+		if err = e.addTree(filepath.Join(e.root, "files", r.RepoType, r.RepoId, "resolve", revision), repo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addTree 添加目录下的普通文件及指向完整blob的符号链接，目录不存在时忽略
+func (e *exporter) addTree(dir string, repo int) error {
+	if _, err := os.Lstat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(e.root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case d.Type().IsRegular():
+			e.add(ManifestFile{Path: rel, repo: repo})
+		case d.Type()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if filepath.IsAbs(link) {
+				if link, err = filepath.Rel(filepath.Dir(p), link); err != nil {
+					return err
+				}
+			}
+			link = filepath.ToSlash(link)
+			target, ok := linkTarget(rel, link)
+			if !ok || !blobComplete(filepath.Join(e.root, filepath.FromSlash(target))) {
+				e.manifest.Repos[repo].Incomplete++
+				return nil
+			}
+			e.add(ManifestFile{Path: target, repo: repo})
+			e.add(ManifestFile{Path: rel, Link: link, repo: repo})
+		}
+		return nil
+	})
+}
+
+// add 多个仓库或版本共用的文件只添加一次，计入第一个仓库
+func (e *exporter) add(f ManifestFile) {
+	if e.seen[f.Path] {
+		return
+	}
+	e.seen[f.Path] = true
+	e.entries = append(e.entries, f)
+	if !f.IsLink() {
+		e.manifest.Repos[f.repo].Files++
+	}
+}
+
+// blobComplete blob已转换为普通文件，或缓存文件已包含全部数据块
+func blobComplete(p string) bool {
+	stat, err := os.Stat(p)
+	if err != nil || !stat.Mode().IsRegular() {
+		return false
+	}
+	if !downloader.IsCacheFile(p) {
+		return true
+	}
+	info, err := downloader.InspectCacheFile(p)
+	return err == nil && info.Complete()
+}
+
+func (e *exporter) writeEntries(tw *tar.Writer) error {
+	for i := range e.entries {
+		f := &e.entries[i]
+		if f.IsLink() {
+			hdr := &tar.Header{Typeflag: tar.TypeSymlink, Name: f.Path, Linkname: f.Link, Mode: 0777, ModTime: e.manifest.CreatedAt}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+		} else if err := e.writeFile(tw, f); err != nil {
+			return err
+		}
+		e.manifest.Repos[f.repo].Bytes += f.Size
+	}
+	e.manifest.Files = e.entries
+	b, err := json.MarshalIndent(e.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Typeflag: tar.TypeReg, Name: ManifestName, Size: int64(len(b)), Mode: 0644, ModTime: e.manifest.CreatedAt}
+	if err = tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = tw.Write(b)
+	return err
+}
+
+// writeFile 写入普通文件并计算sha256，以打开时的大小为准，期间被替换的文件不影响已打开的内容
+func (e *exporter) writeFile(tw *tar.Writer, f *ManifestFile) error {
+	src, err := os.Open(filepath.Join(e.root, filepath.FromSlash(f.Path)))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	f.Size = stat.Size()
+	hdr := &tar.Header{Typeflag: tar.TypeReg, Name: f.Path, Size: f.Size, Mode: 0644, ModTime: stat.ModTime()}
+	if err = tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err = io.CopyN(io.MultiWriter(tw, h), src, f.Size); err != nil {
+		return fmt.Errorf("%s: %w", f.Path, err)
+	}
+	f.Sha256 = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
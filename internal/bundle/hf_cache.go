@@ -0,0 +1,347 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package bundle
+
+// huggingface_hub的缓存目录结构为<type>--<org>--<repo>/{blobs,snapshots,refs}，snapshots/<commit>下的文件为
+// 指向blobs/<etag>的符号链接，lfs文件的etag为sha256，其他文件为git blob的sha1。导入时校验blob后复制到
+// files/<type>/<org>/<repo>/blobs，创建resolve/<commit>下的符号链接，并合成对应的meta和paths-info缓存。
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dingospeed/internal/dao"
+	"dingospeed/pkg/common"
+	"dingospeed/pkg/consts"
+	"dingospeed/pkg/util"
+)
+
+var (
+	hfCacheRepoRe = regexp.MustCompile(`^(models|datasets|spaces)--(.+)$`)
+	commitRe      = regexp.MustCompile(`^[0-9a-f]{40}$`)
+)
+
+type HfCacheOptions struct {
+	Repos string   // repos目录
+	Cache string   // huggingface_hub的缓存目录，如~/.cache/huggingface/hub
+	Only  []string // 只导入这些仓库，为空时导入全部
+}
+
+// HfCacheResult 一个快照的导入结果
+type HfCacheResult struct {
+	RepoType string   `json:"repoType"`
+	RepoId   string   `json:"repoId"`
+	Commit   string   `json:"commit"`
+	Refs     []string `json:"refs,omitempty"`
+	Files    int      `json:"files"`
+	Bytes    int64    `json:"bytes"`
+	Existing int      `json:"existing"` // 本地已有完整blob的文件数
+	Failed   []string `json:"failed,omitempty"`
+}
+
+// ImportHfCache 导入huggingface_hub缓存目录中的所有快照，已有的api缓存不覆盖。
+// 合成的文件列表只包含快照中已缓存的文件。
+func ImportHfCache(opts HfCacheOptions) ([]HfCacheResult, error) {
+	entries, err := os.ReadDir(opts.Cache)
+	if err != nil {
+		return nil, err
+	}
+	only := make(map[string]bool, len(opts.Only))
+	for _, repoId := range opts.Only {
+		only[repoId] = true
+	}
+	results := make([]HfCacheResult, 0)
+	for _, entry := range entries {
+		m := hfCacheRepoRe.FindStringSubmatch(entry.Name())
+		if m == nil || !entry.IsDir() {
+			continue
+		}
+		repoType, repoId := m[1], strings.ReplaceAll(m[2], "--", "/")
+		if len(only) > 0 && !only[repoId] {
+			continue
+		}
+		imp := &hfCacheImporter{
+			root:     opts.Repos,
+			repoDir:  filepath.Join(opts.Cache, entry.Name()),
+			repoType: repoType,
+			repoId:   repoId,
+			fileDao:  &dao.FileDao{}, // 只用于写入api缓存，不需要NewFileDao初始化内存缓存
+		}
+		ret, err := imp.importRepo()
+		if err != nil {
+			return results, fmt.Errorf("%s/%s: %w", repoType, repoId, err)
+		}
+		results = append(results, ret...)
+	}
+	return results, nil
+}
+
+type hfCacheImporter struct {
+	root     string
+	repoDir  string
+	repoType string
+	repoId   string
+	fileDao  *dao.FileDao
+}
+
+// readRefs 读取refs目录，返回commit对应的分支或标签
+func (h *hfCacheImporter) readRefs() (map[string][]string, error) {
+	refs := make(map[string][]string)
+	refsDir := filepath.Join(h.repoDir, "refs")
+	if _, err := os.Stat(refsDir); os.IsNotExist(err) {
+		return refs, nil
+	}
+	err := filepath.WalkDir(refsDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(refsDir, p)
+		if err != nil {
+			return err
+		}
+		commit := strings.TrimSpace(string(b))
+		refs[commit] = append(refs[commit], filepath.ToSlash(name))
+		return nil
+	})
+	return refs, err
+}
+
+func (h *hfCacheImporter) importRepo() ([]HfCacheResult, error) {
+	refs, err := h.readRefs()
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := os.ReadDir(filepath.Join(h.repoDir, "snapshots"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	results := make([]HfCacheResult, 0, len(snapshots))
+	for _, s := range snapshots {
+		if !s.IsDir() || !commitRe.MatchString(s.Name()) {
+			continue
+		}
+		ret := HfCacheResult{RepoType: h.repoType, RepoId: h.repoId, Commit: s.Name(), Refs: refs[s.Name()]}
+		if err = h.importSnapshot(&ret); err != nil {
+			return results, err
+		}
+		results = append(results, ret)
+	}
+	return results, nil
+}
+
+func (h *hfCacheImporter) importSnapshot(ret *HfCacheResult) error {
+	snapshotDir := filepath.Join(h.repoDir, "snapshots", ret.Commit)
+	siblings := make([]dao.Sibling, 0)
+	err := filepath.WalkDir(snapshotDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(snapshotDir, p)
+		if err != nil {
+			return err
+		}
+		fileName := filepath.ToSlash(rel)
+		if err = h.importFile(ret, p, fileName); err != nil {
+			ret.Failed = append(ret.Failed, fmt.Sprintf("%s: %v", fileName, err))
+			return nil
+		}
+		siblings = append(siblings, dao.Sibling{Rfilename: fileName})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(siblings) == 0 {
+		return nil
+	}
+	sort.Slice(siblings, func(i, j int) bool {
+		return siblings[i].Rfilename < siblings[j].Rfilename
+	})
+	lastModified := ""
+	if stat, err := os.Stat(snapshotDir); err == nil {
+		lastModified = stat.ModTime().UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	info := hfRevisionInfo{
+		Id:           ret.RepoId,
+		Author:       strings.Split(ret.RepoId, "/")[0],
+		Sha:          ret.Commit,
+		LastModified: lastModified,
+		Tags:         []string{},
+		Siblings:     siblings,
+	}
+	if ret.RepoType == "models" {
+		info.ModelId = ret.RepoId
+	}
+	content, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	for _, rev := range append([]string{ret.Commit}, ret.Refs...) {
+		metaPath := filepath.Join(h.root, "api", ret.RepoType, ret.RepoId, "revision", url.PathEscape(rev), fmt.Sprintf("meta_%s.json", consts.RequestTypeGet))
+		if err = h.writeCache(metaPath, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hfRevisionInfo 合成的/api/<type>/<repo>/revision/<revision>响应
+type hfRevisionInfo struct {
+	Id           string        `json:"id"`
+	ModelId      string        `json:"modelId,omitempty"`
+	Author       string        `json:"author"`
+	Sha          string        `json:"sha"`
+	LastModified string        `json:"lastModified,omitempty"`
+	Private      bool          `json:"private"`
+	Disabled     bool          `json:"disabled"`
+	Gated        bool          `json:"gated"`
+	Tags         []string      `json:"tags"`
+	Siblings     []dao.Sibling `json:"siblings"`
+}
+
+// writeCache 写入合成的api缓存，已存在时保留原有内容
+func (h *hfCacheImporter) writeCache(apiPath string, content []byte) error {
+	if util.FileExists(apiPath) {
+		return nil
+	}
+	if err := util.MakeDirs(apiPath); err != nil {
+		return err
+	}
+	headers := map[string]string{
+		"content-type":   "application/json",
+		"content-length": strconv.Itoa(len(content)),
+	}
+	return h.fileDao.WriteCacheRequest(apiPath, http.StatusOK, headers, content)
+}
+
+// importFile 校验并复制快照中的一个文件，创建resolve符号链接及paths-info缓存
+func (h *hfCacheImporter) importFile(ret *HfCacheResult, snapshotFile, fileName string) error {
+	link, err := os.Readlink(snapshotFile)
+	if err != nil {
+		return fmt.Errorf("not a symlink to blobs")
+	}
+	etag := filepath.Base(link)
+	blobPath := filepath.Join(h.repoDir, "blobs", etag)
+	stat, err := os.Stat(blobPath)
+	if err != nil {
+		return err
+	}
+	pathInfo := common.PathsInfo{Type: "file", Oid: etag, Size: stat.Size(), Path: fileName}
+	var hasher hash.Hash
+	switch len(etag) {
+	case sha256.Size * 2:
+		pointer := lfsPointer(etag, stat.Size())
+		pathInfo.Oid = gitBlobSha1([]byte(pointer))
+		pathInfo.Lfs = common.Lfs{Oid: etag, Size: stat.Size(), PointerSize: int64(len(pointer))}
+		hasher = sha256.New()
+	case sha1.Size * 2:
+		hasher = sha1.New()
+		fmt.Fprintf(hasher, "blob %d\x00", stat.Size())
+	default:
+		return fmt.Errorf("unknown etag %s", etag)
+	}
+
+	repoPath := filepath.Join(ret.RepoType, ret.RepoId)
+	blobsFile := filepath.Join(h.root, "files", repoPath, "blobs", etag)
+	if blobComplete(blobsFile) {
+		ret.Existing++
+	} else if err = copyVerified(blobPath, blobsFile, hasher, etag); err != nil {
+		return err
+	}
+	filesPath := filepath.Join(h.root, "files", repoPath, "resolve", ret.Commit, filepath.FromSlash(fileName))
+	if err = util.MakeDirs(filesPath); err != nil {
+		return err
+	}
+	if err = util.CreateSymlinkIfNotExists(blobsFile, filesPath); err != nil {
+		return err
+	}
+	content, err := json.Marshal([]common.PathsInfo{pathInfo})
+	if err != nil {
+		return err
+	}
+	apiPath := filepath.Join(h.root, "api", repoPath, "paths-info", ret.Commit, filepath.FromSlash(fileName), "paths-info_post.json")
+	if err = h.writeCache(apiPath, content); err != nil {
+		return err
+	}
+	ret.Files++
+	ret.Bytes += stat.Size()
+	return nil
+}
+
+// copyVerified 复制blob的同时计算哈希，与etag一致时才移动到目标位置，作为普通文件直接提供下载
+func copyVerified(src, dst string, hasher hash.Hash, etag string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err = util.MakeDirs(dst); err != nil {
+		return err
+	}
+	tmpPath := dst + ".importing"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.MultiWriter(out, hasher), in)
+	if syncErr := out.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		if actual := hex.EncodeToString(hasher.Sum(nil)); actual != etag {
+			err = fmt.Errorf("checksum mismatch, actual %s", actual)
+		}
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, dst)
+}
+
+func lfsPointer(oid string, size int64) string {
+	return fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, size)
+}
+
+// gitBlobSha1 git对象的sha1，即hub返回的oid
+func gitBlobSha1(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,129 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package bundle
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"dingospeed/internal/dao"
+	"dingospeed/pkg/common"
+)
+
+// writeHfCacheFile 按huggingface_hub的结构写入快照中的文件，blob以etag命名
+func writeHfCacheFile(t *testing.T, repoDir, commit, name, etag string, content []byte) {
+	t.Helper()
+	blob := filepath.Join(repoDir, "blobs", etag)
+	snapshotFile := filepath.Join(repoDir, "snapshots", commit, filepath.FromSlash(name))
+	for _, dir := range []string{filepath.Dir(blob), filepath.Dir(snapshotFile)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(blob, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rel, _ := filepath.Rel(filepath.Dir(snapshotFile), blob)
+	if err := os.Symlink(rel, snapshotFile); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestCache(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	cacheContent, err := (&dao.FileDao{}).ReadCacheRequest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(cacheContent.OriginContent, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 导入huggingface_hub缓存：校验通过的blob复制到repos并合成meta和paths-info，内容与etag不一致的blob记入Failed
+func TestImportHfCache(t *testing.T) {
+	cache, root := t.TempDir(), t.TempDir()
+	repoDir := filepath.Join(cache, "models--org--repo")
+	config := []byte(`{"model_type":"test"}`)
+	weights := bytes.Repeat([]byte("weights"), 1000)
+	corrupted := bytes.Repeat([]byte("corrupted"), 100)
+	configOid := gitBlobSha1(config)
+	writeHfCacheFile(t, repoDir, testCommit, "config.json", configOid, config)
+	writeHfCacheFile(t, repoDir, testCommit, "sub/model.safetensors", blobOid(weights), weights)
+	// 写入后被修改的blob
+	writeHfCacheFile(t, repoDir, testCommit, "broken.safetensors", blobOid(corrupted), append([]byte("x"), corrupted[1:]...))
+	if err := os.MkdirAll(filepath.Join(repoDir, "refs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "refs", "main"), []byte(testCommit), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := ImportHfCache(HfCacheOptions{Repos: root, Cache: cache})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("imported %d snapshot(s), want 1", len(results))
+	}
+	ret := results[0]
+	if ret.RepoId != "org/repo" || ret.Commit != testCommit || !reflect.DeepEqual(ret.Refs, []string{"main"}) ||
+		ret.Files != 2 || ret.Bytes != int64(len(config)+len(weights)) {
+		t.Fatalf("import result %+v", ret)
+	}
+	if len(ret.Failed) != 1 || !strings.HasPrefix(ret.Failed[0], "broken.safetensors: checksum mismatch") {
+		t.Fatalf("failed files %v, want broken.safetensors", ret.Failed)
+	}
+
+	repoFiles := filepath.Join(root, "files", "models", "org", "repo")
+	for name, content := range map[string][]byte{"config.json": config, "sub/model.safetensors": weights} {
+		if b, err := os.ReadFile(filepath.Join(repoFiles, "resolve", testCommit, filepath.FromSlash(name))); err != nil || !bytes.Equal(b, content) {
+			t.Fatalf("read %s through the resolve link: %v", name, err)
+		}
+	}
+	if blobs, _ := os.ReadDir(filepath.Join(repoFiles, "blobs")); len(blobs) != 2 {
+		t.Fatalf("%d blob(s) in repos, want 2 without the corrupted one", len(blobs))
+	}
+
+	// main和commit的meta只列出导入成功的文件
+	for _, rev := range []string{"main", testCommit} {
+		var info dao.CommitHfSha
+		readTestCache(t, filepath.Join(root, "api", "models", "org", "repo", "revision", rev, "meta_get.json"), &info)
+		want := []dao.Sibling{{Rfilename: "config.json"}, {Rfilename: "sub/model.safetensors"}}
+		if info.Sha != testCommit || !reflect.DeepEqual(info.Siblings, want) {
+			t.Fatalf("meta of %s: %+v", rev, info)
+		}
+	}
+	var pathsInfo []common.PathsInfo
+	readTestCache(t, filepath.Join(root, "api", "models", "org", "repo", "paths-info", testCommit, "sub", "model.safetensors", "paths-info_post.json"), &pathsInfo)
+	if len(pathsInfo) != 1 || pathsInfo[0].Lfs.Oid != blobOid(weights) || pathsInfo[0].Size != int64(len(weights)) || len(pathsInfo[0].Oid) != hex.EncodedLen(20) {
+		t.Fatalf("paths-info of the lfs file: %+v", pathsInfo)
+	}
+
+	// 再次导入时已有的blob不再复制
+	results, err = ImportHfCache(HfCacheOptions{Repos: root, Cache: cache, Only: []string{"org/repo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Existing != 2 || results[0].Files != 2 {
+		t.Fatalf("second import result %+v, want 2 existing", results[0])
+	}
+}
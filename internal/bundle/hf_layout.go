@@ -0,0 +1,230 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package bundle
+
+// 以huggingface_hub缓存目录的结构提供repos中的文件：<type>--<org>--<repo>/blobs/<etag>为指向repos中blob的
+// 符号链接，snapshots/<commit>/<file>指向../../blobs/<etag>，refs/<revision>记录commit。
+// 只链接已转换为普通文件的blob，带头部的缓存文件在转换后的下一次同步时链接。
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"dingospeed/internal/downloader"
+	"dingospeed/pkg/consts"
+)
+
+type HfLayoutResult struct {
+	Linked  int `json:"linked"`  // 新建的快照文件数
+	Pending int `json:"pending"` // blob尚未转换为普通文件而未链接的文件数
+	Refs    int `json:"refs"`    // 新建或更新的refs数
+	Removed int `json:"removed"` // 指向已删除blob而移除的链接数
+}
+
+// hfRepoFolder 与huggingface_hub的repo_folder_name一致
+func hfRepoFolder(repoType, repoId string) string {
+	return repoType + "--" + strings.ReplaceAll(repoId, "/", "--")
+}
+
+// LinkHfLayout 在hubDir下建立或更新root中所有仓库的huggingface_hub缓存结构，并清理失效的链接。
+// 链接使用相对路径，hubDir与root位于同一个共享存储时，挂载到其他路径也可以访问。
+func LinkHfLayout(root, hubDir string) (*HfLayoutResult, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if hubDir, err = filepath.Abs(hubDir); err != nil {
+		return nil, err
+	}
+	result := &HfLayoutResult{}
+	for repoType := range consts.RepoTypesMapping {
+		// 仓库目录为files/<type>/<org>/<repo>，没有org的仓库为files/<type>/<repo>
+		for _, pattern := range []string{"*/resolve", "*/*/resolve"} {
+			resolveDirs, err := filepath.Glob(filepath.Join(root, "files", repoType, pattern))
+			if err != nil {
+				return result, err
+			}
+			for _, resolveDir := range resolveDirs {
+				repoDir := filepath.Dir(resolveDir)
+				repoId, err := filepath.Rel(filepath.Join(root, "files", repoType), repoDir)
+				if err != nil {
+					return result, err
+				}
+				repoId = filepath.ToSlash(repoId)
+				l := &hfLayout{root: root, repoType: repoType, repoId: repoId, repoDir: repoDir,
+					hubRepo: filepath.Join(hubDir, hfRepoFolder(repoType, repoId)), result: result}
+				if err = l.link(); err != nil {
+					return result, err
+				}
+			}
+		}
+	}
+	if err = pruneHfLayout(hubDir, result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+type hfLayout struct {
+	root     string
+	repoType string
+	repoId   string
+	repoDir  string
+	hubRepo  string
+	result   *HfLayoutResult
+}
+
+func (l *hfLayout) link() error {
+	commits, err := os.ReadDir(filepath.Join(l.repoDir, "resolve"))
+	if err != nil {
+		return err
+	}
+	for _, c := range commits {
+		if !c.IsDir() || !commitRe.MatchString(c.Name()) {
+			continue
+		}
+		if err = l.linkSnapshot(c.Name()); err != nil {
+			return err
+		}
+	}
+	return l.linkRefs()
+}
+
+func (l *hfLayout) linkSnapshot(commit string) error {
+	resolveDir := filepath.Join(l.repoDir, "resolve", commit)
+	return filepath.WalkDir(resolveDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.Type()&os.ModeSymlink == 0 {
+			return err
+		}
+		rel, err := filepath.Rel(resolveDir, p)
+		if err != nil {
+			return err
+		}
+		snapshotFile := filepath.Join(l.hubRepo, "snapshots", commit, rel)
+		if _, err = os.Stat(snapshotFile); err == nil {
+			return nil
+		}
+		link, err := os.Readlink(p)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(p), link)
+		}
+		etag := filepath.Base(link)
+		if filepath.Dir(link) != filepath.Join(l.repoDir, "blobs") {
+			return nil
+		}
+		stat, err := os.Stat(link)
+		if err != nil || !stat.Mode().IsRegular() {
+			// blob已被清理
+			return nil
+		}
+		if downloader.IsCacheFile(link) {
+			l.result.Pending++
+			return nil
+		}
+		hubBlob := filepath.Join(l.hubRepo, "blobs", etag)
+		if err = relSymlink(link, hubBlob); err != nil {
+			return err
+		}
+		if err = relSymlink(hubBlob, snapshotFile); err != nil {
+			return err
+		}
+		l.result.Linked++
+		return nil
+	})
+}
+
+// linkRefs 根据已缓存的分支、标签信息写入refs，只写入已有快照的commit
+func (l *hfLayout) linkRefs() error {
+	revisions, err := os.ReadDir(filepath.Join(l.root, "api", l.repoType, l.repoId, "revision"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, rev := range revisions {
+		if !rev.IsDir() || commitRe.MatchString(rev.Name()) {
+			continue
+		}
+		// 目录名为转义后的版本，refs下按原始版本存放，如refs/refs/convert/parquet
+		name, err := url.PathUnescape(rev.Name())
+		if err != nil {
+			continue
+		}
+		commit, err := resolveCommit(l.root, Repo{RepoType: l.repoType, RepoId: l.repoId, Revision: name})
+		if err != nil {
+			continue
+		}
+		if _, err = os.Stat(filepath.Join(l.hubRepo, "snapshots", commit)); err != nil {
+			continue
+		}
+		refFile := filepath.Join(l.hubRepo, "refs", filepath.FromSlash(name))
+		if b, err := os.ReadFile(refFile); err == nil && string(b) == commit {
+			continue
+		}
+		if err = os.MkdirAll(filepath.Dir(refFile), 0755); err != nil {
+			return err
+		}
+		// 先写临时文件再替换，读取方不会读到不完整的内容
+		tmpFile := refFile + ".tmp"
+		if err = os.WriteFile(tmpFile, []byte(commit), 0644); err != nil {
+			return err
+		}
+		if err = os.Rename(tmpFile, refFile); err != nil {
+			return err
+		}
+		l.result.Refs++
+	}
+	return nil
+}
+
+// relSymlink 创建指向target的相对路径符号链接，已存在时保留
+func relSymlink(target, linkPath string) error {
+	if _, err := os.Lstat(linkPath); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(linkPath), 0755); err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(filepath.Dir(linkPath), target)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(rel, linkPath)
+}
+
+// pruneHfLayout 移除指向已删除blob的链接，如缓存清理删除了repos中的文件
+func pruneHfLayout(hubDir string, result *HfLayoutResult) error {
+	if _, err := os.Stat(hubDir); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.WalkDir(hubDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.Type()&os.ModeSymlink == 0 {
+			return err
+		}
+		if _, err = os.Stat(p); os.IsNotExist(err) {
+			if err = os.Remove(p); err != nil {
+				return err
+			}
+			result.Removed++
+		}
+		return nil
+	})
+}
@@ -0,0 +1,85 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package bundle
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 普通文件blob链接到huggingface_hub结构，缓存文件等待转换，blob被删除后移除失效的链接
+func TestLinkHfLayout(t *testing.T) {
+	root, hub := t.TempDir(), t.TempDir()
+	repo := testRepo{
+		repoType: "models", repoId: "org/repo", revision: "main", commit: testCommit,
+		files: map[string][]byte{
+			"config.json":    []byte(`{"model_type":"test"}`),
+			"sub/model.bin":  bytes.Repeat([]byte("weights"), 300),
+			"downloading.gz": bytes.Repeat([]byte("partial"), 300),
+		},
+		incomplete: []string{"downloading.gz"},
+	}
+	writeTestRepo(t, root, repo)
+	// 没有org的仓库
+	writeTestRepo(t, root, testRepo{repoType: "datasets", repoId: "squad", revision: "main", commit: testCommit,
+		files: map[string][]byte{"train.json": []byte(`[]`)}})
+
+	result, err := LinkHfLayout(root, hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *result != (HfLayoutResult{Linked: 3, Pending: 1, Refs: 2}) {
+		t.Fatalf("first link %+v", *result)
+	}
+	hubRepo := filepath.Join(hub, "models--org--repo")
+	for _, name := range []string{"config.json", "sub/model.bin"} {
+		snapshotFile := filepath.Join(hubRepo, "snapshots", testCommit, filepath.FromSlash(name))
+		if b, err := os.ReadFile(snapshotFile); err != nil || !bytes.Equal(b, repo.files[name]) {
+			t.Fatalf("read %s from the hub layout: %v", name, err)
+		}
+		if link, _ := os.Readlink(snapshotFile); filepath.IsAbs(link) {
+			t.Fatalf("%s links to absolute path %s", name, link)
+		}
+	}
+	if _, err = os.Lstat(filepath.Join(hubRepo, "snapshots", testCommit, "downloading.gz")); !os.IsNotExist(err) {
+		t.Fatalf("incomplete blob is linked: %v", err)
+	}
+	for _, refFile := range []string{filepath.Join(hubRepo, "refs", "main"), filepath.Join(hub, "datasets--squad", "refs", "main")} {
+		if b, err := os.ReadFile(refFile); err != nil || string(b) != testCommit {
+			t.Fatalf("read %s: %q, %v", refFile, b, err)
+		}
+	}
+
+	// 没有变化时不重复链接
+	if result, err = LinkHfLayout(root, hub); err != nil || *result != (HfLayoutResult{Pending: 1}) {
+		t.Fatalf("second link %+v, %v", result, err)
+	}
+
+	// 缓存清理删除blob后，hub中的blob链接及快照链接都被移除
+	if err = os.Remove(filepath.Join(root, "files", "models", "org", "repo", "blobs", blobOid(repo.files["sub/model.bin"]))); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = LinkHfLayout(root, hub); err != nil || *result != (HfLayoutResult{Pending: 1, Removed: 2}) {
+		t.Fatalf("link after removing a blob %+v, %v", result, err)
+	}
+	if _, err = os.Lstat(filepath.Join(hubRepo, "snapshots", testCommit, "sub", "model.bin")); !os.IsNotExist(err) {
+		t.Fatalf("dangling snapshot link is kept: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(hubRepo, "snapshots", testCommit, "config.json")); err != nil {
+		t.Fatalf("valid snapshot link is removed: %v", err)
+	}
+}
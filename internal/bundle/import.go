@@ -0,0 +1,261 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+type ImportOptions struct {
+	Repos string // repos目录
+	Input string // 离线包文件、分卷前缀或第一个分卷
+}
+
+type ImportResult struct {
+	Manifest *Manifest
+	Verified bool // 是否按校验和文件校验了分卷
+	Imported int
+	Skipped  int // 本地已有完整blob而跳过的文件数
+	// Incomplete 本地已有但未缓存完整的blob，运行中的服务可能正在读写，保留不变，由服务继续下载
+	Incomplete []string
+}
+
+// Import 校验离线包并合并到repos目录。离线包先解压到repos下的临时目录，与清单逐一核对大小、sha256及链接，
+// 全部通过后再移动到目标位置：先移动blob，再移动api缓存和符号链接。本地已有的blob不论是否完整都不覆盖，
+// 运行中的服务可能打开了这些文件，导入不需要停止服务。
+func Import(opts ImportOptions) (*ImportResult, error) {
+	parts, sumFile, err := bundleParts(opts.Input)
+	if err != nil {
+		return nil, err
+	}
+	result := &ImportResult{}
+	if result.Verified, err = verifyParts(parts, sumFile); err != nil {
+		return nil, err
+	}
+	r, closeParts, err := openParts(parts)
+	if err != nil {
+		return nil, err
+	}
+	defer closeParts()
+	br := bufio.NewReader(r)
+	var in io.Reader = br
+	if magic, _ := br.Peek(len(zstdMagic)); bytes.Equal(magic, zstdMagic) {
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		in = zr
+	}
+
+	if err = os.MkdirAll(opts.Repos, 0755); err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(opts.Repos, ".import-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+	extracted, manifest, err := extract(tar.NewReader(in), staging)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkManifest(manifest, extracted); err != nil {
+		return nil, err
+	}
+	result.Manifest = manifest
+	if err = merge(manifest, staging, opts.Repos, result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// extract 解压到临时目录，返回实际的文件信息及清单
+func extract(tr *tar.Reader, staging string) (map[string]ManifestFile, *Manifest, error) {
+	extracted := make(map[string]ManifestFile)
+	var manifest *Manifest
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		name := hdr.Name
+		if name == ManifestName {
+			manifest = &Manifest{}
+			if err = json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, nil, fmt.Errorf("parse %s: %w", ManifestName, err)
+			}
+			continue
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		if !importableEntry(name) {
+			return nil, nil, fmt.Errorf("invalid entry %s", name)
+		}
+		if _, ok := extracted[name]; ok {
+			return nil, nil, fmt.Errorf("duplicate entry %s", name)
+		}
+		dst := filepath.Join(staging, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return nil, nil, err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			f, err := extractFile(tr, name, dst)
+			if err != nil {
+				return nil, nil, err
+			}
+			extracted[name] = f
+		case tar.TypeSymlink:
+			if _, ok := linkTarget(name, hdr.Linkname); !ok {
+				return nil, nil, fmt.Errorf("invalid link %s -> %s", name, hdr.Linkname)
+			}
+			if err = os.Symlink(filepath.FromSlash(hdr.Linkname), dst); err != nil {
+				return nil, nil, err
+			}
+			extracted[name] = ManifestFile{Path: name, Link: hdr.Linkname}
+		default:
+			return nil, nil, fmt.Errorf("unsupported entry %s", name)
+		}
+	}
+	return extracted, manifest, nil
+}
+
+func extractFile(r io.Reader, name, dst string) (ManifestFile, error) {
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, h), r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("%s: %w", name, err)
+	}
+	return ManifestFile{Path: name, Size: n, Sha256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// checkManifest 离线包中的文件必须与清单完全一致，符号链接指向的blob必须在离线包中
+func checkManifest(manifest *Manifest, extracted map[string]ManifestFile) error {
+	if manifest == nil {
+		return fmt.Errorf("missing %s, not a dingospeed bundle or the bundle is truncated", ManifestName)
+	}
+	if manifest.Version > manifestVersion {
+		return fmt.Errorf("unsupported bundle version %d", manifest.Version)
+	}
+	if len(manifest.Files) != len(extracted) {
+		return fmt.Errorf("manifest lists %d file(s), bundle contains %d", len(manifest.Files), len(extracted))
+	}
+	for _, f := range manifest.Files {
+		if !importableEntry(f.Path) {
+			return fmt.Errorf("invalid entry %s", f.Path)
+		}
+		actual, ok := extracted[f.Path]
+		if !ok {
+			return fmt.Errorf("%s is missing", f.Path)
+		}
+		if f.IsLink() {
+			target, _ := linkTarget(f.Path, f.Link)
+			if actual.Link != f.Link {
+				return fmt.Errorf("%s links to %s, expected %s", f.Path, actual.Link, f.Link)
+			}
+			if t, ok := extracted[target]; !ok || t.IsLink() {
+				return fmt.Errorf("%s links to missing blob %s", f.Path, target)
+			}
+			continue
+		}
+		if actual.IsLink() || actual.Size != f.Size || actual.Sha256 != f.Sha256 {
+			return fmt.Errorf("%s checksum mismatch, expected %s actual %s", f.Path, f.Sha256, actual.Sha256)
+		}
+	}
+	return nil
+}
+
+// merge 按blob、api缓存、符号链接的顺序移动到repos目录，避免服务读到指向不存在blob的链接
+func merge(manifest *Manifest, staging, root string, result *ImportResult) error {
+	ordered := make([]ManifestFile, 0, len(manifest.Files))
+	for _, pass := range []func(f *ManifestFile) bool{
+		func(f *ManifestFile) bool { return f.IsBlob() },
+		func(f *ManifestFile) bool { return !f.IsBlob() && !f.IsLink() },
+		func(f *ManifestFile) bool { return f.IsLink() },
+	} {
+		for i := range manifest.Files {
+			if pass(&manifest.Files[i]) {
+				ordered = append(ordered, manifest.Files[i])
+			}
+		}
+	}
+	for _, f := range ordered {
+		src := filepath.Join(staging, filepath.FromSlash(f.Path))
+		dst := filepath.Join(root, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if f.IsBlob() {
+			added, err := addBlob(src, dst)
+			if err != nil {
+				return err
+			}
+			if added {
+				result.Imported++
+			} else if blobComplete(dst) {
+				result.Skipped++
+			} else {
+				result.Incomplete = append(result.Incomplete, f.Path)
+			}
+			continue
+		}
+		if f.IsLink() {
+			if err := os.Remove(dst); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return err
+		}
+		result.Imported++
+	}
+	return nil
+}
+
+// addBlob 只添加本地不存在的blob，通过硬链接实现不覆盖的移动，与服务同时创建同一blob时以服务的文件为准
+func addBlob(src, dst string) (bool, error) {
+	if err := os.Link(src, dst); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, os.Remove(src)
+}
@@ -0,0 +1,88 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package bundle 离线包的导出与导入。离线包为tar格式（可选zstd压缩、分卷），包含仓库指定版本的
+// api缓存、blobs及resolve符号链接，路径与repos目录一致，最后一个条目为记录仓库和文件校验和的清单。
+// 同时支持huggingface_hub缓存目录与repos目录之间的导入和链接。
+package bundle
+
+import (
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	ManifestName    = "manifest.json"
+	manifestVersion = 1
+	chunkSumSuffix  = ".sha256"
+)
+
+// Manifest 离线包清单，Files中的路径相对于repos目录
+type Manifest struct {
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Repos     []ManifestRepo `json:"repos"`
+	Files     []ManifestFile `json:"files"`
+}
+
+type ManifestRepo struct {
+	RepoType string `json:"repoType"`
+	RepoId   string `json:"repoId"`
+	Revision string `json:"revision"`
+	Commit   string `json:"commit"`
+	Files    int    `json:"files"`
+	Bytes    int64  `json:"bytes"`
+	// Incomplete 未缓存完整而没有导出的文件数
+	Incomplete int `json:"incomplete,omitempty"`
+}
+
+// ManifestFile 普通文件记录大小和sha256，符号链接只记录链接目标
+type ManifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size,omitempty"`
+	Sha256 string `json:"sha256,omitempty"`
+	Link   string `json:"link,omitempty"`
+	repo   int    // 导出时所属的仓库
+}
+
+func (f *ManifestFile) IsLink() bool {
+	return f.Link != ""
+}
+
+func (f *ManifestFile) IsBlob() bool {
+	return strings.HasPrefix(f.Path, "files/") && path.Base(path.Dir(f.Path)) == "blobs"
+}
+
+// validEntryPath 条目路径必须是repos目录下的相对路径
+func validEntryPath(name string) bool {
+	return name != "" && !path.IsAbs(name) && path.Clean(name) == name && name != ".." && !strings.HasPrefix(name, "../")
+}
+
+// importableEntry 只导入api缓存和files目录下的文件，repos目录下的其他文件（如预热任务、跟踪的仓库）属于服务的状态
+func importableEntry(name string) bool {
+	return validEntryPath(name) && (strings.HasPrefix(name, "api/") || strings.HasPrefix(name, "files/"))
+}
+
+// linkTarget 符号链接指向的条目路径，只允许指向files目录下的blob
+func linkTarget(name, link string) (string, bool) {
+	if path.IsAbs(link) {
+		return "", false
+	}
+	target := path.Join(path.Dir(name), link)
+	if !validEntryPath(target) || !strings.HasPrefix(target, "files/") || path.Base(path.Dir(target)) != "blobs" {
+		return "", false
+	}
+	return target, true
+}
@@ -0,0 +1,348 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package dao
+
+// 不带版本的仓库信息、refs、提交记录及仓库列表接口：在线时代理到上游并缓存，离线或上游不可用时读取缓存，
+// 缓存不存在时根据已缓存的版本信息（api/<type>/<repo>/revision/<revision>/meta_get.json）合成。
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dingospeed/pkg/common"
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/consts"
+	"dingospeed/pkg/upstream"
+	"dingospeed/pkg/util"
+
+	"github.com/bytedance/sonic"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	nextLinkRe  = regexp.MustCompile(`<([^>]*)>\s*;\s*rel="?next"?`)
+	commitShaRe = regexp.MustCompile(`^[0-9a-f]{40}$`)
+)
+
+// proxyApiGenerator 在线时请求上游，200的响应写入apiCachePath（为空时不缓存）；离线或请求失败时读取缓存，
+// 缓存不存在时调用synthesize合成，synthesize为空时返回404。rewrite不为空时，返回前改写响应体，缓存的仍为上游的原始内容
+func (m *MetaDao) proxyApiGenerator(c echo.Context, repo, reqPath, apiCachePath string, rewrite func([]byte) []byte, synthesize func() error) error {
+	if config.SysConfig.Online() {
+		headers := map[string]string{}
+		if authorization := c.Request().Header.Get("authorization"); authorization != "" {
+			headers["authorization"] = authorization
+		}
+		resp, err := upstream.RetryDo(func(u *upstream.Upstream) (*common.Response, error) {
+			return util.Get(u.Url+reqPath, headers, config.SysConfig.GetReqTimeOut())
+		})
+		if err == nil {
+			extractHeaders := resp.ExtractHeaders(resp.Headers)
+			if link, ok := extractHeaders["link"]; ok {
+				extractHeaders["link"] = relativeNextLink(link)
+			}
+			if resp.StatusCode == http.StatusOK && apiCachePath != "" {
+				if err = util.MakeDirs(apiCachePath); err != nil {
+					zap.S().Errorf("create %s dir err.%v", apiCachePath, err)
+				} else if err = m.fileDao.WriteCacheRequest(apiCachePath, resp.StatusCode, extractHeaders, resp.Body); err != nil {
+					zap.S().Errorf("writeCacheRequest err.%v", err)
+				}
+			}
+			return m.responseRewriteApi(c, repo, resp.StatusCode, extractHeaders, resp.Body, rewrite)
+		}
+		zap.S().Errorf("get %s err.%v", reqPath, err)
+	}
+	if apiCachePath != "" && util.FileExists(apiCachePath) {
+		cacheContent, err := m.fileDao.ReadCacheRequest(apiCachePath)
+		if err != nil {
+			zap.S().Errorf("ReadCacheRequest err.%v", err)
+			return util.ErrorProxyError(c)
+		}
+		return m.responseRewriteApi(c, repo, cacheContent.StatusCode, cacheContent.Headers, cacheContent.OriginContent, rewrite)
+	}
+	if synthesize != nil {
+		return synthesize()
+	}
+	return util.ErrorEntryNotFound(c)
+}
+
+func (m *MetaDao) responseRewriteApi(c echo.Context, repo string, statusCode int, headers map[string]string, body []byte, rewrite func([]byte) []byte) error {
+	if rewrite == nil || statusCode != http.StatusOK {
+		return m.responseApi(c, repo, statusCode, headers, body)
+	}
+	respHeaders := make(map[string]string, len(headers))
+	for k, v := range headers {
+		respHeaders[k] = v
+	}
+	// 改写后长度变化，不能使用上游的content-length
+	delete(respHeaders, "content-length")
+	return m.responseApi(c, repo, statusCode, respHeaders, rewrite(body))
+}
+
+func (m *MetaDao) responseApi(c echo.Context, repo string, statusCode int, headers map[string]string, body []byte) error {
+	respHeaders := make(map[string]string, len(headers))
+	for k, v := range headers {
+		respHeaders[k] = v
+	}
+	if link, ok := respHeaders["link"]; ok {
+		if next := absoluteNextLink(c, link); next != "" {
+			respHeaders["link"] = next
+		} else {
+			delete(respHeaders, "link")
+		}
+	}
+	var bodyStreamChan = make(chan []byte, consts.RespChanSize)
+	bodyStreamChan <- body
+	close(bodyStreamChan)
+	return util.ResponseStreamWithCode(c, statusCode, repo, respHeaders, bodyStreamChan)
+}
+
+// relativeNextLink 只保留下一页地址的路径和参数，缓存的内容与上游及本服务的域名无关
+func relativeNextLink(link string) string {
+	m := nextLinkRe.FindStringSubmatch(link)
+	if m == nil {
+		return ""
+	}
+	next, err := url.Parse(m[1])
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI())
+}
+
+// absoluteNextLink 将下一页地址补全为本服务的地址，huggingface_hub直接请求Link中的地址
+func absoluteNextLink(c echo.Context, link string) string {
+	m := nextLinkRe.FindStringSubmatch(link)
+	if m == nil {
+		return ""
+	}
+	return fmt.Sprintf(`<%s>; rel="next"`, util.ExternalUrl(c, m[1]))
+}
+
+// apiCacheName 带参数的请求按参数分别缓存
+func apiCacheName(name, query string) string {
+	if query == "" {
+		return fmt.Sprintf("%s_%s.json", name, consts.RequestTypeGet)
+	}
+	return fmt.Sprintf("%s_%s_%s.json", name, consts.RequestTypeGet, util.Md5(query))
+}
+
+func withQuery(reqPath, query string) string {
+	if query == "" {
+		return reqPath
+	}
+	return reqPath + "?" + query
+}
+
+// RepoInfoGenerator /api/<type>/<repo>，离线时返回已缓存的版本信息，main优先
+func (m *MetaDao) RepoInfoGenerator(c echo.Context, repoType, org, repo string) error {
+	orgRepo := util.GetOrgRepo(org, repo)
+	query := c.QueryParams().Encode()
+	reqPath := withQuery(fmt.Sprintf("/api/%s/%s", repoType, orgRepo), query)
+	apiCachePath := fmt.Sprintf("%s/api/%s/%s/%s", config.SysConfig.Repos(), repoType, orgRepo, apiCacheName("meta", query))
+	return m.proxyApiGenerator(c, repo, reqPath, apiCachePath, nil, func() error {
+		for _, revision := range m.cachedRevisions(repoType, orgRepo) {
+			cacheContent, err := m.fileDao.ReadCacheRequest(getMetaGetPath(repoType, orgRepo, revision))
+			if err != nil || cacheContent.StatusCode != http.StatusOK {
+				continue
+			}
+			return m.responseApi(c, repo, cacheContent.StatusCode, cacheContent.Headers, cacheContent.OriginContent)
+		}
+		return util.ErrorRepoNotFound(c)
+	})
+}
+
+type gitRefInfo struct {
+	Name         string `json:"name"`
+	Ref          string `json:"ref"`
+	TargetCommit string `json:"targetCommit"`
+}
+
+type gitRefs struct {
+	Branches []gitRefInfo `json:"branches"`
+	Converts []gitRefInfo `json:"converts"`
+	Tags     []gitRefInfo `json:"tags"`
+}
+
+// RefsGenerator /api/<type>/<repo>/refs，离线时由已缓存的版本合成：refs/convert/下的为转换分支，其余无法区分标签，均作为分支返回
+func (m *MetaDao) RefsGenerator(c echo.Context, repoType, org, repo string) error {
+	orgRepo := util.GetOrgRepo(org, repo)
+	query := c.QueryParams().Encode()
+	reqPath := withQuery(fmt.Sprintf("/api/%s/%s/refs", repoType, orgRepo), query)
+	apiCachePath := fmt.Sprintf("%s/api/%s/%s/refs/%s", config.SysConfig.Repos(), repoType, orgRepo, apiCacheName("refs", query))
+	return m.proxyApiGenerator(c, repo, reqPath, apiCachePath, nil, func() error {
+		revisions := m.cachedRevisions(repoType, orgRepo)
+		if len(revisions) == 0 {
+			return util.ErrorRepoNotFound(c)
+		}
+		refs := gitRefs{Branches: []gitRefInfo{}, Converts: []gitRefInfo{}, Tags: []gitRefInfo{}}
+		for _, revision := range revisions {
+			if commitShaRe.MatchString(revision) {
+				continue
+			}
+			info, err := m.readRevisionInfo(repoType, orgRepo, revision)
+			if err != nil || info.Sha == "" {
+				continue
+			}
+			if name, ok := strings.CutPrefix(revision, "refs/convert/"); ok {
+				refs.Converts = append(refs.Converts, gitRefInfo{Name: name, Ref: revision, TargetCommit: info.Sha})
+			} else {
+				refs.Branches = append(refs.Branches, gitRefInfo{Name: revision, Ref: "refs/heads/" + revision, TargetCommit: info.Sha})
+			}
+		}
+		return util.ResponseData(c, refs)
+	})
+}
+
+type gitCommitInfo struct {
+	Id      string   `json:"id"`
+	Title   string   `json:"title"`
+	Message string   `json:"message"`
+	Authors []string `json:"authors"`
+	Date    string   `json:"date"`
+}
+
+// CommitsGenerator /api/<type>/<repo>/commits/<revision>，离线时只返回该版本对应的commit
+func (m *MetaDao) CommitsGenerator(c echo.Context, repoType, org, repo, revision string) error {
+	orgRepo := util.GetOrgRepo(org, repo)
+	query := c.QueryParams().Encode()
+	reqPath := withQuery(fmt.Sprintf("/api/%s/%s/commits/%s", repoType, orgRepo, url.PathEscape(revision)), query)
+	apiCachePath := fmt.Sprintf("%s/api/%s/%s/commits/%s/%s", config.SysConfig.Repos(), repoType, orgRepo, url.PathEscape(revision), apiCacheName("commits", query))
+	return m.proxyApiGenerator(c, repo, reqPath, apiCachePath, nil, func() error {
+		info, err := m.readRevisionInfo(repoType, orgRepo, revision)
+		if err != nil || info.Sha == "" {
+			return util.ErrorRevisionNotFound(c, revision)
+		}
+		return util.ResponseData(c, []gitCommitInfo{{Id: info.Sha, Authors: []string{}, Date: info.LastModified}})
+	})
+}
+
+// RepoListGenerator /api/<type>，在线时直接代理，离线时列出已缓存的仓库，支持search、author及limit参数
+func (m *MetaDao) RepoListGenerator(c echo.Context, repoType string) error {
+	reqPath := withQuery(fmt.Sprintf("/api/%s", repoType), c.Request().URL.RawQuery)
+	return m.proxyApiGenerator(c, repoType, reqPath, "", nil, func() error {
+		return util.ResponseData(c, m.listCachedRepos(c, repoType))
+	})
+}
+
+func (m *MetaDao) listCachedRepos(c echo.Context, repoType string) []map[string]interface{} {
+	search := strings.ToLower(c.QueryParam("search"))
+	author := c.QueryParam("author")
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	typeDir := filepath.Join(config.SysConfig.Repos(), "api", repoType)
+	repoIds := make([]string, 0)
+	// 仓库目录为<org>/<repo>，没有org的仓库为<repo>
+	for _, pattern := range []string{"*/revision", "*/*/revision"} {
+		dirs, _ := filepath.Glob(filepath.Join(typeDir, pattern))
+		for _, dir := range dirs {
+			repoId, err := filepath.Rel(typeDir, filepath.Dir(dir))
+			if err != nil {
+				continue
+			}
+			repoIds = append(repoIds, filepath.ToSlash(repoId))
+		}
+	}
+	sort.Strings(repoIds)
+	ret := make([]map[string]interface{}, 0)
+	for _, repoId := range repoIds {
+		if search != "" && !strings.Contains(strings.ToLower(repoId), search) {
+			continue
+		}
+		if author != "" && !strings.HasPrefix(repoId, author+"/") {
+			continue
+		}
+		for _, revision := range m.cachedRevisions(repoType, repoId) {
+			cacheContent, err := m.fileDao.ReadCacheRequest(getMetaGetPath(repoType, repoId, revision))
+			if err != nil || cacheContent.StatusCode != http.StatusOK {
+				continue
+			}
+			item := make(map[string]interface{})
+			if err = sonic.Unmarshal(cacheContent.OriginContent, &item); err != nil {
+				continue
+			}
+			// 列表接口默认不返回文件列表
+			delete(item, "siblings")
+			item["id"] = repoId
+			ret = append(ret, item)
+			break
+		}
+		if limit > 0 && len(ret) >= limit {
+			break
+		}
+	}
+	return ret
+}
+
+type revisionInfo struct {
+	Sha          string `json:"sha"`
+	LastModified string `json:"lastModified"`
+}
+
+// readRevisionInfo 读取已缓存的版本信息，没有lastModified时以缓存时间代替
+func (m *MetaDao) readRevisionInfo(repoType, orgRepo, revision string) (*revisionInfo, error) {
+	metaPath := getMetaGetPath(repoType, orgRepo, revision)
+	cacheContent, err := m.fileDao.ReadCacheRequest(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	var info revisionInfo
+	if err = sonic.Unmarshal(cacheContent.OriginContent, &info); err != nil {
+		return nil, err
+	}
+	if info.LastModified == "" {
+		if stat, err := os.Stat(metaPath); err == nil {
+			info.LastModified = stat.ModTime().UTC().Format("2006-01-02T15:04:05.000Z")
+		}
+	}
+	return &info, nil
+}
+
+// cachedRevisions 已缓存版本信息的版本，main在前，其次为其他分支或标签，commit在最后
+func (m *MetaDao) cachedRevisions(repoType, orgRepo string) []string {
+	entries, err := os.ReadDir(fmt.Sprintf("%s/api/%s/%s/revision", config.SysConfig.Repos(), repoType, orgRepo))
+	if err != nil {
+		return nil
+	}
+	revisions := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		// 目录名为转义后的版本，如refs%2Fconvert%2Fparquet
+		revision, err := url.PathUnescape(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		if util.FileExists(getMetaGetPath(repoType, orgRepo, revision)) {
+			revisions = append(revisions, revision)
+		}
+	}
+	rank := func(revision string) int {
+		if revision == "main" {
+			return 0
+		} else if !commitShaRe.MatchString(revision) {
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return rank(revisions[i]) < rank(revisions[j])
+	})
+	return revisions
+}
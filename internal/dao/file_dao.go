@@ -17,6 +17,8 @@ package dao
 import (
 	"context"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -32,6 +34,7 @@ import (
 	"dingospeed/pkg/config"
 	"dingospeed/pkg/consts"
 	myerr "dingospeed/pkg/error"
+	"dingospeed/pkg/upstream"
 	"dingospeed/pkg/util"
 
 	"github.com/bytedance/sonic"
@@ -40,7 +43,12 @@ import (
 )
 
 type CommitHfSha struct {
-	Sha string `json:"sha"`
+	Sha      string    `json:"sha"`
+	Siblings []Sibling `json:"siblings"`
+}
+
+type Sibling struct {
+	Rfilename string `json:"rfilename"`
 }
 
 type FileDao struct {
@@ -50,26 +58,27 @@ func NewFileDao() *FileDao {
 	if config.SysConfig.Cache.Enabled {
 		cache.InitCache() // 初始化缓存
 	}
+	migrateRevisionDirs()
 	return &FileDao{}
 }
 
 func (f *FileDao) CheckCommitHf(repoType, org, repo, commit, authorization string) (int, error) {
 	orgRepo := util.GetOrgRepo(org, repo)
-	var reqUrl string
+	var reqPath string
 	if commit == "" {
-		reqUrl = fmt.Sprintf("%s/api/%s/%s", config.SysConfig.GetHFURLBase(), repoType, orgRepo)
+		reqPath = fmt.Sprintf("/api/%s/%s", repoType, orgRepo)
 	} else {
-		reqUrl = fmt.Sprintf("%s/api/%s/%s/revision/%s", config.SysConfig.GetHFURLBase(), repoType, orgRepo, commit)
+		reqPath = fmt.Sprintf("/api/%s/%s/revision/%s", repoType, orgRepo, url.PathEscape(commit))
 	}
 	headers := map[string]string{}
 	if authorization != "" {
 		headers["authorization"] = authorization
 	}
-	resp, err := util.RetryRequest(func() (*common.Response, error) {
-		return util.Head(reqUrl, headers, config.SysConfig.GetReqTimeOut())
+	resp, err := upstream.RetryDo(func(u *upstream.Upstream) (*common.Response, error) {
+		return util.Head(u.Url+reqPath, headers, config.SysConfig.GetReqTimeOut())
 	})
 	if err != nil {
-		zap.S().Errorf("call %s error.%v", reqUrl, err)
+		zap.S().Errorf("call %s error.%v", reqPath, err)
 		return http.StatusInternalServerError, err
 	}
 	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusTemporaryRedirect {
@@ -86,17 +95,16 @@ func (f *FileDao) GetCommitHf(repoType, org, repo, commit, authorization string)
 		return f.getCommitHfOffline(repoType, org, repo, commit)
 	}
 	orgRepo := util.GetOrgRepo(org, repo)
-	var reqUrl string
-	reqUrl = fmt.Sprintf("%s/api/%s/%s/revision/%s", config.SysConfig.GetHFURLBase(), repoType, orgRepo, commit)
+	reqPath := fmt.Sprintf("/api/%s/%s/revision/%s", repoType, orgRepo, url.PathEscape(commit))
 	headers := map[string]string{}
 	if authorization != "" {
 		headers["authorization"] = authorization
 	}
-	resp, err := util.RetryRequest(func() (*common.Response, error) {
-		return util.Get(reqUrl, headers, config.SysConfig.GetReqTimeOut())
+	resp, err := upstream.RetryDo(func(u *upstream.Upstream) (*common.Response, error) {
+		return util.Get(u.Url+reqPath, headers, config.SysConfig.GetReqTimeOut())
 	})
 	if err != nil {
-		zap.S().Errorf("call %s error.%v", reqUrl, err)
+		zap.S().Errorf("call %s error.%v", reqPath, err)
 		return f.getCommitHfOffline(repoType, org, repo, commit)
 	}
 	var sha CommitHfSha
@@ -109,7 +117,7 @@ func (f *FileDao) GetCommitHf(repoType, org, repo, commit, authorization string)
 
 func (f *FileDao) getCommitHfOffline(repoType, org, repo, commit string) (string, error) {
 	orgRepo := util.GetOrgRepo(org, repo)
-	apiPath := fmt.Sprintf("%s/api/%s/%s/revision/%s/meta_get.json", config.SysConfig.Repos(), repoType, orgRepo, commit)
+	apiPath := getMetaGetPath(repoType, orgRepo, commit)
 	if util.FileExists(apiPath) {
 		cacheContent, err := f.ReadCacheRequest(apiPath)
 		if err != nil {
@@ -134,24 +142,14 @@ func (f *FileDao) FileGetGenerator(c echo.Context, repoType, org, repo, commit,
 		zap.S().Errorf("create %s dir err.%v", filesPath, err)
 		return util.ErrorProxyError(c)
 	}
-	var hfUrl string
-	if repoType == "models" {
-		hfUrl = fmt.Sprintf("%s/%s/resolve/%s/%s", config.SysConfig.GetHFURLBase(), orgRepo, commit, fileName)
-	} else {
-		hfUrl = fmt.Sprintf("%s/%s/%s/resolve/%s/%s", config.SysConfig.GetHFURLBase(), repoType, orgRepo, commit, fileName)
-	}
+	hfPath := getHfPath(repoType, orgRepo, commit, fileName)
 	reqHeaders := map[string]string{}
-	for k, _ := range c.Request().Header {
-		if k == "host" {
-			domain, _ := util.GetDomain(hfUrl)
-			reqHeaders[strings.ToLower(k)] = domain
-		} else {
-			reqHeaders[strings.ToLower(k)] = c.Request().Header.Get(k)
-		}
+	for k := range c.Request().Header {
+		reqHeaders[strings.ToLower(k)] = c.Request().Header.Get(k)
 	}
 	authorization := reqHeaders["authorization"]
 	// _file_realtime_stream
-	pathsInfos, err := f.pathsInfoGenerator(repoType, org, repo, commit, authorization, []string{fileName}, "post")
+	pathsInfos, err := f.pathsInfoGenerator(repoType, org, repo, commit, authorization, []string{fileName}, consts.RequestTypePost)
 	if err != nil {
 		if e, ok := err.(myerr.Error); ok {
 			zap.S().Errorf("pathsInfoGenerator code:%d, err:%v", e.StatusCode(), err)
@@ -170,28 +168,26 @@ func (f *FileDao) FileGetGenerator(c echo.Context, repoType, org, repo, commit,
 	}
 	respHeaders := map[string]string{}
 	pathInfo := pathsInfos[0]
-	var startPos, endPos int64
-	if pathInfo.Size > 0 { // There exists a file of size 0
-		var headRange = reqHeaders["range"]
-		if headRange == "" {
-			headRange = fmt.Sprintf("bytes=%d-%d", 0, pathInfo.Size-1)
-		}
-		startPos, endPos = parseRangeParams(headRange, pathInfo.Size)
-		endPos = endPos + 1
-	} else if pathInfo.Size == 0 {
+	if pathInfo.Size == 0 { // There exists a file of size 0
 		zap.S().Warnf("file %s size: %d", fileName, pathInfo.Size)
 	}
-	respHeaders["content-length"] = util.Itoa(endPos - startPos)
-	if commit != "" {
-		respHeaders[strings.ToLower(consts.HUGGINGFACE_HEADER_X_REPO_COMMIT)] = commit
-	}
 	var etag string
 	if pathInfo.Lfs.Oid != "" {
 		etag = pathInfo.Lfs.Oid
 	} else {
 		etag = pathInfo.Oid
 	}
-	respHeaders["etag"] = etag
+	if commit != "" {
+		respHeaders[strings.ToLower(consts.HUGGINGFACE_HEADER_X_REPO_COMMIT)] = commit
+	}
+	respHeaders["etag"] = fmt.Sprintf("%q", etag)
+	// 与huggingface.co保持一致，lfs文件返回x-linked-size和x-linked-etag，hf_hub_download优先使用这两个头
+	if pathInfo.Lfs.Oid != "" {
+		respHeaders[consts.HUGGINGFACE_HEADER_X_LINKED_SIZE] = util.Itoa(pathInfo.Lfs.Size)
+		respHeaders[consts.HUGGINGFACE_HEADER_X_LINKED_ETAG] = fmt.Sprintf("%q", pathInfo.Lfs.Oid)
+	}
+	respHeaders["accept-ranges"] = "bytes"
+	respHeaders["content-type"] = util.GetContentType(fileName)
 	blobsDir := fmt.Sprintf("%s/files/%s/%s/blobs", config.SysConfig.Repos(), repoType, orgRepo)
 	blobsFile := fmt.Sprintf("%s/%s", blobsDir, etag)
 	err = util.MakeDirs(blobsFile)
@@ -199,22 +195,101 @@ func (f *FileDao) FileGetGenerator(c echo.Context, repoType, org, repo, commit,
 		zap.S().Errorf("create %s dir err.%v", blobsDir, err)
 		return util.ErrorProxyError(c)
 	}
+	// 已转换为普通文件的blob直接返回，Range等条件请求由http.ServeContent处理
+	if method == consts.RequestTypeGet {
+		if plainFile, ok := downloader.OpenPlainBlob(blobsFile, pathInfo.Size); ok {
+			defer plainFile.Close()
+			if err = util.CreateSymlinkIfNotExists(blobsFile, filesPath); err != nil {
+				zap.S().Errorf("filesPath:%s is not link", filesPath)
+			}
+			return util.ResponseFile(c, fmt.Sprintf("%s/%s", orgRepo, fileName), respHeaders, plainFile)
+		}
+	}
+	statusCode := http.StatusOK
+	startPos, endPos := int64(0), pathInfo.Size
+	var multipart *util.MultipartRanges
+	// If-Range与etag不一致时，说明客户端本地的内容已过期，忽略Range并返回完整文件
+	if headRange := reqHeaders["range"]; headRange != "" && util.IfRangeMatch(reqHeaders["if-range"], etag) {
+		ranges, err := util.ParseRange(headRange, pathInfo.Size)
+		if errors.Is(err, util.ErrRangeNotSatisfiable) {
+			zap.S().Warnf("range not satisfiable. file:%s, range:%s, size:%d", fileName, headRange, pathInfo.Size)
+			return util.ErrorRangeNotSatisfiable(c, pathInfo.Size)
+		} else if err != nil {
+			zap.S().Warnf("ignore invalid range. file:%s, range:%s", fileName, headRange)
+		} else if len(ranges) == 1 {
+			startPos, endPos = ranges[0].Start, ranges[0].End
+			statusCode = http.StatusPartialContent
+			respHeaders["content-range"] = ranges[0].ContentRange(pathInfo.Size)
+		} else if rangesTotalLength(ranges) <= pathInfo.Size {
+			// 多个区间以multipart/byteranges返回，区间总长度超过文件大小时（大量重叠）按完整文件返回
+			multipart = util.NewMultipartRanges(ranges, util.GetContentType(fileName), pathInfo.Size)
+			statusCode = http.StatusPartialContent
+			respHeaders["content-type"] = multipart.MediaType()
+		}
+	}
+	if multipart != nil {
+		respHeaders["content-length"] = util.Itoa(multipart.ContentLength())
+	} else {
+		respHeaders["content-length"] = util.Itoa(endPos - startPos)
+	}
 	if method == consts.RequestTypeHead {
-		return util.ResponseHeaders(c, respHeaders)
+		return util.ResponseHeadersWithCode(c, statusCode, respHeaders)
 	} else if method == consts.RequestTypeGet {
-		return f.FileChunkGet(c, hfUrl, blobsFile, filesPath, orgRepo, fileName, authorization, pathInfo.Size, startPos, endPos, respHeaders)
+		if multipart != nil {
+			return f.FileMultiRangeGet(c, hfPath, blobsFile, filesPath, orgRepo, fileName, authorization, pathInfo.Size, multipart, respHeaders)
+		}
+		return f.FileChunkGet(c, hfPath, blobsFile, filesPath, orgRepo, fileName, authorization, pathInfo.Size, startPos, endPos, statusCode, respHeaders)
 	} else {
 		return util.ErrorMethodError(c)
 	}
 }
 
+// getHfPath 只返回路径，下载时按上游的可用情况拼接地址
+func getHfPath(repoType, orgRepo, commit, fileName string) string {
+	if repoType == "models" {
+		return fmt.Sprintf("/%s/resolve/%s/%s", orgRepo, commit, fileName)
+	}
+	return fmt.Sprintf("/%s/%s/resolve/%s/%s", repoType, orgRepo, commit, fileName)
+}
+
 func (f *FileDao) pathsInfoGenerator(repoType, org, repo, commit, authorization string, paths []string, method string) ([]common.PathsInfo, error) {
+	items, err := f.pathsInfoRawGenerator(repoType, org, repo, commit, authorization, paths, method, false)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]common.PathsInfo, 0, len(items))
+	for _, item := range items {
+		var pathsInfo common.PathsInfo
+		if err = sonic.Unmarshal(item, &pathsInfo); err != nil {
+			zap.S().Errorf("pathsInfo Unmarshal err.%v", err)
+			continue
+		}
+		ret = append(ret, pathsInfo)
+	}
+	return ret, nil
+}
+
+// PathsInfoGenerator 供客户端调用的paths-info，返回上游的原始内容，expand时包含lastCommit等信息
+func (f *FileDao) PathsInfoGenerator(repoType, org, repo, commit, authorization string, paths []string, expand bool) ([]json.RawMessage, error) {
+	return f.pathsInfoRawGenerator(repoType, org, repo, commit, authorization, paths, consts.RequestTypePost, expand)
+}
+
+func getPathsInfoPath(repoType, orgRepo, commit, pathFileName, method string, expand bool) string {
+	apiDir := fmt.Sprintf("%s/api/%s/%s/paths-info/%s/%s", config.SysConfig.Repos(), repoType, orgRepo, commit, pathFileName)
+	if expand {
+		return fmt.Sprintf("%s/paths-info_%s_expand.json", apiDir, method)
+	}
+	return fmt.Sprintf("%s/paths-info_%s.json", apiDir, method)
+}
+
+// pathsInfoRawGenerator 每个文件的结果单独缓存，只将未缓存的文件合并为一次请求发送到上游。
+// 上游不可用且为离线模式时，只返回已缓存的文件。
+func (f *FileDao) pathsInfoRawGenerator(repoType, org, repo, commit, authorization string, paths []string, method string, expand bool) ([]json.RawMessage, error) {
 	orgRepo := util.GetOrgRepo(org, repo)
 	remoteReqFilePathMap := make(map[string]string, 0)
-	ret := make([]common.PathsInfo, 0)
+	ret := make([]json.RawMessage, 0)
 	for _, pathFileName := range paths {
-		apiDir := fmt.Sprintf("%s/api/%s/%s/paths-info/%s/%s", config.SysConfig.Repos(), repoType, orgRepo, commit, pathFileName)
-		apiPathInfoPath := fmt.Sprintf("%s/%s", apiDir, fmt.Sprintf("paths-info_%s.json", method))
+		apiPathInfoPath := getPathsInfoPath(repoType, orgRepo, commit, pathFileName, method, expand)
 		hitCache := util.FileExists(apiPathInfoPath)
 		if hitCache {
 			cacheContent, err := f.ReadCacheRequest(apiPathInfoPath)
@@ -222,16 +297,18 @@ func (f *FileDao) pathsInfoGenerator(repoType, org, repo, commit, authorization
 				zap.S().Errorf("ReadCacheRequest err.%v", err)
 				continue
 			}
-			pathsInfos := make([]common.PathsInfo, 0)
+			pathsInfos := make([]json.RawMessage, 0)
 			err = sonic.Unmarshal(cacheContent.OriginContent, &pathsInfos)
 			if err != nil {
 				zap.S().Errorf("pathsInfo Unmarshal err.%v", err)
 				continue
 			}
 			if cacheContent.StatusCode == http.StatusOK {
-				ret = append(ret, pathsInfos...)
+				for _, item := range pathsInfos {
+					ret = append(ret, trimEmptyLfs(item))
+				}
 			}
-		} else {
+		} else if _, ok := remoteReqFilePathMap[pathFileName]; !ok {
 			remoteReqFilePathMap[pathFileName] = apiPathInfoPath
 		}
 	}
@@ -240,10 +317,14 @@ func (f *FileDao) pathsInfoGenerator(repoType, org, repo, commit, authorization
 		for k := range remoteReqFilePathMap {
 			filePaths = append(filePaths, k)
 		}
-		pathsInfoUrl := fmt.Sprintf("%s/api/%s/%s/paths-info/%s", config.SysConfig.GetHFURLBase(), repoType, orgRepo, commit)
-		response, err := f.pathsInfoProxy(pathsInfoUrl, authorization, filePaths)
+		pathsInfoPath := fmt.Sprintf("/api/%s/%s/paths-info/%s", repoType, orgRepo, commit)
+		response, err := f.pathsInfoProxy(pathsInfoPath, authorization, filePaths, expand)
 		if err != nil {
-			zap.S().Errorf("req %s err.%v", pathsInfoUrl, err)
+			if !config.SysConfig.Online() {
+				zap.S().Warnf("req %s err, only cached paths are returned.%v", pathsInfoPath, err)
+				return ret, nil
+			}
+			zap.S().Errorf("req %s err.%v", pathsInfoPath, err)
 			return nil, myerr.NewAppendCode(http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		}
 		if response.StatusCode != http.StatusOK {
@@ -256,20 +337,25 @@ func (f *FileDao) pathsInfoGenerator(repoType, org, repo, commit, authorization
 			}
 			return nil, myerr.NewAppendCode(response.StatusCode, errorResp.Error)
 		}
-		remoteRespPathsInfos := make([]common.PathsInfo, 0)
+		remoteRespPathsInfos := make([]json.RawMessage, 0)
 		err = sonic.Unmarshal(response.Body, &remoteRespPathsInfos)
 		if err != nil {
-			zap.S().Errorf("req %s remoteRespPathsInfos Unmarshal err.%v", pathsInfoUrl, err)
+			zap.S().Errorf("req %s remoteRespPathsInfos Unmarshal err.%v", pathsInfoPath, err)
 			return nil, myerr.NewAppendCode(http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		}
 		for _, item := range remoteRespPathsInfos {
-			// 对单个文件pathsInfo做存储
-			if apiPath, ok := remoteReqFilePathMap[item.Path]; ok {
+			var pathsInfo common.PathsInfo
+			if err = sonic.Unmarshal(item, &pathsInfo); err != nil {
+				zap.S().Errorf("req %s pathsInfo Unmarshal err.%v", pathsInfoPath, err)
+				continue
+			}
+			// 对单个文件pathsInfo做存储，保留上游的原始内容
+			if apiPath, ok := remoteReqFilePathMap[pathsInfo.Path]; ok {
 				if err = util.MakeDirs(apiPath); err != nil {
 					zap.S().Errorf("create %s dir err.%v", apiPath, err)
 					continue
 				}
-				b, _ := sonic.Marshal([]common.PathsInfo{item}) // 转成单个文件的切片
+				b, _ := sonic.Marshal([]json.RawMessage{item}) // 转成单个文件的切片
 				if err = f.WriteCacheRequest(apiPath, response.StatusCode, response.ExtractHeaders(response.Headers), b); err != nil {
 					zap.S().Errorf("WriteCacheRequest err.%s,%v", apiPath, err)
 					continue
@@ -281,10 +367,36 @@ func (f *FileDao) pathsInfoGenerator(repoType, org, repo, commit, authorization
 	return ret, nil
 }
 
-func (f *FileDao) pathsInfoProxy(targetUrl, authorization string, filePaths []string) (*common.Response, error) {
+// trimEmptyLfs 早期的缓存由common.PathsInfo序列化，非lfs文件带有空的lfs字段，返回给客户端前移除，
+// 否则huggingface_hub会将其识别为lfs文件
+func trimEmptyLfs(item json.RawMessage) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := sonic.Unmarshal(item, &fields); err != nil {
+		return item
+	}
+	lfsField, ok := fields["lfs"]
+	if !ok {
+		return item
+	}
+	var lfs common.Lfs
+	if err := sonic.Unmarshal(lfsField, &lfs); err != nil || lfs.Oid != "" {
+		return item
+	}
+	delete(fields, "lfs")
+	b, err := sonic.Marshal(fields)
+	if err != nil {
+		return item
+	}
+	return b
+}
+
+func (f *FileDao) pathsInfoProxy(targetPath, authorization string, filePaths []string, expand bool) (*common.Response, error) {
 	data := map[string]interface{}{
 		"paths": filePaths,
 	}
+	if expand {
+		data["expand"] = true
+	}
 	jsonData, err := sonic.Marshal(data)
 	if err != nil {
 		return nil, err
@@ -293,12 +405,12 @@ func (f *FileDao) pathsInfoProxy(targetUrl, authorization string, filePaths []st
 	if authorization != "" {
 		headers["authorization"] = authorization
 	}
-	return util.RetryRequest(func() (*common.Response, error) {
-		return util.Post(targetUrl, "application/json", jsonData, headers)
+	return upstream.RetryDo(func(u *upstream.Upstream) (*common.Response, error) {
+		return util.Post(u.Url+targetPath, "application/json", jsonData, headers)
 	})
 }
 
-func (f *FileDao) FileChunkGet(c echo.Context, hfUrl, blobsFile, filesPath, orgRepo, fileName, authorization string, fileSize, startPos, endPos int64, respHeaders map[string]string) error {
+func (f *FileDao) FileChunkGet(c echo.Context, hfPath, blobsFile, filesPath, orgRepo, fileName, authorization string, fileSize, startPos, endPos int64, statusCode int, respHeaders map[string]string) error {
 	responseChan := make(chan []byte, config.SysConfig.Download.RespChanSize)
 	source := util.Itoa(c.Get(consts.PromSource))
 	bgCtx := context.WithValue(c.Request().Context(), consts.PromSource, source)
@@ -306,14 +418,31 @@ func (f *FileDao) FileChunkGet(c echo.Context, hfUrl, blobsFile, filesPath, orgR
 	defer func() {
 		cancel()
 	}()
-	go downloader.FileDownload(ctx, hfUrl, blobsFile, filesPath, orgRepo, fileName, authorization, fileSize, startPos, endPos, responseChan)
-	if err := util.ResponseStream(c, fmt.Sprintf("%s/%s", orgRepo, fileName), respHeaders, responseChan); err != nil {
+	go downloader.FileDownload(ctx, hfPath, blobsFile, filesPath, orgRepo, fileName, authorization, fileSize, startPos, endPos, responseChan)
+	if err := util.ResponseStreamWithCode(c, statusCode, fmt.Sprintf("%s/%s", orgRepo, fileName), respHeaders, responseChan); err != nil {
 		zap.S().Warnf("FileChunkGet stream err.%v", err)
 		return util.ErrorProxyTimeout(c)
 	}
 	return nil
 }
 
+// FileMultiRangeGet 多区间请求，各区间依次从缓存块或远端获取，以multipart/byteranges返回
+func (f *FileDao) FileMultiRangeGet(c echo.Context, hfPath, blobsFile, filesPath, orgRepo, fileName, authorization string, fileSize int64, multipart *util.MultipartRanges, respHeaders map[string]string) error {
+	responseChan := make(chan []byte, config.SysConfig.Download.RespChanSize)
+	source := util.Itoa(c.Get(consts.PromSource))
+	bgCtx := context.WithValue(c.Request().Context(), consts.PromSource, source)
+	ctx, cancel := context.WithCancel(bgCtx)
+	defer func() {
+		cancel()
+	}()
+	go downloader.FileRangesDownload(ctx, hfPath, blobsFile, filesPath, orgRepo, fileName, authorization, fileSize, multipart, responseChan)
+	if err := util.ResponseStreamWithCode(c, http.StatusPartialContent, fmt.Sprintf("%s/%s", orgRepo, fileName), respHeaders, responseChan); err != nil {
+		zap.S().Warnf("FileMultiRangeGet stream err.%v", err)
+		return util.ErrorProxyTimeout(c)
+	}
+	return nil
+}
+
 func (f *FileDao) WhoamiV2Generator(c echo.Context) error {
 	newHeaders := make(http.Header)
 	for k, vv := range c.Request().Header {
@@ -332,7 +461,7 @@ func (f *FileDao) WhoamiV2Generator(c echo.Context) error {
 	targetURL.Path = path.Join(targetURL.Path, "/api/whoami-v2")
 
 	// targetURL := "https://huggingface.co/api/whoami-v2"
-	zap.S().Debugf("exec WhoamiV2Generator:targetURL:%s,host:%s", targetURL.String(), config.SysConfig.GetHfNetLoc())
+	zap.S().Debugf("exec WhoamiV2Generator:targetURL:%s,host:%s", targetURL.String(), targetURL.Host)
 	// Creating a proxy request
 	req, err := http.NewRequest("GET", targetURL.String(), nil)
 	if err != nil {
@@ -341,7 +470,7 @@ func (f *FileDao) WhoamiV2Generator(c echo.Context) error {
 	}
 	req.Header = newHeaders
 	// req.Host = "huggingface.co"
-	req.Host = config.SysConfig.GetHfNetLoc()
+	req.Host = targetURL.Host
 
 	client := &http.Client{
 		Timeout: 10 * time.Second,
@@ -428,28 +557,10 @@ func (f *FileDao) ReposGenerator(c echo.Context) error {
 	})
 }
 
-func parseRangeParams(fileRange string, fileSize int64) (int64, int64) {
-	if strings.Contains(fileRange, "/") {
-		split := strings.SplitN(fileRange, "/", 2)
-		fileRange = split[0]
-	}
-	if strings.HasPrefix(fileRange, "bytes=") {
-		fileRange = fileRange[6:]
-	}
-	parts := strings.Split(fileRange, "-")
-	if len(parts) != 2 {
-		panic("file range err.")
-	}
-	var startPos, endPos int64
-	if len(parts[0]) != 0 {
-		startPos = util.Atoi64(parts[0])
-	} else {
-		startPos = 0
-	}
-	if len(parts[1]) != 0 {
-		endPos = util.Atoi64(parts[1])
-	} else {
-		endPos = fileSize - 1
+func rangesTotalLength(ranges []util.ByteRange) int64 {
+	var total int64
+	for _, r := range ranges {
+		total += r.Length()
 	}
-	return startPos, endPos
+	return total
 }
@@ -16,10 +16,16 @@ package dao
 
 import (
 	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"dingospeed/pkg/common"
 	"dingospeed/pkg/config"
 	"dingospeed/pkg/consts"
+	"dingospeed/pkg/upstream"
 	"dingospeed/pkg/util"
 
 	"github.com/labstack/echo/v4"
@@ -38,7 +44,7 @@ func NewMetaDao(fileDao *FileDao) *MetaDao {
 
 func (m *MetaDao) MetaGetGenerator(c echo.Context, repoType, org, repo, commit, method string, writeResp bool) error {
 	orgRepo := util.GetOrgRepo(org, repo)
-	apiDir := fmt.Sprintf("%s/api/%s/%s/revision/%s", config.SysConfig.Repos(), repoType, orgRepo, commit)
+	apiDir := fmt.Sprintf("%s/api/%s/%s/revision/%s", config.SysConfig.Repos(), repoType, orgRepo, url.PathEscape(commit))
 	apiMetaPath := fmt.Sprintf("%s/%s", apiDir, fmt.Sprintf("meta_%s.json", method))
 	err := util.MakeDirs(apiMetaPath)
 	if err != nil {
@@ -74,27 +80,27 @@ func (m *MetaDao) MetaCacheGenerator(c echo.Context, repo, apiMetaPath string) e
 
 func (m *MetaDao) MetaProxyGenerator(c echo.Context, repoType, org, repo, commit, method, authorization, apiMetaPath string, writeResp bool) error {
 	orgRepo := util.GetOrgRepo(org, repo)
-	metaUrl := fmt.Sprintf("%s/api/%s/%s/revision/%s", config.SysConfig.GetHFURLBase(), repoType, orgRepo, commit)
+	metaPath := fmt.Sprintf("/api/%s/%s/revision/%s", repoType, orgRepo, url.PathEscape(commit))
 	headers := map[string]string{}
 	if authorization != "" {
 		headers["authorization"] = authorization
 	}
 	if method == consts.RequestTypeHead {
-		resp, err := util.RetryRequest(func() (*common.Response, error) {
-			return util.Head(metaUrl, headers, config.SysConfig.GetReqTimeOut())
+		resp, err := upstream.RetryDo(func(u *upstream.Upstream) (*common.Response, error) {
+			return util.Head(u.Url+metaPath, headers, config.SysConfig.GetReqTimeOut())
 		})
 		if err != nil {
-			zap.S().Errorf("head %s err.%v", metaUrl, err)
+			zap.S().Errorf("head %s err.%v", metaPath, err)
 			return util.ErrorEntryNotFound(c)
 		}
 		extractHeaders := resp.ExtractHeaders(resp.Headers)
 		return util.ResponseHeaders(c, extractHeaders)
 	} else if method == consts.RequestTypeGet {
-		resp, err := util.RetryRequest(func() (*common.Response, error) {
-			return util.Get(metaUrl, headers, config.SysConfig.GetReqTimeOut())
+		resp, err := upstream.RetryDo(func(u *upstream.Upstream) (*common.Response, error) {
+			return util.Get(u.Url+metaPath, headers, config.SysConfig.GetReqTimeOut())
 		})
 		if err != nil {
-			zap.S().Errorf("get %s err.%v", metaUrl, err)
+			zap.S().Errorf("get %s err.%v", metaPath, err)
 			return util.ErrorEntryNotFound(c)
 		}
 		extractHeaders := resp.ExtractHeaders(resp.Headers)
@@ -113,3 +119,63 @@ func (m *MetaDao) MetaProxyGenerator(c echo.Context, repoType, org, repo, commit
 	}
 	return nil
 }
+
+// migrateRevisionDirs 旧版本按原始版本存放版本信息，带/的版本存放在多级目录中，如revision/refs/pr/1，
+// 启动时移动到转义后的目录revision/refs%2Fpr%2F1。转义后的目录已存在时保留较新的该目录，不再迁移
+func migrateRevisionDirs() {
+	// 仓库目录为<org>/<repo>，没有org的仓库为<repo>
+	for _, pattern := range []string{"*/*/revision", "*/*/*/revision"} {
+		revisionDirs, _ := filepath.Glob(filepath.Join(config.SysConfig.Repos(), "api", pattern))
+		for _, revisionDir := range revisionDirs {
+			migrateRevisionDir(revisionDir)
+		}
+	}
+}
+
+func migrateRevisionDir(revisionDir string) {
+	legacyDirs := make(map[string]struct{})
+	_ = filepath.WalkDir(revisionDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasPrefix(d.Name(), "meta_") {
+			return nil
+		}
+		if dir := filepath.Dir(p); filepath.Dir(dir) != revisionDir && dir != revisionDir {
+			legacyDirs[dir] = struct{}{}
+		}
+		return nil
+	})
+	for dir := range legacyDirs {
+		rev, err := filepath.Rel(revisionDir, dir)
+		if err != nil {
+			continue
+		}
+		dst := filepath.Join(revisionDir, url.PathEscape(filepath.ToSlash(rev)))
+		if util.FileExists(dst) {
+			zap.S().Warnf("revision dir %s exists, skip migrating %s", dst, dir)
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		if err = os.MkdirAll(dst, 0755); err != nil {
+			zap.S().Errorf("create %s dir err.%v", dst, err)
+			continue
+		}
+		// 只移动版本信息文件，目录中可能还有其他以该版本为前缀的版本，如refs/pr/1/x
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasPrefix(entry.Name(), "meta_") {
+				continue
+			}
+			if err = os.Rename(filepath.Join(dir, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+				zap.S().Errorf("migrate %s err.%v", filepath.Join(dir, entry.Name()), err)
+			}
+		}
+		// 删除迁移后为空的目录
+		for p := dir; p != revisionDir; p = filepath.Dir(p) {
+			if os.Remove(p) != nil {
+				break
+			}
+		}
+		zap.S().Infof("migrate revision dir %s to %s", dir, dst)
+	}
+}
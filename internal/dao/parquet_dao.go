@@ -0,0 +1,172 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package dao
+
+// 数据集的parquet接口：/api/datasets/<repo>/parquet列出各config及split的分片地址，
+// 分片地址重定向到refs/convert/parquet版本下的文件，由文件下载接口提供。
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"dingospeed/pkg/common"
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/upstream"
+	"dingospeed/pkg/util"
+
+	"github.com/bytedance/sonic"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// parquetRevision parquet分片所在的版本
+const parquetRevision = "refs/convert/parquet"
+
+func getParquetDir(orgRepo, parquetConfig, split string) string {
+	parquetDir := fmt.Sprintf("%s/api/datasets/%s/parquet", config.SysConfig.Repos(), orgRepo)
+	if parquetConfig != "" {
+		parquetDir = fmt.Sprintf("%s/%s/%s", parquetDir, url.PathEscape(parquetConfig), url.PathEscape(split))
+	}
+	return parquetDir
+}
+
+func getParquetReqPath(orgRepo, parquetConfig, split string) string {
+	reqPath := fmt.Sprintf("/api/datasets/%s/parquet", orgRepo)
+	if parquetConfig != "" {
+		reqPath = fmt.Sprintf("%s/%s/%s", reqPath, url.PathEscape(parquetConfig), url.PathEscape(split))
+	}
+	return reqPath
+}
+
+// ParquetGenerator 分片地址列表，parquetConfig为空时列出全部config及split。
+// 列表中的上游地址改写为本服务的地址，客户端下载分片时同样经过本服务。
+func (m *MetaDao) ParquetGenerator(c echo.Context, org, repo, parquetConfig, split string) error {
+	orgRepo := util.GetOrgRepo(org, repo)
+	query := c.QueryParams().Encode()
+	reqPath := withQuery(getParquetReqPath(orgRepo, parquetConfig, split), query)
+	apiCachePath := fmt.Sprintf("%s/%s", getParquetDir(orgRepo, parquetConfig, split), apiCacheName("parquet", query))
+	return m.proxyApiGenerator(c, repo, reqPath, apiCachePath, func(body []byte) []byte {
+		return mirrorDatasetUrls(c, body)
+	}, nil)
+}
+
+// ParquetShardGenerator 分片地址，重定向到refs/convert/parquet版本下的文件。在线时使用上游返回的地址并缓存，
+// 上游重定向到其他地址时按上游的状态码返回，没有重定向地址时返回502；离线或上游不可用且没有缓存时按<config>/<split>/<序号>.parquet的默认布局拼接
+func (m *MetaDao) ParquetShardGenerator(c echo.Context, org, repo, parquetConfig, split string, shard int) error {
+	orgRepo := util.GetOrgRepo(org, repo)
+	shardPath := fmt.Sprintf("%s/%d.parquet", getParquetReqPath(orgRepo, parquetConfig, split), shard)
+	apiCachePath := fmt.Sprintf("%s/%s", getParquetDir(orgRepo, parquetConfig, split), apiCacheName(fmt.Sprintf("shard_%d", shard), ""))
+	if config.SysConfig.Online() {
+		headers := map[string]string{}
+		if authorization := c.Request().Header.Get("authorization"); authorization != "" {
+			headers["authorization"] = authorization
+		}
+		resp, err := upstream.RetryDo(func(u *upstream.Upstream) (*common.Response, error) {
+			return util.HeadNoRedirect(u.Url+shardPath, headers, config.SysConfig.GetReqTimeOut())
+		})
+		if err == nil {
+			if resp.StatusCode >= http.StatusBadRequest {
+				zap.S().Errorf("head %s code:%d", shardPath, resp.StatusCode)
+				return util.ErrorEntryUnknown(c, resp.StatusCode, "parquet shard not found")
+			}
+			location := resp.ExtractHeaders(resp.Headers)["location"]
+			if resolvePath := datasetRequestURI(location); resolvePath != "" {
+				cacheHeaders := map[string]string{"location": resolvePath}
+				if err = util.MakeDirs(apiCachePath); err != nil {
+					zap.S().Errorf("create %s dir err.%v", apiCachePath, err)
+				} else if err = m.fileDao.WriteCacheRequest(apiCachePath, http.StatusFound, cacheHeaders, nil); err != nil {
+					zap.S().Errorf("writeCacheRequest err.%v", err)
+				}
+				return responseParquetShard(c, resolvePath)
+			}
+			// 上游可用时不猜测分片的文件名，重定向到其他地址时按上游的状态码返回，没有重定向地址时为上游异常
+			if resp.StatusCode < http.StatusMultipleChoices || location == "" {
+				zap.S().Errorf("head %s code:%d without location", shardPath, resp.StatusCode)
+				return util.ErrorEntryUnknown(c, http.StatusBadGateway, "parquet shard location not found")
+			}
+			zap.S().Warnf("head %s code:%d, location %q is not a dataset path", shardPath, resp.StatusCode, location)
+			return util.ResponseHeadersWithCode(c, resp.StatusCode, map[string]string{"location": location})
+		} else {
+			zap.S().Errorf("head %s err.%v", shardPath, err)
+		}
+	}
+	if util.FileExists(apiCachePath) {
+		cacheContent, err := m.fileDao.ReadCacheRequest(apiCachePath)
+		if err == nil && cacheContent.Headers["location"] != "" {
+			return responseParquetShard(c, cacheContent.Headers["location"])
+		}
+		zap.S().Errorf("ReadCacheRequest %s err.%v", apiCachePath, err)
+	}
+	fileName := fmt.Sprintf("%s/%s/%04d.parquet", url.PathEscape(parquetConfig), url.PathEscape(split), shard)
+	resolvePath := fmt.Sprintf("/datasets/%s/resolve/%s/%s", orgRepo, url.PathEscape(parquetRevision), fileName)
+	zap.S().Warnf("parquet shard %s is not cached, guess the default layout %s", shardPath, resolvePath)
+	return responseParquetShard(c, resolvePath)
+}
+
+func responseParquetShard(c echo.Context, resolvePath string) error {
+	return util.ResponseHeadersWithCode(c, http.StatusFound, map[string]string{
+		"location": util.ExternalUrl(c, resolvePath),
+	})
+}
+
+// datasetRequestURI 数据集接口或文件的地址只保留路径和参数，其余地址返回空
+func datasetRequestURI(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	requestURI := u.RequestURI()
+	if strings.HasPrefix(requestURI, "/api/datasets/") || strings.HasPrefix(requestURI, "/datasets/") {
+		return requestURI
+	}
+	return ""
+}
+
+// mirrorDatasetUrls 将响应中数据集接口及文件的绝对地址改写为本服务的地址，解析失败时原样返回
+func mirrorDatasetUrls(c echo.Context, body []byte) []byte {
+	var data interface{}
+	if err := sonic.Unmarshal(body, &data); err != nil {
+		zap.S().Warnf("unmarshal parquet content err.%v", err)
+		return body
+	}
+	var walk func(v interface{}) interface{}
+	walk = func(v interface{}) interface{} {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for k, item := range t {
+				t[k] = walk(item)
+			}
+		case []interface{}:
+			for i, item := range t {
+				t[i] = walk(item)
+			}
+		case string:
+			if strings.HasPrefix(t, "http://") || strings.HasPrefix(t, "https://") {
+				if requestURI := datasetRequestURI(t); requestURI != "" {
+					return util.ExternalUrl(c, requestURI)
+				}
+			}
+		}
+		return v
+	}
+	ret, err := sonic.Marshal(walk(data))
+	if err != nil {
+		zap.S().Warnf("marshal parquet content err.%v", err)
+		return body
+	}
+	return ret
+}
@@ -0,0 +1,189 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"dingospeed/internal/downloader"
+	"dingospeed/pkg/common"
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/consts"
+	myerr "dingospeed/pkg/error"
+	"dingospeed/pkg/upstream"
+	"dingospeed/pkg/util"
+
+	"github.com/bytedance/sonic"
+	"go.uber.org/zap"
+)
+
+// prefetchSource 预热下载在监控指标中的来源
+const prefetchSource = "prefetch"
+
+// GetRevisionInfo 获取指定版本的commit及文件列表，在线时从上游获取并更新meta缓存，离线或请求失败时读取缓存
+func (f *FileDao) GetRevisionInfo(repoType, org, repo, commit, authorization string) (*CommitHfSha, error) {
+	if config.SysConfig.Online() {
+		info, resp, err := f.FetchRevisionInfo(repoType, org, repo, commit, authorization)
+		if err == nil {
+			f.SaveRevisionInfo(repoType, org, repo, resp, commit, info.Sha)
+			return info, nil
+		}
+		var e myerr.Error
+		if errors.As(err, &e) && e.StatusCode() != 0 {
+			return nil, err
+		}
+	}
+	orgRepo := util.GetOrgRepo(org, repo)
+	apiMetaPath := getMetaGetPath(repoType, orgRepo, commit)
+	if !util.FileExists(apiMetaPath) {
+		return nil, myerr.NewAppendCode(http.StatusNotFound, fmt.Sprintf("revision %s of %s/%s is not cached", commit, repoType, orgRepo))
+	}
+	cacheContent, err := f.ReadCacheRequest(apiMetaPath)
+	if err != nil {
+		return nil, err
+	}
+	var info CommitHfSha
+	if err = sonic.Unmarshal(cacheContent.OriginContent, &info); err != nil {
+		return nil, myerr.Wrap("unmarshal revision info err", err)
+	}
+	return &info, nil
+}
+
+// FetchRevisionInfo 不论是否离线都从上游获取指定版本的信息，供离线节点同步上游的新版本。
+// 不更新meta缓存，由调用方在合适的时机通过SaveRevisionInfo写入返回的响应。
+func (f *FileDao) FetchRevisionInfo(repoType, org, repo, commit, authorization string) (*CommitHfSha, *common.Response, error) {
+	orgRepo := util.GetOrgRepo(org, repo)
+	metaPath := fmt.Sprintf("/api/%s/%s/revision/%s", repoType, orgRepo, url.PathEscape(commit))
+	headers := map[string]string{}
+	if authorization != "" {
+		headers["authorization"] = authorization
+	}
+	resp, err := upstream.RetryDo(func(u *upstream.Upstream) (*common.Response, error) {
+		return util.Get(u.Url+metaPath, headers, config.SysConfig.GetReqTimeOut())
+	})
+	if err != nil {
+		zap.S().Errorf("get %s err.%v", metaPath, err)
+		return nil, nil, myerr.Wrap(fmt.Sprintf("get %s err", metaPath), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, myerr.NewAppendCode(resp.StatusCode, fmt.Sprintf("get revision %s of %s/%s, response code %d", commit, repoType, orgRepo, resp.StatusCode))
+	}
+	var info CommitHfSha
+	if err = sonic.Unmarshal(resp.Body, &info); err != nil {
+		return nil, nil, myerr.Wrap("unmarshal revision info err", err)
+	}
+	if info.Sha == "" {
+		return nil, nil, myerr.NewAppendCode(http.StatusBadGateway, fmt.Sprintf("revision %s of %s/%s has no commit sha", commit, repoType, orgRepo))
+	}
+	return &info, resp, nil
+}
+
+// SaveRevisionInfo 将FetchRevisionInfo返回的响应写入revs中各版本的meta缓存，重复或为空的版本跳过
+func (f *FileDao) SaveRevisionInfo(repoType, org, repo string, resp *common.Response, revs ...string) {
+	orgRepo := util.GetOrgRepo(org, repo)
+	extractHeaders := resp.ExtractHeaders(resp.Headers)
+	saved := make(map[string]struct{}, len(revs))
+	for _, rev := range revs {
+		if _, ok := saved[rev]; ok || rev == "" {
+			continue
+		}
+		saved[rev] = struct{}{}
+		apiMetaPath := getMetaGetPath(repoType, orgRepo, rev)
+		if err := util.MakeDirs(apiMetaPath); err != nil {
+			zap.S().Errorf("create %s dir err.%v", apiMetaPath, err)
+			continue
+		}
+		if err := f.WriteCacheRequest(apiMetaPath, resp.StatusCode, extractHeaders, resp.Body); err != nil {
+			zap.S().Errorf("writeCacheRequest err.%v", err)
+		}
+	}
+}
+
+// CopyRevisionInfo 将已缓存的commit的meta写入revs中各版本的meta缓存，用于没有上游响应时（如服务重启后）切换版本
+func (f *FileDao) CopyRevisionInfo(repoType, org, repo, commit string, revs ...string) error {
+	orgRepo := util.GetOrgRepo(org, repo)
+	cacheContent, err := f.ReadCacheRequest(getMetaGetPath(repoType, orgRepo, commit))
+	if err != nil {
+		return err
+	}
+	for _, rev := range revs {
+		if rev == "" || rev == commit {
+			continue
+		}
+		apiMetaPath := getMetaGetPath(repoType, orgRepo, rev)
+		if err = util.MakeDirs(apiMetaPath); err != nil {
+			return err
+		}
+		if err = f.WriteCacheRequest(apiMetaPath, cacheContent.StatusCode, cacheContent.Headers, cacheContent.OriginContent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getMetaGetPath(repoType, orgRepo, commit string) string {
+	return fmt.Sprintf("%s/api/%s/%s/revision/%s/meta_%s.json", config.SysConfig.Repos(), repoType, orgRepo, url.PathEscape(commit), consts.RequestTypeGet)
+}
+
+// GetPathsInfos 获取文件的大小和oid，已缓存的直接读取
+func (f *FileDao) GetPathsInfos(repoType, org, repo, commit, authorization string, paths []string) ([]common.PathsInfo, error) {
+	return f.pathsInfoGenerator(repoType, org, repo, commit, authorization, paths, consts.RequestTypePost)
+}
+
+// FilePrefetch 在没有客户端的情况下下载整个文件到缓存，progress在每次获得数据后调用。已完整缓存的文件直接返回。
+func (f *FileDao) FilePrefetch(ctx context.Context, repoType, org, repo, commit, authorization string, pathInfo common.PathsInfo, progress func(n int64)) error {
+	orgRepo := util.GetOrgRepo(org, repo)
+	fileName := pathInfo.Path
+	etag := pathInfo.Oid
+	if pathInfo.Lfs.Oid != "" {
+		etag = pathInfo.Lfs.Oid
+	}
+	filesPath := fmt.Sprintf("%s/files/%s/%s/resolve/%s/%s", config.SysConfig.Repos(), repoType, orgRepo, commit, fileName)
+	blobsFile := fmt.Sprintf("%s/files/%s/%s/blobs/%s", config.SysConfig.Repos(), repoType, orgRepo, etag)
+	if err := util.MakeDirs(filesPath); err != nil {
+		return err
+	}
+	if err := util.MakeDirs(blobsFile); err != nil {
+		return err
+	}
+	if downloader.IsBlobCached(blobsFile, pathInfo.Size) {
+		// blob可能由其他版本缓存，当前版本的文件路径需要链接到该blob
+		if err := util.CreateSymlinkIfNotExists(blobsFile, filesPath); err != nil {
+			return err
+		}
+		progress(pathInfo.Size)
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, consts.PromSource, prefetchSource))
+	defer cancel()
+	responseChan := make(chan []byte, config.SysConfig.Download.RespChanSize)
+	go downloader.FileDownload(ctx, getHfPath(repoType, orgRepo, commit, fileName), blobsFile, filesPath, orgRepo, fileName, authorization, pathInfo.Size, 0, pathInfo.Size, responseChan)
+	var received int64
+	for b := range responseChan {
+		received += int64(len(b))
+		progress(int64(len(b)))
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if received != pathInfo.Size {
+		return myerr.New(fmt.Sprintf("file %s is incomplete, expected %d, received %d", fileName, pathInfo.Size, received))
+	}
+	return nil
+}
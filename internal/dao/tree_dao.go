@@ -0,0 +1,55 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package dao
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/util"
+
+	"github.com/labstack/echo/v4"
+)
+
+// treeQueryKeys 目录列表接口的参数，分页的每一页按参数分别缓存
+var treeQueryKeys = []string{"recursive", "expand", "limit", "cursor"}
+
+func treeQuery(c echo.Context) string {
+	query := url.Values{}
+	for _, key := range treeQueryKeys {
+		if v := c.QueryParam(key); v != "" {
+			query.Set(key, v)
+		}
+	}
+	return query.Encode()
+}
+
+func getTreePath(repoType, orgRepo, commit, filePath, query string) string {
+	return fmt.Sprintf("%s/api/%s/%s/tree/%s/tree_%s.json", config.SysConfig.Repos(), repoType, orgRepo, path.Join(commit, filePath), util.Md5(query))
+}
+
+// TreeGenerator 获取目录列表的一页，在线时请求上游并缓存，离线或请求失败时读取缓存。
+// 上游通过Link头分页，下一页的地址改写为本服务的地址，客户端翻页时同样经过本服务。
+func (m *MetaDao) TreeGenerator(c echo.Context, repoType, org, repo, commit, filePath string) error {
+	orgRepo := util.GetOrgRepo(org, repo)
+	query := treeQuery(c)
+	treePath := fmt.Sprintf("/api/%s/%s/tree/%s", repoType, orgRepo, path.Join(commit, filePath))
+	if query != "" {
+		treePath = treePath + "?" + query
+	}
+	return m.proxyApiGenerator(c, repo, treePath, getTreePath(repoType, orgRepo, commit, filePath, query), nil, nil)
+}
@@ -0,0 +1,200 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package downloader
+
+// 远端下载的并发控制：
+// 1. 开启adaptive时，每个文件的并发分段数按聚合吞吐爬山调整，每完成一轮分段比较一次吞吐，
+//    吞吐明显提升时沿原方向继续调整，否则反向调整，范围为[1, goroutineMaxNumPerFile]；
+// 2. 开启adaptive时，每个上游的分段大小按其吞吐调整，使单个分段约adaptiveRangeDuration完成；
+// 3. 所有文件同时进行的分段下载数不超过globalRemoteConcurrency。分段因等待客户端读取而阻塞时释放占用的并发，
+//    之后重新占用，避免与等待其他请求数据块的任务互相等待，也不会超过上限。
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/prom"
+	"dingospeed/pkg/upstream"
+
+	"go.uber.org/zap"
+)
+
+const (
+	initialConcurrency    = 2
+	adaptiveRangeDuration = 10 * time.Second
+	adaptiveMinSample     = 1 << 20 // 读取的数据量小于该值时不统计吞吐
+	throughputAlpha       = 0.3     // 吞吐的指数加权平均系数
+	maxRemoteRangeSize    = 1 << 30
+)
+
+type concurrencyController struct {
+	mu         sync.Mutex
+	limit      int // 当前允许的并发分段数
+	max        int
+	running    int
+	step       int
+	epochBytes int64
+	epochDone  int
+	epochStart time.Time
+	lastRate   float64
+	notify     chan struct{}
+}
+
+func newConcurrencyController(taskLen int) *concurrencyController {
+	maxLimit := min(config.SysConfig.Download.GoroutineMaxNumPerFile, taskLen)
+	limit := maxLimit
+	if config.SysConfig.Download.Adaptive {
+		limit = min(initialConcurrency, maxLimit)
+	}
+	return &concurrencyController{
+		limit:      limit,
+		max:        maxLimit,
+		step:       1,
+		epochStart: time.Now(),
+		notify:     make(chan struct{}, 1),
+	}
+}
+
+func (c *concurrencyController) acquire(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		if c.running < c.limit {
+			c.running++
+			c.mu.Unlock()
+			return nil
+		}
+		c.mu.Unlock()
+		select {
+		case <-c.notify:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release 分段结束时调用，每完成limit个分段调整一次并发数
+func (c *concurrencyController) release(bytes int64) {
+	c.mu.Lock()
+	c.running--
+	if config.SysConfig.Download.Adaptive {
+		c.epochBytes += bytes
+		c.epochDone++
+		if c.epochDone >= c.limit {
+			c.adjust()
+		}
+	}
+	c.mu.Unlock()
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// adjust 调用方需持有c.mu
+func (c *concurrencyController) adjust() {
+	rate := float64(c.epochBytes) / max(time.Since(c.epochStart).Seconds(), 0.001)
+	if c.lastRate != 0 && rate <= c.lastRate*1.1 {
+		c.step = -c.step
+	}
+	limit := min(max(c.limit+c.step, 1), c.max)
+	if limit != c.limit {
+		zap.S().Debugf("adjust concurrency %d -> %d, rate:%.0f, last rate:%.0f", c.limit, limit, rate, c.lastRate)
+		c.limit = limit
+	}
+	c.lastRate = rate
+	c.epochBytes, c.epochDone, c.epochStart = 0, 0, time.Now()
+}
+
+var (
+	remoteSlots     chan struct{}
+	remoteSlotsOnce sync.Once
+)
+
+// remoteSlot 分段下载任务占用的全局并发，同一时刻只由一个协程使用
+type remoteSlot struct {
+	held bool
+}
+
+// acquire 等待并占用全局并发，未配置上限或已占用时直接返回
+func (s *remoteSlot) acquire(ctx context.Context) error {
+	if s == nil || s.held || config.SysConfig.Download.GlobalRemoteConcurrency <= 0 {
+		return nil
+	}
+	remoteSlotsOnce.Do(func() {
+		remoteSlots = make(chan struct{}, config.SysConfig.Download.GlobalRemoteConcurrency)
+	})
+	select {
+	case remoteSlots <- struct{}{}:
+		s.held = true
+		if config.SysConfig.EnableMetric() {
+			prom.RemoteRangeRunning.Inc()
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *remoteSlot) release() {
+	if s == nil || !s.held {
+		return
+	}
+	<-remoteSlots
+	s.held = false
+	if config.SysConfig.EnableMetric() {
+		prom.RemoteRangeRunning.Dec()
+	}
+}
+
+var (
+	throughputLock sync.Mutex
+	throughputs    = make(map[string]float64) // 上游的吞吐，单位字节/秒
+)
+
+// observeThroughput 记录一次从上游读取数据的吞吐，包括中途失败或被取消的请求
+func observeThroughput(u *upstream.Upstream, bytes int64, elapsed time.Duration) {
+	if bytes < adaptiveMinSample || elapsed <= 0 {
+		return
+	}
+	rate := float64(bytes) / elapsed.Seconds()
+	throughputLock.Lock()
+	if last, ok := throughputs[u.Host]; ok {
+		rate = throughputAlpha*rate + (1-throughputAlpha)*last
+	}
+	throughputs[u.Host] = rate
+	throughputLock.Unlock()
+	if config.SysConfig.EnableMetric() {
+		prom.UpstreamThroughput.WithLabelValues(u.Host).Set(rate)
+	}
+}
+
+// getRangeSize 返回分段大小，开启adaptive时按优先使用的上游的吞吐计算，为blockSize的整数倍
+func getRangeSize(upstreamNo int, blockSize int64) int64 {
+	rangeSize := config.SysConfig.Download.RemoteFileRangeSize
+	all := upstream.List()
+	if !config.SysConfig.Download.Adaptive || len(all) == 0 {
+		return rangeSize
+	}
+	throughputLock.Lock()
+	rate, ok := throughputs[all[upstreamNo%len(all)].Host]
+	throughputLock.Unlock()
+	if !ok {
+		return rangeSize
+	}
+	size := int64(rate*adaptiveRangeDuration.Seconds()) / blockSize * blockSize
+	return min(max(size, blockSize), maxRemoteRangeSize)
+}
@@ -0,0 +1,260 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/upstream"
+)
+
+// resetThroughputs 清空上游吞吐的记录，测试结束后恢复
+func resetThroughputs(t *testing.T) {
+	throughputLock.Lock()
+	saved := throughputs
+	throughputs = make(map[string]float64)
+	throughputLock.Unlock()
+	t.Cleanup(func() {
+		throughputLock.Lock()
+		throughputs = saved
+		throughputLock.Unlock()
+	})
+}
+
+func setAdaptive(t *testing.T, adaptive bool) {
+	saved := config.SysConfig.Download.Adaptive
+	config.SysConfig.Download.Adaptive = adaptive
+	t.Cleanup(func() {
+		config.SysConfig.Download.Adaptive = saved
+	})
+}
+
+func acquireTimeout(acquire func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	return acquire(ctx)
+}
+
+// 并发分段数从initialConcurrency开始，吞吐提升时继续增加，吞吐未明显提升时反向调整，范围为[1, max]
+func TestConcurrencyController(t *testing.T) {
+	maxNum := config.SysConfig.Download.GoroutineMaxNumPerFile
+	config.SysConfig.Download.GoroutineMaxNumPerFile = 4
+	t.Cleanup(func() {
+		config.SysConfig.Download.GoroutineMaxNumPerFile = maxNum
+	})
+
+	setAdaptive(t, false)
+	if c := newConcurrencyController(10); c.limit != 4 {
+		t.Fatalf("limit = %d without adaptive, want 4", c.limit)
+	}
+	if c := newConcurrencyController(3); c.limit != 3 || c.max != 3 {
+		t.Fatalf("limit = %d, max = %d for 3 tasks, want 3", c.limit, c.max)
+	}
+
+	setAdaptive(t, true)
+	c := newConcurrencyController(10)
+	if c.limit != initialConcurrency || c.max != 4 {
+		t.Fatalf("limit = %d, max = %d, want %d and 4", c.limit, c.max, initialConcurrency)
+	}
+	for i := 0; i < c.limit; i++ {
+		if err := c.acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := acquireTimeout(c.acquire); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire over the limit err = %v", err)
+	}
+
+	// 一轮完成limit个分段后调整，首轮沿增加方向调整
+	c.epochStart = time.Now().Add(-time.Second)
+	c.release(10 << 20)
+	c.release(10 << 20)
+	if c.limit != 3 || c.running != 0 {
+		t.Fatalf("limit = %d, running = %d after the first epoch, want 3 and 0", c.limit, c.running)
+	}
+	epoch := func(bytes int64) {
+		c.epochStart = time.Now().Add(-time.Second)
+		c.epochBytes, c.epochDone = bytes, c.limit-1
+		c.running++
+		c.release(0)
+	}
+	// 吞吐提升时继续增加，不超过max
+	epoch(40 << 20)
+	epoch(80 << 20)
+	if c.limit != 4 {
+		t.Fatalf("limit = %d after throughput grows, want 4", c.limit)
+	}
+	// 吞吐未明显提升时反向调整
+	epoch(80 << 20)
+	if c.limit != 3 {
+		t.Fatalf("limit = %d after throughput stops growing, want 3", c.limit)
+	}
+	// 减少并发后吞吐提升时继续减少，不小于1
+	for _, bytes := range []int64{100 << 20, 120 << 20, 140 << 20} {
+		epoch(bytes)
+	}
+	if c.limit != 1 {
+		t.Fatalf("limit = %d after throughput grows with less concurrency, want 1", c.limit)
+	}
+	if err := c.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := acquireTimeout(c.acquire); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire over the limit err = %v", err)
+	}
+}
+
+// 分段大小按优先上游的吞吐计算，使单个分段约adaptiveRangeDuration完成，为blockSize的整数倍
+func TestGetRangeSize(t *testing.T) {
+	rangeSize := config.SysConfig.Download.RemoteFileRangeSize
+	config.SysConfig.Download.RemoteFileRangeSize = 8 * testBlockSize
+	t.Cleanup(func() {
+		config.SysConfig.Download.RemoteFileRangeSize = rangeSize
+	})
+	resetThroughputs(t)
+	all := upstream.List()
+
+	setAdaptive(t, false)
+	observeThroughput(all[0], 4<<20, time.Second)
+	if got := getRangeSize(0, testBlockSize); got != 8*testBlockSize {
+		t.Fatalf("range size = %d without adaptive, want %d", got, 8*testBlockSize)
+	}
+
+	setAdaptive(t, true)
+	// 没有吞吐记录的上游使用配置的分段大小
+	if got := getRangeSize(1, testBlockSize); got != 8*testBlockSize {
+		t.Fatalf("range size = %d without throughput, want %d", got, 8*testBlockSize)
+	}
+	want := int64(4<<20*adaptiveRangeDuration.Seconds()) / testBlockSize * testBlockSize
+	if got := getRangeSize(0, testBlockSize); got != want {
+		t.Fatalf("range size = %d, want %d", got, want)
+	}
+	// 按upstreamNo轮换优先上游
+	if got := getRangeSize(len(all), testBlockSize); got != want {
+		t.Fatalf("range size = %d for the rotated upstream, want %d", got, want)
+	}
+	// 数据量过小的采样不统计
+	observeThroughput(all[1], adaptiveMinSample-1, time.Hour)
+	if got := getRangeSize(1, testBlockSize); got != 8*testBlockSize {
+		t.Fatalf("range size = %d after a small sample, want %d", got, 8*testBlockSize)
+	}
+	// 吞吐很低时不小于blockSize，很高时不超过maxRemoteRangeSize
+	observeThroughput(all[1], adaptiveMinSample, time.Hour)
+	if got := getRangeSize(1, testBlockSize); got != testBlockSize {
+		t.Fatalf("range size = %d for a slow upstream, want %d", got, testBlockSize)
+	}
+	throughputLock.Lock()
+	throughputs[all[1].Host] = 1 << 40
+	throughputLock.Unlock()
+	if got := getRangeSize(1, testBlockSize); got != maxRemoteRangeSize {
+		t.Fatalf("range size = %d for a fast upstream, want %d", got, maxRemoteRangeSize)
+	}
+}
+
+// 等待客户端读取的时间不计入上游的吞吐
+func TestThroughputExcludesSlowClient(t *testing.T) {
+	resetThroughputs(t)
+	hfPath := "/test/repo/resolve/main/throughput"
+	content := testContent(adaptiveMinSample)
+	hub.addWithDelay(hfPath, content, 0)
+
+	task := RemoteFileTask{}
+	task.Context = context.Background()
+	task.hfPath = hfPath
+	task.FileName = "throughput"
+	contentChan := make(chan []byte)
+	rr := &remoteRange{task: task, startPos: 0, endPos: int64(len(content)), contentChan: contentChan}
+	var got bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for chunk := range contentChan {
+			got.Write(chunk)
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	start := time.Now()
+	rr.run()
+	close(contentChan)
+	<-done
+	cost := time.Since(start)
+
+	if !bytes.Equal(got.Bytes(), content) {
+		t.Fatalf("got %d bytes, want %d", got.Len(), len(content))
+	}
+	throughputLock.Lock()
+	rate, ok := throughputs[upstream.List()[0].Host]
+	throughputLock.Unlock()
+	// 客户端读取限制的速率约为len(content)/cost，上游自身的吞吐应远高于此
+	if clientRate := float64(len(content)) / cost.Seconds(); !ok || rate < 10*clientRate {
+		t.Fatalf("upstream throughput = %.0f, client rate = %.0f", rate, clientRate)
+	}
+}
+
+// 所有文件同时进行的分段下载数不超过globalRemoteConcurrency，释放后等待者继续，重复占用或释放不改变计数
+func TestRemoteSlotCap(t *testing.T) {
+	concurrency := config.SysConfig.Download.GlobalRemoteConcurrency
+	config.SysConfig.Download.GlobalRemoteConcurrency = 2
+	remoteSlots, remoteSlotsOnce = nil, sync.Once{}
+	t.Cleanup(func() {
+		config.SysConfig.Download.GlobalRemoteConcurrency = concurrency
+		remoteSlots, remoteSlotsOnce = nil, sync.Once{}
+	})
+
+	slots := []*remoteSlot{{}, {}, {}}
+	for _, s := range slots[:2] {
+		if err := s.acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 已占用时再次占用不增加计数
+	if err := slots[0].acquire(context.Background()); err != nil || len(remoteSlots) != 2 {
+		t.Fatalf("acquire a held slot err = %v, running = %d", err, len(remoteSlots))
+	}
+	if err := acquireTimeout(slots[2].acquire); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire over the cap err = %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- slots[2].acquire(context.Background())
+	}()
+	slots[0].release()
+	slots[0].release()
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+	if len(remoteSlots) != 2 || slots[0].held || !slots[2].held {
+		t.Fatalf("running = %d after release, want 2", len(remoteSlots))
+	}
+	slots[1].release()
+	slots[2].release()
+	if len(remoteSlots) != 0 {
+		t.Fatalf("running = %d after all released, want 0", len(remoteSlots))
+	}
+
+	// 未配置上限时不限制
+	config.SysConfig.Download.GlobalRemoteConcurrency = 0
+	unlimited := &remoteSlot{}
+	if err := unlimited.acquire(context.Background()); err != nil || unlimited.held {
+		t.Fatalf("acquire without cap err = %v, held = %v", err, unlimited.held)
+	}
+}
@@ -0,0 +1,105 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package downloader
+
+// 从上游读取数据的带宽限制：每次读取后按读取的数据量等待令牌，先按上游限速，再按全局限速。
+// 同一次文件下载的所有分段属于同一个流，多个下载同时受限时平均分享带宽。
+// 配置了时间段时，定期按当前时间更新全局上限。
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/prom"
+	"dingospeed/pkg/ratelimit"
+	"dingospeed/pkg/upstream"
+
+	"go.uber.org/zap"
+)
+
+const (
+	bandwidthScheduleInterval = 30 * time.Second
+	globalLimiterLabel        = "global"
+)
+
+var (
+	globalBandwidth   *ratelimit.FairLimiter
+	upstreamBandwidth map[string]*ratelimit.FairLimiter
+	bandwidthOnce     sync.Once
+	flowSeq           atomic.Int64
+)
+
+func nextFlowId() int64 {
+	return flowSeq.Add(1)
+}
+
+func initBandwidth() {
+	globalBandwidth = ratelimit.NewFairLimiter(config.SysConfig.GetBandwidthLimit(time.Now()))
+	setBandwidthLimitMetric(globalLimiterLabel, globalBandwidth.Rate())
+	upstreamBandwidth = make(map[string]*ratelimit.FairLimiter, len(config.SysConfig.Bandwidth.Upstreams))
+	for host, limit := range config.SysConfig.Bandwidth.Upstreams {
+		upstreamBandwidth[host] = ratelimit.NewFairLimiter(limit)
+		setBandwidthLimitMetric(host, limit)
+	}
+	if len(config.SysConfig.Bandwidth.Schedule) > 0 {
+		go scheduleBandwidth()
+	}
+}
+
+func scheduleBandwidth() {
+	ticker := time.NewTicker(bandwidthScheduleInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		limit := config.SysConfig.GetBandwidthLimit(time.Now())
+		if limit == globalBandwidth.Rate() {
+			continue
+		}
+		zap.S().Infof("global bandwidth limit changed from %d to %d", globalBandwidth.Rate(), limit)
+		globalBandwidth.SetRate(limit)
+		setBandwidthLimitMetric(globalLimiterLabel, limit)
+	}
+}
+
+// waitBandwidth 从上游u读取n字节后等待令牌，返回等待的时间
+func waitBandwidth(ctx context.Context, u *upstream.Upstream, flow int64, n int) (time.Duration, error) {
+	bandwidthOnce.Do(initBandwidth)
+	var total time.Duration
+	if l, ok := upstreamBandwidth[u.Host]; ok {
+		d, err := l.Wait(ctx, flow, n)
+		countThrottled(u.Host, d)
+		total += d
+		if err != nil {
+			return total, err
+		}
+	}
+	d, err := globalBandwidth.Wait(ctx, flow, n)
+	countThrottled(globalLimiterLabel, d)
+	return total + d, err
+}
+
+func countThrottled(limiter string, d time.Duration) {
+	if d > 0 && config.SysConfig.EnableMetric() {
+		prom.BandwidthThrottledSeconds.WithLabelValues(limiter).Add(d.Seconds())
+	}
+}
+
+func setBandwidthLimitMetric(limiter string, limit int64) {
+	if config.SysConfig.EnableMetric() {
+		prom.BandwidthLimit.WithLabelValues(limiter).Set(float64(limit))
+	}
+}
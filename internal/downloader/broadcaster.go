@@ -16,124 +16,73 @@ package downloader
 
 import (
 	"context"
-	"fmt"
 	"sync"
 )
 
+// Broadcaster 正在从远端下载的数据块，下载方按顺序追加数据，等待该块的请求在数据到达时即可读取，
+// 不依赖下载方客户端的读取速度，也不需要等待整个数据块写入缓存
 type Broadcaster struct {
-	once      sync.Once
-	ctx       context.Context
-	msgChan   chan bool
-	listeners []chan bool
-	mu        sync.RWMutex
-	cancel    context.CancelFunc
+	mu     sync.Mutex
+	data   []byte        // 从数据块起始位置开始已到达的数据
+	notify chan struct{} // 有新数据或下载结束时关闭，并替换为新的通道
+	closed bool
+	done   bool // 数据块已完整写入缓存
 }
 
-// 每个下载请求需要注册广播实例
-
-func NewBroadcaster(ctx context.Context) *Broadcaster {
-	ctx, cancel := context.WithCancel(ctx)
-	b := &Broadcaster{
-		msgChan:   make(chan bool, 1),
-		listeners: make([]chan bool, 0),
-		ctx:       ctx,
-		cancel:    cancel,
-	}
-	return b
-}
-
-func (b *Broadcaster) AddListener() chan bool {
-	b.once.Do(func() {
-		go func() {
-			for {
-				select {
-				case state, ok := <-b.msgChan:
-					if !ok {
-						return
-					}
-					b.mu.RLock()
-					// 复制监听器列表以避免并发修改问题
-					listenersCopy := make([]chan bool, len(b.listeners))
-					copy(listenersCopy, b.listeners)
-					b.mu.RUnlock()
-					for _, listener := range listenersCopy {
-						select {
-						case listener <- state:
-						case <-b.ctx.Done():
-							return
-						}
-					}
-				case <-b.ctx.Done():
-					return
-				}
-			}
-		}()
-	})
-	listener := make(chan bool)
-	b.mu.Lock()
-	b.listeners = append(b.listeners, listener)
-	b.mu.Unlock()
-	return listener
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{notify: make(chan struct{})}
 }
 
-func (b *Broadcaster) SendMsg(msg bool) {
-	b.mu.RLock()
-	if len(b.listeners) == 0 {
+// Write 追加数据块的数据并通知所有等待者
+func (b *Broadcaster) Write(chunk []byte) {
+	if len(chunk) == 0 {
 		return
 	}
-	b.mu.RUnlock()
-	select {
-	case b.msgChan <- msg:
-	case <-b.ctx.Done():
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
 	}
+	b.data = append(b.data, chunk...)
+	close(b.notify)
+	b.notify = make(chan struct{})
 }
 
-func (b *Broadcaster) Close() {
-	close(b.msgChan)
-	b.cancel()
-	b.mu.RLock()
-	for _, listener := range b.listeners {
-		close(listener)
+// Close 数据块下载结束，done表示是否已完整写入缓存
+func (b *Broadcaster) Close(done bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
 	}
-	b.mu.RUnlock()
+	b.closed = true
+	b.done = done
+	// 下载结束后不再保留数据，等待者从缓存读取或重新获取该块
+	b.data = nil
+	close(b.notify)
 }
 
-func worker(ctx context.Context, listener chan bool, id int) {
+// Read 返回offset之后已到达的数据，没有新数据时等待。下载结束且没有更多数据时finished为true，
+// done表示该块是否已完整写入缓存；ctx取消时返回finished为true，done为false
+func (b *Broadcaster) Read(ctx context.Context, offset int64) (chunk []byte, finished, done bool) {
 	for {
+		b.mu.Lock()
+		if offset < int64(len(b.data)) {
+			chunk = b.data[offset:]
+			b.mu.Unlock()
+			return chunk, false, false
+		}
+		if b.closed {
+			done = b.done
+			b.mu.Unlock()
+			return nil, true, done
+		}
+		notify := b.notify
+		b.mu.Unlock()
 		select {
-		case newState := <-listener:
-			fmt.Printf("Worker %d: Received new state %v\n", id, newState)
-		// default:
-		//	fmt.Printf("Worker %d: Waiting for state change...\n", id)
-		//	time.Sleep(500 * time.Millisecond)
+		case <-notify:
 		case <-ctx.Done():
-			return
+			return nil, true, false
 		}
 	}
 }
-
-//
-// func main() {
-// 	// ctx, cancel := context.WithCancel(context.Background())
-// 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-//
-// 	b := NewBroadcaster(ctx)
-// 	var wg sync.WaitGroup
-//
-// 	for i := 0; i < 3; i++ {
-// 		wg.Add(1)
-// 		listener := b.addListener()
-// 		go func(i int) {
-// 			defer wg.Done()
-// 			worker(ctx, listener, i)
-// 		}(i)
-// 	}
-// 	time.Sleep(1 * time.Second)
-// 	b.sendMsg(false)
-// 	b.sendMsg(true)
-// 	time.Sleep(1 * time.Second)
-// 	fmt.Println("执行取消")
-// 	cancel()
-// 	time.Sleep(2 * time.Second)
-// 	wg.Wait()
-// }
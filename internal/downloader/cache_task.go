@@ -16,7 +16,9 @@ package downloader
 
 import (
 	"context"
+	"errors"
 
+	"dingospeed/pkg/config"
 	"dingospeed/pkg/util"
 
 	"go.uber.org/zap"
@@ -34,6 +36,99 @@ type DownloadTask struct {
 	blobsFile     string
 	filesPath     string
 	orgRepo       string
+	authorization string
+	hfPath        string
+	flowId        int64 // 同一次文件下载的任务共享带宽限制中的流
+}
+
+func (d DownloadTask) send(chunk []byte) bool {
+	select {
+	case d.ResponseChan <- chunk:
+		return true
+	case <-d.Context.Done():
+		return false
+	}
+}
+
+// outBlock 输出单个数据块内[startPos, endPos)的数据：已缓存的从缓存读取；正在被其他请求下载的，在数据到达时输出；
+// 都不是时将该块登记为下载中并从远端获取整个数据块，其他请求同样在数据到达时读取。返回是否完整输出
+func (d DownloadTask) outBlock(startPos, endPos int64) bool {
+	blockIndex, blockStartPos, blockEndPos := getBlockInfo(startPos, d.DingFile.getBlockSize(), d.DingFile.GetFileSize())
+	for startPos < endPos {
+		if d.Context.Err() != nil {
+			return false
+		}
+		d.DingFile.inflightLock.Lock()
+		hasBlock, err := d.DingFile.HasBlock(blockIndex)
+		b := d.DingFile.getInflightBlock(blockIndex)
+		owner := false
+		if err == nil && !hasBlock && b == nil && config.SysConfig.Online() {
+			b, owner = d.DingFile.registerInflightBlock(blockIndex), true
+		}
+		d.DingFile.inflightLock.Unlock()
+		if err != nil {
+			zap.S().Errorf("HasBlock err. file:%s, block:%d, %v", d.FileName, blockIndex, err)
+			return false
+		}
+		if hasBlock {
+			rawBlock, err := d.DingFile.ReadBlock(blockIndex)
+			if errors.Is(err, ErrBlockCorrupted) {
+				// 校验失败的块已被标记为不存在，重新获取
+				zap.S().Warnf("block corrupted, fetch from remote. file:%s, block:%d", d.FileName, blockIndex)
+				continue
+			}
+			if err != nil || int64(len(rawBlock)) < endPos-blockStartPos {
+				zap.S().Errorf("ReadBlock err file:%s, block:%d, len:%d, %v", d.FileName, blockIndex, len(rawBlock), err)
+				return false
+			}
+			return d.send(rawBlock[startPos-blockStartPos : endPos-blockStartPos])
+		}
+		if b == nil {
+			zap.S().Errorf("block not exist and offline, file:%s, block:%d", d.FileName, blockIndex)
+			return false
+		}
+		var fetched chan struct{}
+		if owner {
+			fetched = make(chan struct{})
+			go func() {
+				defer close(fetched)
+				d.fetchBlock(blockIndex, blockStartPos, blockEndPos, b)
+			}()
+		}
+		written := false
+		for startPos < endPos {
+			chunk, finished, done := b.Read(d.Context, startPos-blockStartPos)
+			if finished {
+				written = done
+				break
+			}
+			chunk = chunk[:min(int64(len(chunk)), endPos-startPos)]
+			if !d.send(chunk) {
+				break
+			}
+			startPos += int64(len(chunk))
+		}
+		if owner {
+			// 等待下载结束，文件在此之后才可能被释放
+			<-fetched
+		}
+		if startPos < endPos && owner && !written {
+			zap.S().Errorf("fetch block from remote failed, file:%s, block:%d", d.FileName, blockIndex)
+			return false
+		}
+		// 数据块已写入缓存时剩余的数据从缓存读取；下载方失败时重新判断，该块可能已被其他请求写入或需要由当前请求下载
+	}
+	return true
+}
+
+// fetchBlock 从远端下载整个数据块并写入缓存，数据通过b提供给等待该块的请求
+func (d DownloadTask) fetchBlock(blockIndex, blockStartPos, blockEndPos int64, b *Broadcaster) {
+	remote := NewRemoteFileTask(d.TaskNo, blockStartPos, blockEndPos)
+	remote.DownloadTask = d
+	remote.RangeStartPos = blockStartPos
+	remote.RangeEndPos = blockEndPos
+	remote.inflightBlocks = map[int64]*Broadcaster{blockIndex: b}
+	remote.DoTask()
 }
 
 type CacheFileTask struct {
@@ -66,11 +161,19 @@ func (c CacheFileTask) OutResult() {
 			zap.S().Errorf("HasBlock err. file:%s, curBlock:%d, curPos:%d, %v", c.FileName, curBlock, curPos, err)
 			continue
 		}
-		if !hasBlockBool {
-			zap.S().Errorf("block not exist. file:%s, curBlock:%d,curPos:%d", c.FileName, curBlock, curPos)
-			break
+		var rawBlock []byte
+		if hasBlockBool {
+			rawBlock, err = c.DingFile.ReadBlock(curBlock)
+		}
+		if !hasBlockBool || errors.Is(err, ErrBlockCorrupted) {
+			// 数据块校验失败或已被清除，与其他请求合并从远端获取
+			ePos := min(c.RangeEndPos, blockEndPos)
+			if !c.outBlock(curPos, ePos) {
+				break
+			}
+			curPos = ePos
+			continue
 		}
-		rawBlock, err := c.DingFile.ReadBlock(curBlock)
 		if err != nil {
 			zap.S().Errorf("ReadBlock err file:%s, %v", c.FileName, err)
 			continue
@@ -0,0 +1,374 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package downloader
+
+// 缓存文件的离线工具，供dingospeed cache子命令使用，不依赖服务配置，需在服务停止时执行。
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// BlobVerifyStatusCorrupted 存在CRC32C校验失败的数据块
+	BlobVerifyStatusCorrupted = "corrupted"
+
+	convertingSuffix = ".converting"
+)
+
+// BlockRange 连续的数据块区间，Start包含，End不包含
+type BlockRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// CacheFileInfo 缓存文件的头部及缓存进度信息
+type CacheFileInfo struct {
+	Path          string       `json:"path"`
+	Version       int64        `json:"version"`
+	BlockSize     int64        `json:"blockSize"`
+	FileSize      int64        `json:"fileSize"`
+	HeaderSize    int64        `json:"headerSize"`
+	DiskSize      int64        `json:"diskSize"`
+	BlockNumber   int64        `json:"blockNumber"`
+	CachedBlocks  int64        `json:"cachedBlocks"`
+	HasChecksum   bool         `json:"hasChecksum"`
+	MissingRanges []BlockRange `json:"missingRanges"`
+}
+
+// Percent 已缓存数据块的百分比
+func (i *CacheFileInfo) Percent() float64 {
+	if i.BlockNumber == 0 {
+		return 100
+	}
+	return float64(i.CachedBlocks) * 100 / float64(i.BlockNumber)
+}
+
+func (i *CacheFileInfo) Complete() bool {
+	return i.CachedBlocks == i.BlockNumber
+}
+
+// CacheVerifyResult 离线校验结果，包括数据块校验和及整个文件的oid校验
+type CacheVerifyResult struct {
+	Path string `json:"path"`
+	BlobVerifyInfo
+	CorruptedBlocks []int64 `json:"corruptedBlocks,omitempty"`
+}
+
+// IsCacheFile 判断文件是否为缓存文件
+func IsCacheFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return hasCacheMagic(f)
+}
+
+// hasCacheMagic 文件是否以缓存文件的魔数开头
+func hasCacheMagic(f *os.File) bool {
+	magic := make([]byte, len(magicNumber))
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, magicNumber[:])
+}
+
+func openCacheFile(path string) (*os.File, *DingCacheHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := &DingCacheHeader{}
+	if err = header.Read(f); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, header, nil
+}
+
+// InspectCacheFile 读取缓存文件的头部信息，统计已缓存及缺失的数据块
+func InspectCacheFile(path string) (*CacheFileInfo, error) {
+	f, header, err := openCacheFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info := &CacheFileInfo{
+		Path:          path,
+		Version:       header.Version,
+		BlockSize:     header.BlockSize,
+		FileSize:      header.FileSize,
+		HeaderSize:    header.GetHeaderSize(),
+		BlockNumber:   header.BlockNumber,
+		HasChecksum:   header.HasChecksum(),
+		MissingRanges: make([]BlockRange, 0),
+	}
+	if stat, err := f.Stat(); err == nil {
+		info.DiskSize = stat.Size()
+	}
+	for i := int64(0); i < header.BlockNumber; i++ {
+		if ok, _ := header.BlockMask.Test(i); ok {
+			info.CachedBlocks++
+			continue
+		}
+		if n := len(info.MissingRanges); n > 0 && info.MissingRanges[n-1].End == i {
+			info.MissingRanges[n-1].End = i + 1
+		} else {
+			info.MissingRanges = append(info.MissingRanges, BlockRange{Start: i, End: i + 1})
+		}
+	}
+	return info, nil
+}
+
+// readCacheBlocks 依次读取已缓存的数据块，valid表示该块是否通过了校验和校验
+func readCacheBlocks(f *os.File, header *DingCacheHeader, fn func(blockIndex int64, block []byte, valid bool) error) error {
+	buf := make([]byte, header.BlockSize)
+	headerSize := header.GetHeaderSize()
+	for i := int64(0); i < header.BlockNumber; i++ {
+		if ok, _ := header.BlockMask.Test(i); !ok {
+			continue
+		}
+		block := buf[:min(header.BlockSize, header.FileSize-i*header.BlockSize)]
+		if _, err := f.ReadAt(block, headerSize+i*header.BlockSize); err != nil {
+			return err
+		}
+		valid := !header.HasChecksum() || crc32.Checksum(block, crc32cTable) == header.BlockChecksums[i]
+		if err := fn(i, block, valid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyCacheFile 校验已缓存数据块的CRC32C，缓存完整时再校验整个文件与oid是否一致，oid为空时使用文件名
+func VerifyCacheFile(path, oid string) (*CacheVerifyResult, error) {
+	f, header, err := openCacheFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if oid == "" {
+		oid = filepath.Base(path)
+	}
+	result := &CacheVerifyResult{Path: path, BlobVerifyInfo: BlobVerifyInfo{Oid: oid, Size: header.FileSize}}
+	h, prefix, algorithm := newOidHash(oid)
+	result.Algorithm = algorithm
+	var cachedBlocks int64
+	if h != nil {
+		h.Write(prefix(header.FileSize))
+	}
+	err = readCacheBlocks(f, header, func(blockIndex int64, block []byte, valid bool) error {
+		if !valid {
+			result.CorruptedBlocks = append(result.CorruptedBlocks, blockIndex)
+		}
+		// 数据块按顺序读取，只有缓存完整时摘要才有意义
+		if h != nil && cachedBlocks == blockIndex {
+			h.Write(block)
+		}
+		cachedBlocks++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(result.CorruptedBlocks) > 0:
+		result.Status = BlobVerifyStatusCorrupted
+	case cachedBlocks != header.BlockNumber:
+		result.Status = BlobVerifyStatusIncomplete
+	case h == nil:
+		result.Status = BlobVerifyStatusSkipped
+	default:
+		result.Actual = hex.EncodeToString(h.Sum(nil))
+		if result.Actual == oid {
+			result.Status = BlobVerifyStatusVerified
+			result.Actual = ""
+		} else {
+			result.Status = BlobVerifyStatusMismatch
+		}
+	}
+	return result, nil
+}
+
+// ExtractCacheFile 将缓存完整的文件导出为不带头部的普通文件。导出时校验数据块校验和，
+// 文件名为oid时同时校验整个文件，任一校验失败都会删除导出的文件。
+func ExtractCacheFile(path, outPath string) (err error) {
+	f, header, err := openCacheFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(outPath)
+		}
+	}()
+	oid := filepath.Base(path)
+	h, prefix, _ := newOidHash(oid)
+	if h != nil {
+		h.Write(prefix(header.FileSize))
+	}
+	var cachedBlocks int64
+	err = readCacheBlocks(f, header, func(blockIndex int64, block []byte, valid bool) error {
+		if blockIndex != cachedBlocks {
+			return fmt.Errorf("block %d is not cached", cachedBlocks)
+		}
+		if !valid {
+			return fmt.Errorf("block %d: %w", blockIndex, ErrBlockCorrupted)
+		}
+		if h != nil {
+			h.Write(block)
+		}
+		cachedBlocks++
+		_, err := out.Write(block)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if cachedBlocks != header.BlockNumber {
+		return fmt.Errorf("block %d is not cached", cachedBlocks)
+	}
+	if h != nil {
+		if actual := hex.EncodeToString(h.Sum(nil)); actual != oid {
+			return fmt.Errorf("content digest %s does not match oid %s", actual, oid)
+		}
+	}
+	return out.Sync()
+}
+
+// ConvertCacheFile 将缓存文件转换为指定的版本和块大小。只升级版本时原地迁移，
+// 否则通过临时文件重写，需要与原文件相同的磁盘空间。已缓存的数据按新的块大小重新划分，
+// 新数据块对应的原数据不完整或校验失败时，该块视为未缓存。返回是否发生了转换。
+func ConvertCacheFile(path string, version, blockSize int64) (bool, error) {
+	f, old, err := openCacheFile(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	if blockSize <= 0 {
+		blockSize = old.BlockSize
+	}
+	if version == old.Version && blockSize == old.BlockSize {
+		return false, nil
+	}
+	if version == CURRENT_OLAH_CACHE_VERSION && blockSize == old.BlockSize {
+		return MigrateCacheFile(path)
+	}
+	header := NewDingCacheHeader(version, blockSize, old.FileSize)
+	if err = header.ValidHeader(); err != nil {
+		return false, err
+	}
+	// 先找出原文件中有效的数据块，新数据块覆盖的原数据块都有效时才复制
+	valid := NewBitset(old.BlockNumber)
+	err = readCacheBlocks(f, old, func(blockIndex int64, _ []byte, ok bool) error {
+		if ok {
+			return valid.Set(blockIndex)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	tmpPath := path + convertingSuffix
+	out, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmpPath)
+	defer out.Close()
+	headerSize := header.GetHeaderSize()
+	if err = out.Truncate(headerSize + header.FileSize); err != nil {
+		return false, err
+	}
+	buf := make([]byte, blockSize)
+	for i := int64(0); i < header.BlockNumber; i++ {
+		start := i * blockSize
+		end := min(start+blockSize, header.FileSize)
+		covered := true
+		for b := start / old.BlockSize; b <= (end-1)/old.BlockSize; b++ {
+			if ok, _ := valid.Test(b); !ok {
+				covered = false
+				break
+			}
+		}
+		if !covered {
+			continue
+		}
+		block := buf[:end-start]
+		if _, err = f.ReadAt(block, old.GetHeaderSize()+start); err != nil {
+			return false, err
+		}
+		if _, err = out.WriteAt(block, headerSize+start); err != nil {
+			return false, err
+		}
+		if header.HasChecksum() {
+			header.BlockChecksums[i] = crc32.Checksum(block, crc32cTable)
+		}
+		if err = header.BlockMask.Set(i); err != nil {
+			return false, err
+		}
+	}
+	if _, err = out.Seek(0, 0); err != nil {
+		return false, err
+	}
+	if err = header.Write(out); err != nil {
+		return false, err
+	}
+	if err = out.Sync(); err != nil {
+		return false, err
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WalkCacheFiles 遍历路径下的所有缓存文件，path为文件时直接返回该文件，跳过符号链接及非缓存文件
+func WalkCacheFiles(path string, fn func(path string) error) error {
+	stat, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		if !IsCacheFile(path) {
+			return errors.New("file is not a Olah cache file")
+		}
+		return fn(path)
+	}
+	return filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(p, convertingSuffix) || !IsCacheFile(p) {
+			return nil
+		}
+		return fn(p)
+	})
+}
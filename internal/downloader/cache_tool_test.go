@@ -0,0 +1,202 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package downloader
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTestCacheFile 生成缓存文件，cached返回true的数据块写入数据并登记，corrupt中的数据块写入后再修改一个字节
+func writeTestCacheFile(t *testing.T, path string, version, blockSize int64, data []byte, cached func(i int64) bool, corrupt ...int64) {
+	header := NewDingCacheHeader(version, blockSize, int64(len(data)))
+	raw := make([]byte, len(data))
+	for i := int64(0); i < header.BlockNumber; i++ {
+		if !cached(i) {
+			continue
+		}
+		start, end := i*blockSize, min((i+1)*blockSize, int64(len(data)))
+		copy(raw[start:end], data[start:end])
+		if header.HasChecksum() {
+			header.BlockChecksums[i] = crc32.Checksum(data[start:end], crc32cTable)
+		}
+		if err := header.BlockMask.Set(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, i := range corrupt {
+		raw[i*blockSize] ^= 0xff
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err = header.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Write(raw); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func allBlocks(int64) bool { return true }
+
+func TestConvertCacheFile(t *testing.T) {
+	data := testContent(10*1024 + 100)
+	for _, tc := range []struct {
+		name         string
+		version      int64
+		blockSize    int64
+		cached       func(i int64) bool
+		newBlockSize int64
+	}{
+		{"smaller block size", CURRENT_OLAH_CACHE_VERSION, 1024, func(i int64) bool { return i%3 != 1 }, 512},
+		{"larger block size", CURRENT_OLAH_CACHE_VERSION, 512, func(i int64) bool { return i != 5 && i < 18 }, 2048},
+		{"v8 to current", OLAH_CACHE_VERSION_NO_CHECKSUM, 1024, func(i int64) bool { return i%2 == 0 }, 1024},
+		{"v8 to current with larger block size", OLAH_CACHE_VERSION_NO_CHECKSUM, 1024, allBlocks, 4096},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "blob")
+			writeTestCacheFile(t, path, tc.version, tc.blockSize, data, tc.cached)
+			converted, err := ConvertCacheFile(path, CURRENT_OLAH_CACHE_VERSION, tc.newBlockSize)
+			if err != nil || !converted {
+				t.Fatalf("ConvertCacheFile() = %v, %v", converted, err)
+			}
+			f, header, err := openCacheFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if header.Version != CURRENT_OLAH_CACHE_VERSION || header.BlockSize != tc.newBlockSize || header.FileSize != int64(len(data)) {
+				t.Fatalf("header version=%d blockSize=%d fileSize=%d", header.Version, header.BlockSize, header.FileSize)
+			}
+			// 新数据块覆盖的原数据块都已缓存时，新数据块才是已缓存的
+			var want, got []int64
+			for i := int64(0); i < header.BlockNumber; i++ {
+				start, end := i*tc.newBlockSize, min((i+1)*tc.newBlockSize, int64(len(data)))
+				covered := true
+				for b := start / tc.blockSize; b <= (end-1)/tc.blockSize; b++ {
+					covered = covered && tc.cached(b)
+				}
+				if covered {
+					want = append(want, i)
+				}
+			}
+			err = readCacheBlocks(f, header, func(blockIndex int64, block []byte, valid bool) error {
+				start := blockIndex * tc.newBlockSize
+				if !valid || !bytes.Equal(block, data[start:start+int64(len(block))]) {
+					t.Errorf("block %d valid=%v, data mismatch", blockIndex, valid)
+				}
+				got = append(got, blockIndex)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("cached blocks = %v, want %v", got, want)
+			}
+			if converted, err = ConvertCacheFile(path, CURRENT_OLAH_CACHE_VERSION, tc.newBlockSize); err != nil || converted {
+				t.Fatalf("second ConvertCacheFile() = %v, %v", converted, err)
+			}
+		})
+	}
+}
+
+func TestExtractCacheFile(t *testing.T) {
+	data := testContent(5*1024 + 10)
+	sum := sha256.Sum256(data)
+	oid := hex.EncodeToString(sum[:])
+	otherSum := sha256.Sum256([]byte("other"))
+	for _, tc := range []struct {
+		name    string
+		file    string
+		cached  func(i int64) bool
+		corrupt []int64
+		wantErr string
+	}{
+		{"complete", oid, allBlocks, nil, ""},
+		{"not oid", "blob", allBlocks, nil, ""},
+		{"missing block", oid, func(i int64) bool { return i != 3 }, nil, "block 3 is not cached"},
+		{"corrupted block", oid, allBlocks, []int64{2}, "block 2: " + ErrBlockCorrupted.Error()},
+		{"oid mismatch", hex.EncodeToString(otherSum[:]), allBlocks, nil, "does not match oid"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path, outPath := filepath.Join(dir, tc.file), filepath.Join(dir, "out")
+			writeTestCacheFile(t, path, CURRENT_OLAH_CACHE_VERSION, 1024, data, tc.cached, tc.corrupt...)
+			err := ExtractCacheFile(path, outPath)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if out, _ := os.ReadFile(outPath); !bytes.Equal(out, data) {
+					t.Fatalf("extracted %d bytes, want %d", len(out), len(data))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("ExtractCacheFile() err = %v, want %v", err, tc.wantErr)
+			}
+			if _, statErr := os.Stat(outPath); !os.IsNotExist(statErr) {
+				t.Fatalf("output is not removed after failure: %v", statErr)
+			}
+		})
+	}
+}
+
+func TestVerifyCacheFile(t *testing.T) {
+	data := testContent(5*1024 + 10)
+	sum := sha256.Sum256(data)
+	oid := hex.EncodeToString(sum[:])
+	otherSum := sha256.Sum256([]byte("other"))
+	for _, tc := range []struct {
+		name      string
+		file      string
+		version   int64
+		cached    func(i int64) bool
+		corrupt   []int64
+		status    string
+		corrupted []int64
+	}{
+		{"verified", oid, CURRENT_OLAH_CACHE_VERSION, allBlocks, nil, BlobVerifyStatusVerified, nil},
+		{"v8 verified", oid, OLAH_CACHE_VERSION_NO_CHECKSUM, allBlocks, nil, BlobVerifyStatusVerified, nil},
+		{"mismatch", hex.EncodeToString(otherSum[:]), CURRENT_OLAH_CACHE_VERSION, allBlocks, nil, BlobVerifyStatusMismatch, nil},
+		{"incomplete", oid, CURRENT_OLAH_CACHE_VERSION, func(i int64) bool { return i != 4 }, nil, BlobVerifyStatusIncomplete, nil},
+		{"corrupted", oid, CURRENT_OLAH_CACHE_VERSION, allBlocks, []int64{1, 3}, BlobVerifyStatusCorrupted, []int64{1, 3}},
+		{"corrupted and incomplete", oid, CURRENT_OLAH_CACHE_VERSION, func(i int64) bool { return i != 4 }, []int64{0}, BlobVerifyStatusCorrupted, []int64{0}},
+		{"skipped", "blob", CURRENT_OLAH_CACHE_VERSION, allBlocks, nil, BlobVerifyStatusSkipped, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.file)
+			writeTestCacheFile(t, path, tc.version, 1024, data, tc.cached, tc.corrupt...)
+			result, err := VerifyCacheFile(path, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Status != tc.status || !reflect.DeepEqual(result.CorruptedBlocks, tc.corrupted) {
+				t.Fatalf("status = %s, corrupted = %v, want %s, %v", result.Status, result.CorruptedBlocks, tc.status, tc.corrupted)
+			}
+		})
+	}
+}
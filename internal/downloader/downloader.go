@@ -16,17 +16,19 @@ package downloader
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
 	"dingospeed/pkg/common"
 	"dingospeed/pkg/config"
+	"dingospeed/pkg/util"
 
 	"go.uber.org/zap"
 )
 
 // 整个文件
-func FileDownload(ctx context.Context, hfUrl, blobsFile, filesPath, orgRepo, fileName, authorization string, fileSize, startPos, endPos int64, responseChan chan []byte) {
+func FileDownload(ctx context.Context, hfPath, blobsFile, filesPath, orgRepo, fileName, authorization string, fileSize, startPos, endPos int64, responseChan chan []byte) {
 	var (
 		remoteTasks []*RemoteFileTask
 		wg          sync.WaitGroup
@@ -34,6 +36,17 @@ func FileDownload(ctx context.Context, hfUrl, blobsFile, filesPath, orgRepo, fil
 	defer close(responseChan)
 	dingCacheManager := GetInstance()
 	dingFile, err := dingCacheManager.GetDingFile(blobsFile, fileSize)
+	if errors.Is(err, ErrPlainBlob) {
+		// 判断是否为普通文件之后，缓存文件被替换为普通文件
+		if f, ok := OpenPlainBlob(blobsFile, fileSize); ok {
+			defer f.Close()
+			if err = util.CreateSymlinkIfNotExists(blobsFile, filesPath); err != nil {
+				zap.S().Errorf("filesPath:%s is not link", filesPath)
+			}
+			outPlainBlob(ctx, f, startPos, endPos, responseChan)
+			return
+		}
+	}
 	if err != nil {
 		zap.S().Errorf("GetDingFile err.%v", err)
 		return
@@ -41,9 +54,24 @@ func FileDownload(ctx context.Context, hfUrl, blobsFile, filesPath, orgRepo, fil
 	defer func() {
 		dingCacheManager.ReleasedDingFile(blobsFile)
 	}()
+	// 已完整缓存但尚未转换的blob（如升级前缓存的文件），读取时校验并转换为普通文件
+	if config.SysConfig.Download.MaterializeBlob && dingFile.isComplete() {
+		if _, ok := GetBlobVerifyInfo(blobsFile); !ok {
+			StartBlobVerify(blobsFile)
+		}
+	}
 
 	tasks := getContiguousRanges(ctx, dingFile, startPos, endPos)
+	defer func() {
+		// 未执行的远程任务登记的数据块需要释放，避免其他请求一直等待
+		for _, task := range tasks {
+			if remote, ok := task.(*RemoteFileTask); ok {
+				remote.releaseInflightBlocks()
+			}
+		}
+	}()
 	taskSize := len(tasks)
+	flowId := nextFlowId()
 	for i := 0; i < taskSize; i++ {
 		if ctx.Err() != nil {
 			zap.S().Errorf("FileDownload cancelled: %v", ctx.Err())
@@ -54,8 +82,10 @@ func FileDownload(ctx context.Context, hfUrl, blobsFile, filesPath, orgRepo, fil
 			remote.Context = ctx
 			remote.DingFile = dingFile
 			remote.authorization = authorization
-			remote.hfUrl = hfUrl
+			remote.hfPath = hfPath
+			remote.flowId = flowId
 			remote.Queue = make(chan []byte, getQueueSize(remote.RangeStartPos, remote.RangeEndPos))
+			remote.slot = &remoteSlot{}
 			remote.ResponseChan = responseChan
 			remote.TaskSize = taskSize
 			remote.FileName = fileName
@@ -63,6 +93,18 @@ func FileDownload(ctx context.Context, hfUrl, blobsFile, filesPath, orgRepo, fil
 			remote.filesPath = filesPath
 			remote.orgRepo = orgRepo
 			remoteTasks = append(remoteTasks, remote)
+		} else if inflight, ok := task.(*InflightFileTask); ok {
+			inflight.Context = ctx
+			inflight.DingFile = dingFile
+			inflight.authorization = authorization
+			inflight.hfPath = hfPath
+			inflight.flowId = flowId
+			inflight.TaskSize = taskSize
+			inflight.FileName = fileName
+			inflight.blobsFile = blobsFile
+			inflight.filesPath = filesPath
+			inflight.orgRepo = orgRepo
+			inflight.ResponseChan = responseChan
 		} else if cache, ok := task.(*CacheFileTask); ok {
 			cache.Context = ctx
 			cache.DingFile = dingFile
@@ -71,6 +113,9 @@ func FileDownload(ctx context.Context, hfUrl, blobsFile, filesPath, orgRepo, fil
 			cache.blobsFile = blobsFile
 			cache.filesPath = filesPath
 			cache.orgRepo = orgRepo
+			cache.authorization = authorization
+			cache.hfPath = hfPath
+			cache.flowId = flowId
 			cache.ResponseChan = responseChan
 		}
 	}
@@ -102,38 +147,85 @@ func FileDownload(ctx context.Context, hfUrl, blobsFile, filesPath, orgRepo, fil
 	wg.Wait() // 等待协程池所有远程下载任务执行完毕
 }
 
+// 多个区间，按顺序复用FileDownload下载每个区间，区间之间写入multipart分隔内容
+func FileRangesDownload(ctx context.Context, hfPath, blobsFile, filesPath, orgRepo, fileName, authorization string, fileSize int64, multipart *util.MultipartRanges, responseChan chan []byte) {
+	defer close(responseChan)
+	for i, r := range multipart.Ranges {
+		select {
+		case responseChan <- multipart.PartHeader(i):
+		case <-ctx.Done():
+			return
+		}
+		partChan := make(chan []byte, cap(responseChan))
+		go FileDownload(ctx, hfPath, blobsFile, filesPath, orgRepo, fileName, authorization, fileSize, r.Start, r.End, partChan)
+		var sent int64
+		for chunk := range partChan {
+			select {
+			case responseChan <- chunk:
+				sent += int64(len(chunk))
+			case <-ctx.Done():
+				zap.S().Warnf("FileRangesDownload cancelled: %s/%s, %v", orgRepo, fileName, ctx.Err())
+				return
+			}
+		}
+		// 区间数据不完整时不再输出后续的分隔符，响应体短于Content-Length，客户端可以发现错误
+		if sent != r.Length() {
+			zap.S().Errorf("FileRangesDownload %s/%s, range %d-%d is incomplete, sent %d", orgRepo, fileName, r.Start, r.End, sent)
+			return
+		}
+	}
+	select {
+	case responseChan <- multipart.Tail():
+	case <-ctx.Done():
+	}
+}
+
 func getQueueSize(rangeStartPos, rangeEndPos int64) int64 {
 	bufSize := min(config.SysConfig.Download.RemoteFileBufferSize, rangeEndPos-rangeStartPos)
 	return bufSize/config.SysConfig.Download.RespChunkSize + 1
 }
 
+// startRemoteDownload 按顺序启动远程下载任务，同时进行的任务数由concurrencyController控制，并受全局并发上限约束
 func startRemoteDownload(ctx context.Context, remoteFileTasks []*RemoteFileTask) {
-	var pool *common.Pool
 	taskLen := len(remoteFileTasks)
 	if taskLen == 0 {
 		return
-	} else if taskLen >= config.SysConfig.Download.GoroutineMaxNumPerFile {
-		pool = common.NewPool(config.SysConfig.Download.GoroutineMaxNumPerFile)
-	} else {
-		pool = common.NewPool(taskLen)
 	}
-	defer pool.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	controller := newConcurrencyController(taskLen)
 	for i := 0; i < taskLen; i++ {
-		if ctx.Err() != nil {
+		if err := controller.acquire(ctx); err != nil {
+			zap.S().Errorf("submit task err.%v", err)
 			return
 		}
+		// 按任务顺序占用全局并发，输出顺序在前的任务先开始下载
 		task := remoteFileTasks[i]
-		if err := pool.Submit(ctx, task); err != nil {
+		if err := task.slot.acquire(ctx); err != nil {
+			controller.release(0)
 			zap.S().Errorf("submit task err.%v", err)
 			return
 		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			task.DoTask()
+			controller.release(task.RangeEndPos - task.RangeStartPos)
+		}()
 		if config.SysConfig.GetRemoteFileRangeWaitTime() != 0 {
 			time.Sleep(config.SysConfig.GetRemoteFileRangeWaitTime())
 		}
 	}
 }
 
-// 将文件的偏移量分为cache和remote，对针对remote按照指定的RangeSize做切分
+const (
+	blockStateCache    = iota // 数据块已缓存
+	blockStateRemote          // 数据块需要从远端获取
+	blockStateInflight        // 数据块正在被其他请求从远端下载
+)
+
+// 将文件的偏移量分为cache、inflight和remote，对针对remote按照指定的RangeSize做切分。
+// 正在被其他请求下载的数据块不再重复请求远端，而是等待其下载完成后从缓存读取。
 
 func getContiguousRanges(ctx context.Context, dingFile *DingCache, startPos, endPos int64) (tasks []common.Task) {
 	if startPos == 0 && endPos == 0 {
@@ -143,66 +235,103 @@ func getContiguousRanges(ctx context.Context, dingFile *DingCache, startPos, end
 		zap.S().Errorf("Invalid startPos or endPos: startPos=%d, endPos=%d", startPos, endPos)
 		return
 	}
+	dingFile.inflightLock.Lock()
+	defer dingFile.inflightLock.Unlock()
 	startBlock := startPos / dingFile.getBlockSize()
 	endBlock := (endPos - 1) / dingFile.getBlockSize()
 
 	rangeStartPos, curPos := startPos, startPos
-	blockExists, err := dingFile.HasBlock(startBlock)
+	rangeState, err := getBlockState(dingFile, startBlock)
 	if err != nil {
 		zap.S().Errorf("Failed to check block existence: %v", err)
 		return
 	}
-	rangeIsRemote := !blockExists // 不存在，从远程获取，为true
 	taskNo := 0
 	for curBlock := startBlock; curBlock <= endBlock; curBlock++ {
 		if ctx.Err() != nil {
 			return
 		}
 		_, _, blockEndPos := getBlockInfo(curPos, dingFile.getBlockSize(), dingFile.GetFileSize())
-		blockExists, err = dingFile.HasBlock(curBlock)
+		curState, err := getBlockState(dingFile, curBlock)
 		if err != nil {
 			zap.S().Errorf("HasBlock err. curBlock:%d,curPos:%d, %v", curBlock, curPos, err)
 			return
 		}
-		curIsRemote := !blockExists // 不存在，从远程获取，为true，存在为false。
-		if rangeIsRemote != curIsRemote {
+		if rangeState != curState {
 			if rangeStartPos < curPos {
-				if rangeIsRemote {
-					tasks = splitRemoteRange(tasks, rangeStartPos, curPos, &taskNo)
-				} else {
-					c := NewCacheFileTask(taskNo, rangeStartPos, curPos)
-					tasks = append(tasks, c)
-					taskNo++
-				}
+				tasks = appendRangeTask(tasks, dingFile, rangeState, rangeStartPos, curPos, &taskNo)
 			}
 			rangeStartPos = curPos
-			rangeIsRemote = curIsRemote
+			rangeState = curState
 		}
 		curPos = blockEndPos
 	}
-	if rangeIsRemote {
-		tasks = splitRemoteRange(tasks, rangeStartPos, endPos, &taskNo)
-	} else {
-		c := NewCacheFileTask(taskNo, rangeStartPos, endPos)
-		tasks = append(tasks, c)
-		taskNo++
-	}
+	tasks = appendRangeTask(tasks, dingFile, rangeState, rangeStartPos, endPos, &taskNo)
 	return
 }
 
-func splitRemoteRange(tasks []common.Task, startPos, endPos int64, taskNo *int) []common.Task {
-	rangeSize := config.SysConfig.Download.RemoteFileRangeSize
-	if rangeSize == 0 {
+func getBlockState(dingFile *DingCache, blockIndex int64) (int, error) {
+	blockExists, err := dingFile.HasBlock(blockIndex)
+	if err != nil {
+		return blockStateRemote, err
+	}
+	if blockExists {
+		return blockStateCache, nil
+	}
+	if dingFile.isInflightBlock(blockIndex) {
+		return blockStateInflight, nil
+	}
+	return blockStateRemote, nil
+}
+
+func appendRangeTask(tasks []common.Task, dingFile *DingCache, state int, startPos, endPos int64, taskNo *int) []common.Task {
+	switch state {
+	case blockStateRemote:
+		remoteStart := len(tasks)
+		tasks = splitRemoteRange(tasks, dingFile.getBlockSize(), startPos, endPos, taskNo)
+		for _, task := range tasks[remoteStart:] {
+			registerRemoteTaskBlocks(dingFile, task.(*RemoteFileTask))
+		}
+	case blockStateInflight:
+		tasks = append(tasks, NewInflightFileTask(*taskNo, startPos, endPos))
+		*taskNo++
+	default:
+		tasks = append(tasks, NewCacheFileTask(*taskNo, startPos, endPos))
+		*taskNo++
+	}
+	return tasks
+}
+
+// registerRemoteTaskBlocks 登记远程任务将完整写入缓存的数据块，区间首尾不完整的块不会被写入，不做登记
+func registerRemoteTaskBlocks(dingFile *DingCache, task *RemoteFileTask) {
+	blockSize, fileSize := dingFile.getBlockSize(), dingFile.GetFileSize()
+	task.inflightBlocks = make(map[int64]*Broadcaster)
+	for curBlock := task.RangeStartPos / blockSize; curBlock*blockSize < task.RangeEndPos; curBlock++ {
+		_, blockStartPos, blockEndPos := getBlockInfo(curBlock*blockSize, blockSize, fileSize)
+		if blockStartPos >= task.RangeStartPos && blockEndPos <= task.RangeEndPos {
+			task.inflightBlocks[curBlock] = dingFile.registerInflightBlock(curBlock)
+		}
+	}
+}
+
+func splitRemoteRange(tasks []common.Task, blockSize, startPos, endPos int64, taskNo *int) []common.Task {
+	if config.SysConfig.Download.RemoteFileRangeSize == 0 {
 		c := NewRemoteFileTask(*taskNo, startPos, endPos)
 		tasks = append(tasks, c)
+		*taskNo++
 		return tasks
 	}
 	for start := startPos; start < endPos; {
-		end := start + rangeSize
+		upstreamNo := 0
+		if config.SysConfig.Upstream.Stripe {
+			upstreamNo = *taskNo
+		}
+		end := start + getRangeSize(upstreamNo, blockSize)
 		if end > endPos {
 			end = endPos
 		}
 		c := NewRemoteFileTask(*taskNo, start, end)
+		c.upstreamNo = upstreamNo
 		tasks = append(tasks, c)
 		*taskNo++
 		start = end
@@ -0,0 +1,394 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/util"
+)
+
+const (
+	testBlockSize = 64 * 1024
+	testChunkSize = 8192
+)
+
+// testHub 模拟上游，按Range返回文件内容，每次写入后停顿以便并发请求在下载过程中到达
+type testHub struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	requests map[string]*atomic.Int64
+	delays   map[string]time.Duration
+	noRange  map[string]bool // 忽略Range头，总是返回完整内容的文件
+	aborted  atomic.Int64    // 客户端中途断开的请求数
+}
+
+// hub为优先使用的上游，mirror为第二个上游
+var hub, mirror = newTestHub(), newTestHub()
+
+func newTestHub() *testHub {
+	return &testHub{files: map[string][]byte{}, requests: map[string]*atomic.Int64{}, delays: map[string]time.Duration{}, noRange: map[string]bool{}}
+}
+
+func (h *testHub) add(path string, content []byte) *atomic.Int64 {
+	return h.addWithDelay(path, content, 2*time.Millisecond)
+}
+
+// addWithDelay 添加文件，每写入testChunkSize的数据后停顿delay
+func (h *testHub) addWithDelay(path string, content []byte, delay time.Duration) *atomic.Int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.files[path] = content
+	h.requests[path] = &atomic.Int64{}
+	h.delays[path] = delay
+	return h.requests[path]
+}
+
+// addIgnoringRange 添加文件，请求该文件时忽略Range头，以200返回完整内容
+func (h *testHub) addIgnoringRange(path string, content []byte) *atomic.Int64 {
+	requests := h.add(path, content)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.noRange[path] = true
+	return requests
+}
+
+func (h *testHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	content, ok := h.files[r.URL.Path]
+	counter := h.requests[r.URL.Path]
+	delay := h.delays[r.URL.Path]
+	noRange := h.noRange[r.URL.Path]
+	h.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	counter.Add(1)
+	start, end := int64(0), int64(len(content))
+	if v := r.Header.Get("Range"); v != "" && !noRange {
+		var err error
+		if start, end, err = parseTestRange(v, end); err != nil {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", "bytes "+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(end-1, 10)+"/"+strconv.Itoa(len(content)))
+		w.Header().Set("Content-Length", strconv.FormatInt(end-start, 10))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.Header().Set("Content-Length", strconv.FormatInt(end, 10))
+	}
+	for pos := start; pos < end; pos += testChunkSize {
+		if _, err := w.Write(content[pos:min(pos+testChunkSize, end)]); err != nil {
+			h.aborted.Add(1)
+			return
+		}
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+			h.aborted.Add(1)
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+func parseTestRange(v string, size int64) (int64, int64, error) {
+	var start, end int64
+	v = v[len("bytes="):]
+	for i := 0; i < len(v); i++ {
+		if v[i] == '-' {
+			var err error
+			if start, err = strconv.ParseInt(v[:i], 10, 64); err != nil {
+				return 0, 0, err
+			}
+			if i+1 == len(v) {
+				return start, size, nil
+			}
+			if end, err = strconv.ParseInt(v[i+1:], 10, 64); err != nil {
+				return 0, 0, err
+			}
+			return start, min(end+1, size), nil
+		}
+	}
+	return 0, 0, strconv.ErrSyntax
+}
+
+func TestMain(m *testing.M) {
+	server, mirrorServer := httptest.NewServer(hub), httptest.NewServer(mirror)
+	config.SysConfig = &config.Config{}
+	config.SysConfig.Server.Online = true
+	config.SysConfig.Download.BlockSize = testBlockSize
+	config.SysConfig.Download.RespChunkSize = testChunkSize
+	config.SysConfig.Download.RemoteFileBufferSize = testBlockSize
+	config.SysConfig.Download.GoroutineMaxNumPerFile = 1
+	config.SysConfig.Upstream.Urls = []string{server.URL, mirrorServer.URL}
+	config.SysConfig.Upstream.FailureThreshold = 3
+	code := m.Run()
+	server.Close()
+	mirrorServer.Close()
+	os.Exit(code)
+}
+
+func testContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i*31 + i/253)
+	}
+	return content
+}
+
+// newTestRepo 创建临时的repos目录，返回blob所在目录
+func newTestRepo(t *testing.T) string {
+	dir := t.TempDir()
+	config.SysConfig.Server.Repos = dir
+	for _, sub := range []string{"blobs", "files"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "blobs")
+}
+
+// download 下载文件的[startPos, endPos)区间并返回收到的数据
+func download(ctx context.Context, blobsFile, hfPath string, fileSize, startPos, endPos int64) []byte {
+	responseChan := make(chan []byte, 30)
+	filesPath := filepath.Join(filepath.Dir(filepath.Dir(blobsFile)), "files", filepath.Base(blobsFile))
+	go FileDownload(ctx, hfPath, blobsFile, filesPath, "test/repo", "file", "", fileSize, startPos, endPos, responseChan)
+	var buf bytes.Buffer
+	for chunk := range responseChan {
+		buf.Write(chunk)
+	}
+	return buf.Bytes()
+}
+
+// waitBlobVerify 等待异步校验结束
+func waitBlobVerify(t *testing.T, blobsFile string) BlobVerifyInfo {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if info, ok := GetBlobVerifyInfo(blobsFile); ok && info.Status != BlobVerifyStatusVerifying {
+			return info
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("verify %s timeout", blobsFile)
+	return BlobVerifyInfo{}
+}
+
+// 同一文件的并发请求只向上游请求一次，等待者在数据到达时即收到数据
+func TestConcurrentDownloadFetchOnce(t *testing.T) {
+	blobsFile := filepath.Join(newTestRepo(t), "concurrent")
+	hfPath := "/test/repo/resolve/main/concurrent"
+	content := testContent(5*testBlockSize + 1234)
+	requests := hub.add(hfPath, content)
+
+	const n = 8
+	results := make([][]byte, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = download(context.Background(), blobsFile, hfPath, int64(len(content)), 0, int64(len(content)))
+		}(i)
+	}
+	wg.Wait()
+	for i, result := range results {
+		if !bytes.Equal(result, content) {
+			t.Fatalf("request %d got %d bytes, want %d", i, len(result), len(content))
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("upstream requests = %d, want 1", got)
+	}
+}
+
+// 下载方取消后，等待者中的一个接替下载，其余等待者仍能收到完整数据
+func TestInflightOwnerCancelled(t *testing.T) {
+	blobsFile := filepath.Join(newTestRepo(t), "cancelled")
+	hfPath := "/test/repo/resolve/main/cancelled"
+	content := testContent(3 * testBlockSize)
+	hub.add(hfPath, content)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	go download(ctx, blobsFile, hfPath, int64(len(content)), 0, int64(len(content)))
+	time.Sleep(time.Millisecond)
+
+	const n = 4
+	results := make([][]byte, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = download(context.Background(), blobsFile, hfPath, int64(len(content)), 0, int64(len(content)))
+		}(i)
+	}
+	wg.Wait()
+	for i, result := range results {
+		if !bytes.Equal(result, content) {
+			t.Fatalf("request %d got %d bytes, want %d", i, len(result), len(content))
+		}
+	}
+}
+
+// 远程任务下载过程中，已接收完的数据块不再保留在广播实例中，保留的数据不超过正在接收的数据块
+func TestInflightBlocksReleased(t *testing.T) {
+	blobsFile := filepath.Join(newTestRepo(t), "released")
+	hfPath := "/test/repo/resolve/main/released"
+	content := testContent(8 * testBlockSize)
+	hub.add(hfPath, content)
+	dingCacheManager := GetInstance()
+	dingFile, err := dingCacheManager.GetDingFile(blobsFile, int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dingCacheManager.ReleasedDingFile(blobsFile)
+
+	task := NewRemoteFileTask(0, 0, int64(len(content)))
+	task.Context = context.Background()
+	task.DingFile = dingFile
+	task.hfPath = hfPath
+	task.FileName = "released"
+	registerRemoteTaskBlocks(dingFile, task)
+	broadcasters := make([]*Broadcaster, 0, len(task.inflightBlocks))
+	for _, b := range task.inflightBlocks {
+		broadcasters = append(broadcasters, b)
+	}
+	retained := func() int {
+		total := 0
+		for _, b := range broadcasters {
+			b.mu.Lock()
+			total += len(b.data)
+			b.mu.Unlock()
+		}
+		return total
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		task.DoTask()
+	}()
+	maxRetained := 0
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		case <-time.After(time.Millisecond):
+		}
+		maxRetained = max(maxRetained, retained())
+	}
+	if maxRetained > 2*testBlockSize {
+		t.Fatalf("retained %d bytes while downloading, want at most %d", maxRetained, 2*testBlockSize)
+	}
+	if got := retained(); got != 0 {
+		t.Fatalf("retained %d bytes after download", got)
+	}
+	if len(task.inflightBlocks) != 0 {
+		t.Fatalf("%d inflight blocks are still referenced by the task", len(task.inflightBlocks))
+	}
+}
+
+// 判断是否为普通文件之后缓存文件被替换为普通文件时，FileDownload直接读取普通文件
+func TestDownloadPlainBlob(t *testing.T) {
+	blobsFile := filepath.Join(newTestRepo(t), "plain")
+	hfPath := "/test/repo/resolve/main/plain"
+	content := testContent(3*testBlockSize + 5)
+	requests := hub.add(hfPath, content)
+	if err := os.WriteFile(blobsFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := download(context.Background(), blobsFile, hfPath, int64(len(content)), 100, int64(len(content))-7); !bytes.Equal(got, content[100:len(content)-7]) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(content)-107)
+	}
+	if got := requests.Load(); got != 0 {
+		t.Fatalf("upstream requests = %d, want 0", got)
+	}
+	if !IsBlobCached(blobsFile, int64(len(content))) || IsBlobCached(blobsFile, int64(len(content))+1) {
+		t.Fatal("plain blob with matching size should be cached")
+	}
+	filesPath := filepath.Join(filepath.Dir(filepath.Dir(blobsFile)), "files", filepath.Base(blobsFile))
+	if target, err := filepath.EvalSymlinks(filesPath); err != nil || target != blobsFile {
+		t.Fatalf("files path links to %q, err %v, want %s", target, err, blobsFile)
+	}
+}
+
+// downloadRanges 以multipart/byteranges下载多个区间并返回响应体
+func downloadRanges(blobsFile, hfPath string, fileSize int64, m *util.MultipartRanges) []byte {
+	responseChan := make(chan []byte, 30)
+	filesPath := filepath.Join(filepath.Dir(filepath.Dir(blobsFile)), "files", filepath.Base(blobsFile))
+	go FileRangesDownload(context.Background(), hfPath, blobsFile, filesPath, "test/repo", "file", "", fileSize, m, responseChan)
+	var buf bytes.Buffer
+	for chunk := range responseChan {
+		buf.Write(chunk)
+	}
+	return buf.Bytes()
+}
+
+// 多区间下载的响应体按区间顺序输出，长度与ContentLength一致；区间数据不完整时不再输出后续的分隔符
+func TestFileRangesDownload(t *testing.T) {
+	blobsDir := newTestRepo(t)
+	hfPath := "/test/repo/resolve/main/ranges"
+	content := testContent(3*testBlockSize + 5)
+	fileSize := int64(len(content))
+	hub.add(hfPath, content)
+	ranges := []util.ByteRange{{Start: 100, End: 200}, {Start: testBlockSize - 10, End: testBlockSize + 10}, {Start: 3 * testBlockSize, End: fileSize}}
+	m := util.NewMultipartRanges(ranges, "application/octet-stream", fileSize)
+
+	body := downloadRanges(filepath.Join(blobsDir, "ranges"), hfPath, fileSize, m)
+	if int64(len(body)) != m.ContentLength() {
+		t.Fatalf("body length %d, want %d", len(body), m.ContentLength())
+	}
+	reader := multipart.NewReader(bytes.NewReader(body), m.Boundary)
+	for i, r := range ranges {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatalf("part %d err.%v", i, err)
+		}
+		if got := part.Header.Get("Content-Range"); got != r.ContentRange(fileSize) {
+			t.Fatalf("part %d Content-Range = %q", i, got)
+		}
+		if data, err := io.ReadAll(part); err != nil || !bytes.Equal(data, content[r.Start:r.End]) {
+			t.Fatalf("part %d got %d bytes, err %v", i, len(data), err)
+		}
+	}
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Fatalf("after the last part err = %v, want EOF", err)
+	}
+
+	// 上游没有该文件，第一个区间没有数据
+	body = downloadRanges(filepath.Join(blobsDir, "missing"), "/test/repo/resolve/main/missing", fileSize, m)
+	if !bytes.Equal(body, m.PartHeader(0)) {
+		t.Fatalf("got %q after a short part, want only the first part header", body)
+	}
+}
@@ -19,61 +19,112 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"os"
 	"sync"
 
 	cache "dingospeed/internal/data"
 	"dingospeed/pkg/config"
+	"dingospeed/pkg/prom"
 	"dingospeed/pkg/util"
 
 	"go.uber.org/zap"
 )
 
 const (
-	CURRENT_OLAH_CACHE_VERSION = 8
-	// DEFAULT_BLOCK_MASK_MAX     = 30
-	DEFAULT_BLOCK_MASK_MAX = 1024 * 1024
+	CURRENT_OLAH_CACHE_VERSION = 9
+	// OLAH_CACHE_VERSION_NO_CHECKSUM 该版本的缓存文件不包含数据块校验和，块掩码固定为LEGACY_BLOCK_MASK_MAX位，打开前会迁移为当前版本
+	OLAH_CACHE_VERSION_NO_CHECKSUM = 8
+	// OLAH_CACHE_VERSION_MIGRATING 迁移过程中写入的版本号，迁移中断的文件数据已错位，打开时会被重建
+	OLAH_CACHE_VERSION_MIGRATING = -1
+	LEGACY_BLOCK_MASK_MAX        = 1024 * 1024
 
 	cost = 1
 )
 
 var magicNumber = [4]byte{'O', 'L', 'A', 'H'}
 
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrBlockCorrupted 数据块校验和不一致，该块已被标记为不存在
+var ErrBlockCorrupted = errors.New("block checksum mismatch")
+
 // DingCacheHeader 结构体表示 Olah 缓存文件的头部
 type DingCacheHeader struct {
-	MagicNumber   [4]byte
-	Version       int64
-	BlockSize     int64
-	FileSize      int64
-	BlockMaskSize int64
-	BlockNumber   int64
-	BlockMask     *Bitset
+	MagicNumber    [4]byte
+	Version        int64
+	BlockSize      int64
+	FileSize       int64
+	BlockMaskSize  int64
+	BlockNumber    int64
+	BlockMask      *Bitset
+	BlockChecksums []uint32 // 每个数据块的CRC32C校验和，位于BlockMask之后，版本9开始支持
 }
 
 // NewDingCacheHeader 创建一个新的 DingCacheHeader 对象
 func NewDingCacheHeader(version, blockSize, fileSize int64) *DingCacheHeader {
 	blockNumber := (fileSize + blockSize - 1) / blockSize
-	blockMask := NewBitset(int64(DEFAULT_BLOCK_MASK_MAX))
-	return &DingCacheHeader{
-		MagicNumber:   magicNumber,
-		Version:       version,
-		BlockSize:     blockSize,
-		FileSize:      fileSize,
-		BlockMaskSize: DEFAULT_BLOCK_MASK_MAX,
-		BlockNumber:   blockNumber,
-		BlockMask:     blockMask,
+	header := &DingCacheHeader{
+		MagicNumber: magicNumber,
+		Version:     version,
+		BlockSize:   blockSize,
+		FileSize:    fileSize,
+		BlockNumber: blockNumber,
+	}
+	header.BlockMaskSize = header.getMaskSize(blockNumber)
+	header.BlockMask = NewBitset(header.BlockMaskSize)
+	if header.HasChecksum() {
+		header.BlockChecksums = make([]uint32, blockNumber)
+	}
+	return header
+}
+
+// HasChecksum 是否包含数据块校验和
+func (h *DingCacheHeader) HasChecksum() bool {
+	return h.Version > OLAH_CACHE_VERSION_NO_CHECKSUM
+}
+
+// isFixedMask 旧版本的块掩码固定大小，新版本按照块数量分配
+func (h *DingCacheHeader) isFixedMask() bool {
+	return h.Version <= OLAH_CACHE_VERSION_NO_CHECKSUM
+}
+
+func (h *DingCacheHeader) getMaskSize(blockNumber int64) int64 {
+	if h.isFixedMask() {
+		return LEGACY_BLOCK_MASK_MAX
+	}
+	return blockNumber
+}
+
+// resizeBlocks 调整块数量，块掩码及校验和随之扩展，已有的块标识保持不变
+func (h *DingCacheHeader) resizeBlocks(blockNumber int64) {
+	h.BlockNumber = blockNumber
+	if maskSize := h.getMaskSize(blockNumber); maskSize > h.BlockMaskSize {
+		blockMask := NewBitset(maskSize)
+		copy(blockMask.bits, h.BlockMask.bits)
+		h.BlockMask = blockMask
+		h.BlockMaskSize = maskSize
+	}
+	if h.HasChecksum() && int64(len(h.BlockChecksums)) < blockNumber {
+		h.BlockChecksums = append(h.BlockChecksums, make([]uint32, blockNumber-int64(len(h.BlockChecksums)))...)
 	}
 }
 
 // GetHeaderSize 返回头部的大小
 func (h *DingCacheHeader) GetHeaderSize() int64 {
+	return h.getBaseSize() + int64(4*len(h.BlockChecksums))
+}
+
+// getBaseSize 返回头部中除校验和以外部分的大小
+func (h *DingCacheHeader) getBaseSize() int64 {
 	return int64(36 + len(h.BlockMask.bits))
 }
 
 // Read 从文件流中读取头部信息
 func (h *DingCacheHeader) Read(f *os.File) error {
 	magic := make([]byte, 4)
-	if _, err := f.Read(magic); err != nil {
+	if _, err := io.ReadFull(f, magic); err != nil {
 		return errors.New("read magic 4 bytes err")
 	}
 	if !bytes.Equal(magic, []byte{'O', 'L', 'A', 'H'}) {
@@ -83,6 +134,9 @@ func (h *DingCacheHeader) Read(f *os.File) error {
 	if err := binary.Read(f, binary.LittleEndian, &h.Version); err != nil {
 		return err
 	}
+	if h.Version == OLAH_CACHE_VERSION_MIGRATING {
+		return ErrCacheMigrating
+	}
 	if err := binary.Read(f, binary.LittleEndian, &h.BlockSize); err != nil {
 		return err
 	}
@@ -92,29 +146,56 @@ func (h *DingCacheHeader) Read(f *os.File) error {
 	if err := binary.Read(f, binary.LittleEndian, &h.BlockMaskSize); err != nil {
 		return err
 	}
+	if h.BlockSize <= 0 || h.FileSize < 0 {
+		return fmt.Errorf("invalid block size %d or file size %d", h.BlockSize, h.FileSize)
+	}
 	h.BlockNumber = (h.FileSize + h.BlockSize - 1) / h.BlockSize
+	// 先校验再按照掩码大小分配内存，避免头部损坏时分配过大的内存
+	if err := h.ValidHeader(); err != nil {
+		return err
+	}
 	h.BlockMask = NewBitset(h.BlockMaskSize)
-	if _, err := f.Read(h.BlockMask.bits); err != nil {
+	if _, err := io.ReadFull(f, h.BlockMask.bits); err != nil {
 		return err
 	}
-	return h.ValidHeader()
+	if h.HasChecksum() {
+		h.BlockChecksums = make([]uint32, h.BlockNumber)
+		if err := binary.Read(f, binary.LittleEndian, h.BlockChecksums); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (h *DingCacheHeader) ValidHeader() error {
+	if h.Version < OLAH_CACHE_VERSION_NO_CHECKSUM {
+		return fmt.Errorf("the Olah Cache file (version %d) is created by older version Olah. Please remove cache files and retry", h.Version)
+	}
+	if h.Version > CURRENT_OLAH_CACHE_VERSION {
+		return fmt.Errorf("the Olah Cache file (version %d) is created by newer version Olah. Please migrate it with the newer version or remove cache files and retry", h.Version)
+	}
+	if h.BlockMaskSize != h.getMaskSize(h.BlockNumber) {
+		return fmt.Errorf("the block mask size %d does not match the block number %d", h.BlockMaskSize, h.BlockNumber)
+	}
 	if h.FileSize > h.BlockMaskSize*h.BlockSize {
 		return fmt.Errorf("the size of file %d is out of the max capability of container (%d * %d)", h.FileSize, h.BlockMaskSize, h.BlockSize)
 	}
-	if h.Version < CURRENT_OLAH_CACHE_VERSION {
-		return fmt.Errorf("the Olah Cache file is created by older version Olah. Please remove cache files and retry")
+	return nil
+}
+
+// Write 将头部信息（包括校验和）写入文件流
+func (h *DingCacheHeader) Write(f *os.File) error {
+	if err := h.writeBase(f); err != nil {
+		return err
 	}
-	if h.Version > CURRENT_OLAH_CACHE_VERSION {
-		return fmt.Errorf("the Olah Cache file is created by newer version Olah. Please remove cache files and retry")
+	if h.HasChecksum() {
+		return binary.Write(f, binary.LittleEndian, h.BlockChecksums)
 	}
 	return nil
 }
 
-// Write 将头部信息写入文件流
-func (h *DingCacheHeader) Write(f *os.File) error {
+// writeBase 将头部中除校验和以外的部分写入文件流
+func (h *DingCacheHeader) writeBase(f *os.File) error {
 	if _, err := f.Write(h.MagicNumber[:]); err != nil {
 		return err
 	}
@@ -138,11 +219,12 @@ func (h *DingCacheHeader) Write(f *os.File) error {
 
 // DingCache 结构体表示 Olah 缓存文件
 type DingCache struct {
-	path       string
-	header     *DingCacheHeader
-	isOpen     bool
-	headerLock sync.RWMutex
-	fileLock   sync.RWMutex
+	path         string
+	header       *DingCacheHeader
+	isOpen       bool
+	headerLock   sync.RWMutex
+	fileLock     sync.RWMutex
+	inflightLock sync.Mutex // 保证数据块下载状态的判断与登记是原子的
 }
 
 // NewDingCache 创建一个新的 DingCache 对象
@@ -164,31 +246,32 @@ func (c *DingCache) Open(path string, blockSize int64) error {
 	if c.isOpen {
 		return errors.New("this file has been open")
 	}
-	if _, err := os.Stat(path); err == nil { // 文件存在
-		c.headerLock.Lock()
-		defer c.headerLock.Unlock()
-		f, err := os.OpenFile(path, os.O_RDONLY, 0644)
-		if err != nil {
-			return err
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+	if _, err := os.Stat(path); err == nil { // 文件存在，旧版本的文件需先由DingCacheManager迁移为当前版本
+		header, err := readCacheHeader(path)
+		if err == nil {
+			c.header = header
+			c.isOpen = true
+			return nil
 		}
-		defer f.Close()
-		c.header = &DingCacheHeader{}
-		if err := c.header.Read(f); err != nil {
+		if !errors.Is(err, ErrCacheMigrating) {
 			return err
 		}
-	} else {
-		c.headerLock.Lock()
-		defer c.headerLock.Unlock()
-		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		c.header = NewDingCacheHeader(CURRENT_OLAH_CACHE_VERSION, blockSize, 0)
-		if err := c.header.Write(f); err != nil {
+		zap.S().Warnf("cache file %s migration was interrupted, recreate it", path)
+		if err = os.Remove(path); err != nil {
 			return err
 		}
 	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	c.header = NewDingCacheHeader(CURRENT_OLAH_CACHE_VERSION, blockSize, 0)
+	if err := c.header.Write(f); err != nil {
+		return err
+	}
 	c.isOpen = true
 	return nil
 }
@@ -220,9 +303,35 @@ func (c *DingCache) flushHeader() error {
 	if _, err := f.Seek(0, 0); err != nil {
 		return err
 	}
+	return c.header.writeBase(f)
+}
+
+// flushFullHeader 将完整的头部（包括校验和）写入文件
+func (c *DingCache) flushFullHeader() error {
+	f, err := os.OpenFile(c.path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 	return c.header.Write(f)
 }
 
+// writeBlockChecksum 将单个数据块的校验和写入文件头部，与verifyBlock等读取头部的操作互斥
+func (c *DingCache) writeBlockChecksum(blockIndex int64, checksum uint32) error {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+	c.header.BlockChecksums[blockIndex] = checksum
+	f, err := os.OpenFile(c.path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = f.Seek(c.header.getBaseSize()+4*blockIndex, 0); err != nil {
+		return err
+	}
+	return binary.Write(f, binary.LittleEndian, checksum)
+}
+
 // getFileSize 返回文件大小
 func (c *DingCache) GetFileSize() int64 {
 	c.headerLock.RLock()
@@ -252,19 +361,25 @@ func (c *DingCache) getHeaderSize() int64 {
 }
 
 func (c *DingCache) resizeHeader(blockNum, fileSize int64) error {
-	c.headerLock.RLock()
-	defer c.headerLock.RUnlock()
-	c.header.BlockNumber = blockNum
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+	c.header.resizeBlocks(blockNum)
 	c.header.FileSize = fileSize
 	return c.header.ValidHeader()
 }
 
 func (c *DingCache) setHeaderBlock(blockIndex int64) error {
-	// c.headerLock.Lock()
-	// defer c.headerLock.Unlock()
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
 	return c.header.BlockMask.Set(blockIndex)
 }
 
+func (c *DingCache) clearHeaderBlock(blockIndex int64) error {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+	return c.header.BlockMask.Clear(blockIndex)
+}
+
 // testHeaderBlock 测试头部块信息
 func (c *DingCache) testHeaderBlock(blockIndex int64) (bool, error) {
 	c.headerLock.RLock()
@@ -336,6 +451,10 @@ func (c *DingCache) ReadBlock(blockIndex int64) ([]byte, error) {
 	if _, err := f.Read(rawBlock); err != nil {
 		return nil, err
 	}
+	if !c.verifyBlock(blockIndex, rawBlock) {
+		c.markBlockCorrupted(blockIndex)
+		return nil, ErrBlockCorrupted
+	}
 	if config.SysConfig.Cache.Enabled {
 		c.readBlockAndCache(f, blockIndex)
 	}
@@ -367,6 +486,10 @@ func (c *DingCache) readBlockAndCache(f *os.File, blockIndex int64) {
 				zap.S().Errorf("read err. newOffsetBlock:%d, %v", newOffsetBlock, err)
 				break
 			}
+			if !c.verifyBlock(newOffsetBlock, prefetchRawBlock) {
+				c.markBlockCorrupted(newOffsetBlock)
+				break
+			}
 			blockByte := c.padBlock(prefetchRawBlock)
 			cache.FileBlockCache.Set(key, blockByte)
 			// 删除上一个缓存周期的内容，释放内存
@@ -404,18 +527,21 @@ func (c *DingCache) WriteBlock(blockIndex int64, blockBytes []byte) error {
 	if _, err := f.Seek(offset, 0); err != nil {
 		return err
 	}
+	realBlockBytes := blockBytes
 	if (blockIndex+1)*c.getBlockSize() > c.GetFileSize() {
-		realBlockBytes := blockBytes[:c.GetFileSize()-blockIndex*c.getBlockSize()]
-		if _, err = f.Write(realBlockBytes); err != nil {
-			return err
-		}
-	} else {
-		if _, err = f.Write(blockBytes); err != nil {
-			return err
-		}
+		realBlockBytes = blockBytes[:c.GetFileSize()-blockIndex*c.getBlockSize()]
+	}
+	if _, err = f.Write(realBlockBytes); err != nil {
+		return err
 	}
 	c.fileLock.Lock()
 	defer c.fileLock.Unlock()
+	// 先写校验和，再设置块标识，保证已标识的块都有对应的校验和
+	if c.header.HasChecksum() {
+		if err = c.writeBlockChecksum(blockIndex, crc32.Checksum(realBlockBytes, crc32cTable)); err != nil {
+			return err
+		}
+	}
 	if err = c.setHeaderBlock(blockIndex); err != nil {
 		return err
 	}
@@ -424,27 +550,28 @@ func (c *DingCache) WriteBlock(blockIndex int64, blockBytes []byte) error {
 	}
 	// key := c.getBlockKey(blockIndex)  不需要删除，本来就没有
 	// cache.FileBlockCache.Del(key)
+	c.finishInflightBlock(blockIndex, nil, true)
+	// 最后一个缺失的数据块写入后，校验整个文件与oid是否一致
+	if c.isComplete() {
+		StartBlobVerify(c.path)
+	}
 	return nil
 }
 
-// resizeFileSize 调整文件大小
+// resizeFileSize 按照当前头部大小调整文件大小
 func (c *DingCache) resizeFileSize(fileSize int64) error {
 	if !c.isOpen {
 		return errors.New("this file has been closed")
 	}
-	if fileSize == c.GetFileSize() {
-		return nil
-	}
-
-	if fileSize < c.GetFileSize() {
-		return errors.New("invalid resize file size. New file size must be greater than the current file size")
-	}
 	f, err := os.OpenFile(c.path, os.O_RDWR, 0644)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 	newBinSize := c.getHeaderSize() + fileSize
+	if stat, err := f.Stat(); err == nil && stat.Size() == newBinSize {
+		return nil
+	}
 	if _, err = f.Seek(newBinSize-1, 0); err != nil {
 		return err
 	}
@@ -466,14 +593,55 @@ func (c *DingCache) Resize(fileSize int64) error {
 	newBlockNum := (fileSize + bs - 1) / bs
 	c.fileLock.Lock()
 	defer c.fileLock.Unlock()
-	if err := c.resizeFileSize(fileSize); err != nil {
-		return err
+	if fileSize < c.GetFileSize() {
+		return errors.New("invalid resize file size. New file size must be greater than the current file size")
 	}
-	// 设置块数量、文件大小参数
+	// 头部大小随块数量变化，已写入数据后再调整会导致数据偏移错乱
+	if !c.header.isFixedMask() && c.GetFileSize() != 0 && newBlockNum != c.getBlockNumber() {
+		return errors.New("the block number of a cache file with variable header can not be changed")
+	}
+	// 设置块数量、文件大小参数，再按新的头部大小调整文件
 	if err := c.resizeHeader(newBlockNum, fileSize); err != nil {
 		return err
 	}
-	return c.flushHeader()
+	if err := c.resizeFileSize(fileSize); err != nil {
+		return err
+	}
+	return c.flushFullHeader()
+}
+
+// verifyBlock 校验数据块的CRC32C，不包含校验和的旧版本缓存文件不做校验
+func (c *DingCache) verifyBlock(blockIndex int64, rawBlock []byte) bool {
+	c.headerLock.RLock()
+	defer c.headerLock.RUnlock()
+	if !c.header.HasChecksum() {
+		return true
+	}
+	validLen := min(c.header.BlockSize, c.header.FileSize-blockIndex*c.header.BlockSize)
+	if int64(len(rawBlock)) < validLen {
+		return false
+	}
+	return crc32.Checksum(rawBlock[:validLen], crc32cTable) == c.header.BlockChecksums[blockIndex]
+}
+
+// markBlockCorrupted 将校验失败的数据块标记为不存在，后续请求会重新从远端获取
+func (c *DingCache) markBlockCorrupted(blockIndex int64) {
+	zap.S().Errorf("block checksum mismatch, file:%s, block:%d", c.path, blockIndex)
+	if config.SysConfig.EnableMetric() {
+		prom.CacheBlockCorruptedCnt.Inc()
+	}
+	if config.SysConfig.Cache.Enabled {
+		cache.FileBlockCache.Delete(c.getBlockKey(blockIndex))
+	}
+	c.fileLock.Lock()
+	defer c.fileLock.Unlock()
+	if err := c.clearHeaderBlock(blockIndex); err != nil {
+		zap.S().Errorf("clear block err.%v", err)
+		return
+	}
+	if err := c.flushHeader(); err != nil {
+		zap.S().Errorf("flushHeader err.%v", err)
+	}
 }
 
 func (c *DingCache) getBlockKey(blockIndex int64) string {
@@ -1,6 +1,8 @@
 package downloader
 
 import (
+	"errors"
+	"os"
 	"sync"
 	"sync/atomic"
 
@@ -13,6 +15,9 @@ import (
 var (
 	instance *DingCacheManager
 	once     sync.Once
+
+	// ErrPlainBlob 文件已转换为不带头部的普通文件
+	ErrPlainBlob = errors.New("blob is a plain file")
 )
 
 func GetInstance() *DingCacheManager {
@@ -20,6 +25,7 @@ func GetInstance() *DingCacheManager {
 		instance = &DingCacheManager{
 			dingCacheMap: common.NewSafeMap[string, *DingCache](),
 			dingCacheRef: common.NewSafeMap[string, *atomic.Int64](),
+			plainBlobs:   common.NewSafeMap[string, string](),
 		}
 	})
 	return instance
@@ -28,10 +34,17 @@ func GetInstance() *DingCacheManager {
 type DingCacheManager struct {
 	dingCacheMap *common.SafeMap[string, *DingCache]
 	dingCacheRef *common.SafeMap[string, *atomic.Int64]
+	plainBlobs   *common.SafeMap[string, string] // 已生成、等待替换缓存文件的普通文件
 	mu           sync.RWMutex
 }
 
 func (f *DingCacheManager) GetDingFile(savePath string, fileSize int64) (*DingCache, error) {
+	if _, ok := f.dingCacheMap.Get(savePath); !ok {
+		if err := migrateLegacyCacheFile(savePath); err != nil {
+			zap.S().Errorf("migrate cache file %s err.%v", savePath, err)
+			return nil, err
+		}
+	}
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	var (
@@ -47,6 +60,10 @@ func (f *DingCacheManager) GetDingFile(savePath string, fileSize int64) (*DingCa
 		}
 		return dingFile, nil
 	} else {
+		// 其他请求释放时缓存文件可能已被替换为普通文件，由调用方直接读取
+		if stat, err := os.Stat(savePath); err == nil && stat.Size() > 0 && !IsCacheFile(savePath) {
+			return nil, ErrPlainBlob
+		}
 		if dingFile, err = NewDingCache(savePath, config.SysConfig.Download.BlockSize); err != nil {
 			zap.S().Errorf("NewDingCache err.%v", err)
 			return nil, err
@@ -81,6 +98,10 @@ func (f *DingCacheManager) ReleasedDingFile(savePath string) {
 		}
 		f.dingCacheMap.Delete(savePath)
 		f.dingCacheRef.Delete(savePath)
+		if plainPath, ok := f.plainBlobs.Get(savePath); ok {
+			f.plainBlobs.Delete(savePath)
+			replacePlainBlob(savePath, plainPath)
+		}
 	} else {
 		f.dingCacheRef.Set(savePath, refCount)
 	}
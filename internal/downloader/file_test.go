@@ -15,7 +15,12 @@
 package downloader
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"go.uber.org/zap"
@@ -46,3 +51,120 @@ func TestFileWrite2(t *testing.T) {
 	fmt.Println(string(h.MagicNumber[:]))
 
 }
+
+// 旧版本头部比新版本大（块较少）和小（块较多）两种情况都需要正确移动数据
+func TestMigrateCacheFile(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		blockSize int64
+		fileSize  int64
+	}{
+		{"shrink", 1024, 10*1024 + 100},
+		{"grow", 1, 40000},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "blob")
+			data := make([]byte, tc.fileSize)
+			for i := range data {
+				data[i] = byte(i*7 + i/251)
+			}
+			old := NewDingCacheHeader(OLAH_CACHE_VERSION_NO_CHECKSUM, tc.blockSize, tc.fileSize)
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := int64(0); i < old.BlockNumber; i += 2 {
+				_ = old.BlockMask.Set(i)
+			}
+			if err = old.Write(f); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = f.Write(data); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			migrated, err := MigrateCacheFile(path)
+			if err != nil || !migrated {
+				t.Fatalf("MigrateCacheFile() = %v, %v", migrated, err)
+			}
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, _ = os.Open(path)
+			header := &DingCacheHeader{}
+			err = header.Read(f)
+			f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header.Version != CURRENT_OLAH_CACHE_VERSION || header.BlockMaskSize != old.BlockNumber {
+				t.Fatalf("version=%d maskSize=%d", header.Version, header.BlockMaskSize)
+			}
+			if int64(len(raw)) != header.GetHeaderSize()+tc.fileSize {
+				t.Fatalf("file size %d, want %d", len(raw), header.GetHeaderSize()+tc.fileSize)
+			}
+			for i := int64(0); i < header.BlockNumber; i++ {
+				has, _ := header.BlockMask.Test(i)
+				if has != (i%2 == 0) {
+					t.Fatalf("block %d mask=%v", i, has)
+				}
+				if !has {
+					continue
+				}
+				start, end := i*tc.blockSize, min((i+1)*tc.blockSize, tc.fileSize)
+				block := raw[header.GetHeaderSize()+start : header.GetHeaderSize()+end]
+				if !bytes.Equal(block, data[start:end]) {
+					t.Fatalf("block %d data mismatch", i)
+				}
+				if header.BlockChecksums[i] != crc32.Checksum(block, crc32cTable) {
+					t.Fatalf("block %d checksum mismatch", i)
+				}
+			}
+			if migrated, err = MigrateCacheFile(path); err != nil || migrated {
+				t.Fatalf("second MigrateCacheFile() = %v, %v", migrated, err)
+			}
+		})
+	}
+}
+
+// 磁盘上损坏的数据块校验失败后从远端重新获取，并以正确的数据覆盖
+func TestCorruptedBlockRefetched(t *testing.T) {
+	blobsFile := filepath.Join(newTestRepo(t), "corrupted")
+	hfPath := "/test/repo/resolve/main/corrupted"
+	content := testContent(4*testBlockSize + 100)
+	requests := hub.add(hfPath, content)
+	if got := download(context.Background(), blobsFile, hfPath, int64(len(content)), 0, int64(len(content))); !bytes.Equal(got, content) {
+		t.Fatalf("first download got %d bytes, want %d", len(got), len(content))
+	}
+	waitBlobVerify(t, blobsFile)
+
+	info, err := InspectCacheFile(blobsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(blobsFile, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := info.HeaderSize + testBlockSize + 10
+	if _, err = f.WriteAt([]byte{content[testBlockSize+10] ^ 0xff}, offset); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if got := download(context.Background(), blobsFile, hfPath, int64(len(content)), 0, int64(len(content))); !bytes.Equal(got, content) {
+		t.Fatalf("download after corruption got %d bytes, want %d", len(got), len(content))
+	}
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("upstream requests = %d, want 2", got)
+	}
+	raw, err := os.ReadFile(blobsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw[offset:offset+int64(len(content))-testBlockSize-10], content[testBlockSize+10:]) {
+		t.Fatal("corrupted block is not rewritten")
+	}
+}
@@ -0,0 +1,55 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package downloader
+
+import (
+	"go.uber.org/zap"
+)
+
+// InflightFileTask 区间内的数据块正在被其他请求从远端下载，数据到达时即输出，不等待数据块写入缓存，
+// 避免多个请求对同一数据块重复请求远端。若下载方失败，则由其中一个等待者重新登记并下载该数据块。
+type InflightFileTask struct {
+	DownloadTask
+}
+
+func NewInflightFileTask(taskNo int, rangeStartPos int64, rangeEndPos int64) *InflightFileTask {
+	t := &InflightFileTask{}
+	t.TaskNo = taskNo
+	t.RangeStartPos = rangeStartPos
+	t.RangeEndPos = rangeEndPos
+	return t
+}
+
+func (t InflightFileTask) DoTask() {
+}
+
+func (t InflightFileTask) OutResult() {
+	blockSize, fileSize := t.DingFile.getBlockSize(), t.DingFile.GetFileSize()
+	curPos := t.RangeStartPos
+	for curPos < t.RangeEndPos {
+		_, _, blockEndPos := getBlockInfo(curPos, blockSize, fileSize)
+		ePos := min(t.RangeEndPos, blockEndPos)
+		if !t.outBlock(curPos, ePos) {
+			zap.S().Warnf("inflight file out interrupted:%s/%s, taskNo:%d, pos:%d", t.orgRepo, t.FileName, t.TaskNo, curPos)
+			return
+		}
+		curPos = ePos
+	}
+	zap.S().Infof("inflight file out:%s/%s, taskNo:%d, size:%d, startPos:%d, endPos:%d", t.orgRepo, t.FileName, t.TaskNo, t.TaskSize, t.RangeStartPos, t.RangeEndPos)
+}
+
+func (t InflightFileTask) GetResponseChan() chan []byte {
+	return t.ResponseChan
+}
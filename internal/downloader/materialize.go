@@ -0,0 +1,137 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package downloader
+
+// 完整且校验通过的blob会转换为不带头部的普通文件，之后直接由http.ServeContent返回，
+// 其他工具也可以直接读取repos/files/.../blobs/<oid>。
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"dingospeed/pkg/config"
+
+	"go.uber.org/zap"
+)
+
+const materializingSuffix = ".materializing"
+
+// OpenPlainBlob 打开已转换为普通文件的blob。缓存文件总是以魔数开头，不是缓存文件且大小与blob一致的即为普通文件，
+// 大小不一致的文件已损坏，不直接返回
+func OpenPlainBlob(blobsFile string, fileSize int64) (*os.File, bool) {
+	f, err := os.Open(blobsFile)
+	if err != nil {
+		return nil, false
+	}
+	stat, err := f.Stat()
+	if err != nil || !stat.Mode().IsRegular() || hasCacheMagic(f) {
+		f.Close()
+		return nil, false
+	}
+	if stat.Size() != fileSize {
+		zap.S().Errorf("plain blob %s size %d does not match %d", blobsFile, stat.Size(), fileSize)
+		f.Close()
+		return nil, false
+	}
+	return f, true
+}
+
+// outPlainBlob 从普通文件读取[startPos, endPos)的数据输出
+func outPlainBlob(ctx context.Context, f *os.File, startPos, endPos int64, responseChan chan []byte) {
+	for startPos < endPos {
+		chunk := make([]byte, min(config.SysConfig.Download.RespChunkSize, endPos-startPos))
+		n, err := f.ReadAt(chunk, startPos)
+		if n > 0 {
+			select {
+			case responseChan <- chunk[:n]:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) || startPos+int64(n) < endPos {
+				zap.S().Errorf("read plain blob %s err.%v", f.Name(), err)
+			}
+			return
+		}
+		startPos += int64(n)
+	}
+}
+
+// IsBlobCached blob已转换为普通文件，或缓存文件已包含全部数据块
+func IsBlobCached(blobsFile string, fileSize int64) bool {
+	if f, ok := OpenPlainBlob(blobsFile, fileSize); ok {
+		f.Close()
+		return true
+	}
+	info, err := InspectCacheFile(blobsFile)
+	return err == nil && info.FileSize == fileSize && info.Complete()
+}
+
+// createPlainBlob 创建转换用的临时文件，校验blob时同时写入，未开启转换时返回nil
+func createPlainBlob(blobsFile string) *os.File {
+	if !config.SysConfig.Download.MaterializeBlob {
+		return nil
+	}
+	f, err := os.Create(blobsFile + materializingSuffix)
+	if err != nil {
+		zap.S().Warnf("create plain blob for %s err.%v", blobsFile, err)
+		return nil
+	}
+	return f
+}
+
+// finishPlainBlob 校验通过时登记临时文件，待缓存文件不再被引用时替换，否则删除临时文件
+func finishPlainBlob(blobsFile string, plain *os.File, verified bool) {
+	if plain == nil {
+		return
+	}
+	err := plain.Sync()
+	if closeErr := plain.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || !verified {
+		if err != nil {
+			zap.S().Warnf("write plain blob for %s err.%v", blobsFile, err)
+		}
+		os.Remove(plain.Name())
+		return
+	}
+	GetInstance().setPlainBlob(blobsFile, plain.Name())
+}
+
+// setPlainBlob 登记已生成的普通文件，读写中的缓存文件不能直接替换，在最后一个引用释放时替换
+func (f *DingCacheManager) setPlainBlob(savePath, plainPath string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.dingCacheMap.Get(savePath); ok {
+		f.plainBlobs.Set(savePath, plainPath)
+		return
+	}
+	replacePlainBlob(savePath, plainPath)
+}
+
+// replacePlainBlob 用普通文件替换缓存文件，调用方需持有DingCacheManager的锁。之后打开该文件的请求由
+// GetDingFile返回ErrPlainBlob，改为直接读取普通文件
+func replacePlainBlob(savePath, plainPath string) {
+	if err := os.Rename(plainPath, savePath); err != nil {
+		zap.S().Errorf("replace %s with plain blob err.%v", savePath, err)
+		os.Remove(plainPath)
+		return
+	}
+	zap.S().Infof("blob %s is materialized as plain file", savePath)
+}
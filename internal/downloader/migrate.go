@@ -0,0 +1,170 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package downloader
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"os"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrCacheMigrating 缓存文件的迁移被中断，数据已不可用
+	ErrCacheMigrating = errors.New("cache file migration was interrupted")
+	// ErrCacheNeedsMigration 旧版本的缓存文件需要先迁移为当前版本
+	ErrCacheNeedsMigration = errors.New("cache file needs migration")
+
+	// migrateLocks 按路径分段的迁移锁，迁移大文件时只阻塞同一文件的请求
+	migrateLocks [64]sync.Mutex
+)
+
+// MigrateCacheFile 将旧版本（块掩码固定大小，不包含校验和）的缓存文件原地迁移为当前版本，返回是否发生了迁移
+func MigrateCacheFile(path string) (bool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	header := &DingCacheHeader{}
+	if err = header.Read(f); err != nil {
+		return false, err
+	}
+	if !header.isFixedMask() {
+		return false, nil
+	}
+	if _, err = migrateCacheFile(f, header); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// readCacheHeader 读取缓存文件头部，旧版本的文件返回ErrCacheNeedsMigration
+func readCacheHeader(path string) (*DingCacheHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	header := &DingCacheHeader{}
+	if err = header.Read(f); err != nil {
+		return nil, err
+	}
+	if header.isFixedMask() {
+		return nil, ErrCacheNeedsMigration
+	}
+	return header, nil
+}
+
+// migrateLegacyCacheFile 打开缓存文件前将旧版本的文件迁移为当前版本。迁移需要移动全部数据，
+// 在DingCacheManager的锁之外进行，同一文件的并发请求等待迁移完成，其他文件不受影响
+func migrateLegacyCacheFile(path string) error {
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	lock := &migrateLocks[h.Sum32()%uint32(len(migrateLocks))]
+	lock.Lock()
+	defer lock.Unlock()
+	version, err := readCacheVersion(path)
+	if err != nil || version == OLAH_CACHE_VERSION_MIGRATING || version > OLAH_CACHE_VERSION_NO_CHECKSUM {
+		// 文件不存在、无法识别或迁移中断时由Open处理
+		return nil
+	}
+	_, err = MigrateCacheFile(path)
+	return err
+}
+
+// readCacheVersion 读取缓存文件头部中的版本号
+func readCacheVersion(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	b := make([]byte, len(magicNumber)+8)
+	if _, err = io.ReadFull(f, b); err != nil {
+		return 0, err
+	}
+	if [4]byte(b[:4]) != magicNumber {
+		return 0, errors.New("file is not a Olah cache file")
+	}
+	return int64(binary.LittleEndian.Uint64(b[len(magicNumber):])), nil
+}
+
+// migrateCacheFile 按照新的头部大小移动已缓存的数据块，并补齐数据块校验和。
+// 新头部比旧头部小时从前往后移动，反之从后往前移动，保证未移动的数据不被覆盖。
+// 迁移前先将版本号改为OLAH_CACHE_VERSION_MIGRATING，迁移中断后该文件会被重建。
+func migrateCacheFile(f *os.File, old *DingCacheHeader) (*DingCacheHeader, error) {
+	header := NewDingCacheHeader(CURRENT_OLAH_CACHE_VERSION, old.BlockSize, old.FileSize)
+	oldHeaderSize, newHeaderSize := old.GetHeaderSize(), header.GetHeaderSize()
+	zap.S().Infof("migrate cache file %s from version %d to %d, header size %d -> %d", f.Name(), old.Version, header.Version, oldHeaderSize, newHeaderSize)
+	if err := writeCacheVersion(f, OLAH_CACHE_VERSION_MIGRATING); err != nil {
+		return nil, err
+	}
+	if newHeaderSize > oldHeaderSize {
+		if err := f.Truncate(newHeaderSize + header.FileSize); err != nil {
+			return nil, err
+		}
+	}
+	buf := make([]byte, old.BlockSize)
+	for i := int64(0); i < old.BlockNumber; i++ {
+		blockIndex := i
+		if newHeaderSize > oldHeaderSize {
+			blockIndex = old.BlockNumber - 1 - i
+		}
+		if ok, err := old.BlockMask.Test(blockIndex); err != nil || !ok {
+			continue
+		}
+		block := buf[:min(old.BlockSize, old.FileSize-blockIndex*old.BlockSize)]
+		if _, err := f.ReadAt(block, oldHeaderSize+blockIndex*old.BlockSize); err != nil {
+			return nil, err
+		}
+		checksum := crc32.Checksum(block, crc32cTable)
+		if _, err := f.WriteAt(block, newHeaderSize+blockIndex*old.BlockSize); err != nil {
+			return nil, err
+		}
+		header.BlockChecksums[blockIndex] = checksum
+		if err := header.BlockMask.Set(blockIndex); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.Truncate(newHeaderSize + header.FileSize); err != nil {
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	if err := header.Write(f); err != nil {
+		return nil, err
+	}
+	return header, f.Sync()
+}
+
+// writeCacheVersion 修改头部中的版本号，版本号位于魔数之后
+func writeCacheVersion(f *os.File, version int64) error {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(version))
+	if _, err := f.WriteAt(b, int64(len(magicNumber))); err != nil {
+		return err
+	}
+	return f.Sync()
+}
@@ -0,0 +1,339 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package downloader
+
+// 远端区间的下载：按上游优先级获取数据，上游不可用或中途断开时，从已输出的位置向下一个上游请求剩余的数据。
+// 当前上游的吞吐低于hedgeThroughput时，向另一个上游发起对冲请求，两个请求同时下载剩余的数据，
+// 领先的请求按顺序输出，落后的请求读到的数据直接丢弃，先完成的请求胜出，另一个被取消。
+// 吞吐受本地带宽限制或客户端读取较慢时不发起对冲请求。
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dingospeed/pkg/common"
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/prom"
+	"dingospeed/pkg/upstream"
+	"dingospeed/pkg/util"
+
+	"go.uber.org/zap"
+)
+
+type remoteRange struct {
+	task        RemoteFileTask
+	startPos    int64
+	endPos      int64
+	contentChan chan<- []byte
+	source      string
+
+	mu      sync.Mutex
+	sentLen int64 // 已按顺序输出的数据长度
+}
+
+// fetchStats 请求读取的数据量、因带宽限制等待的时间和等待下游读取的时间，用于计算吞吐
+type fetchStats struct {
+	read      atomic.Int64
+	throttled atomic.Int64
+	blocked   atomic.Int64
+}
+
+type fetchResult struct {
+	upstream   *upstream.Upstream
+	statusCode int
+	err        error
+}
+
+func (rr *remoteRange) pos() int64 {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	return rr.startPos + rr.sentLen
+}
+
+func (rr *remoteRange) done() bool {
+	return rr.pos() >= rr.endPos
+}
+
+// forward 输出从pos开始的数据中尚未输出的部分，已输出的部分直接丢弃。
+// 返回等待下游读取的时间，contentChan已满说明客户端读取较慢，该时间不反映上游的吞吐
+func (rr *remoteRange) forward(ctx context.Context, pos int64, data []byte) time.Duration {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	cur := rr.startPos + rr.sentLen
+	if ctx.Err() != nil || pos > cur || pos+int64(len(data)) <= cur {
+		return 0
+	}
+	chunk := data[cur-pos:]
+	select {
+	case rr.contentChan <- chunk:
+		rr.sentLen += int64(len(chunk))
+		return 0
+	default:
+	}
+	start := time.Now()
+	select {
+	case rr.contentChan <- chunk:
+		rr.sentLen += int64(len(chunk))
+	case <-ctx.Done():
+	}
+	return time.Since(start)
+}
+
+func (rr *remoteRange) run() {
+	_, err := upstream.DoFrom(rr.task.upstreamNo, func(u *upstream.Upstream) (*common.Response, error) {
+		statusCode, err := rr.fetchWithHedge(u)
+		return &common.Response{StatusCode: statusCode}, err
+	})
+	if err != nil {
+		zap.S().Errorf("file:%s, task %d, get remote range err.%v", rr.task.FileName, rr.task.TaskNo, err)
+	}
+	if sentLen := rr.pos() - rr.startPos; sentLen != rr.endPos-rr.startPos {
+		zap.S().Warnf("file:%s, taskNo:%d,The block is incomplete. Expected-%d. Accepted-%d", rr.task.FileName, rr.task.TaskNo, rr.endPos-rr.startPos, sentLen)
+	}
+}
+
+// fetchWithHedge 从上游u下载剩余的数据，吞吐过低时发起对冲请求。对冲请求先完成时，
+// 原请求只是较慢，不计入u的失败。
+func (rr *remoteRange) fetchWithHedge(u *upstream.Upstream) (int, error) {
+	var stats fetchStats
+	threshold := config.SysConfig.Upstream.HedgeThroughput
+	if threshold <= 0 {
+		return rr.fetch(rr.task.Context, u, &stats)
+	}
+	ctx, cancel := context.WithCancel(rr.task.Context)
+	defer cancel()
+	results := make(chan fetchResult, 2)
+	go func() {
+		statusCode, err := rr.fetch(ctx, u, &stats)
+		results <- fetchResult{upstream: u, statusCode: statusCode, err: err}
+	}()
+	var (
+		hedge   *upstream.Upstream
+		probe   bool // hedge是否为熔断到期后的试探请求，未调用Report时需交还试探机会
+		primary *fetchResult
+		running = 1
+		window  = config.SysConfig.Upstream.HedgeWindow
+		samples = make([]int64, 0, window+1) // 每秒采样的已读取数据量
+		waits   = make([]int64, 0, window+1) // 每秒采样的带宽限制及下游读取的等待时间
+	)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for running > 0 {
+		select {
+		case res := <-results:
+			running--
+			if res.upstream == u {
+				primary = &res
+			}
+			if rr.done() {
+				// 区间已完整输出，取消另一个请求并等待其退出，避免向已关闭的contentChan写入
+				cancel()
+				for ; running > 0; running-- {
+					<-results
+				}
+				if hedge != nil {
+					countHedge(hedge, res.upstream == hedge)
+					if res.upstream == hedge {
+						hedge.Report(&common.Response{StatusCode: res.statusCode}, nil)
+						return http.StatusPartialContent, nil
+					}
+					// 对冲请求落后被取消或结果未被记录
+					hedge.Release(probe)
+				}
+				return res.statusCode, res.err
+			}
+			if res.upstream == hedge {
+				countHedge(hedge, false)
+				if errors.Is(res.err, context.Canceled) {
+					hedge.Release(probe)
+				} else {
+					hedge.Report(&common.Response{StatusCode: res.statusCode}, res.err)
+				}
+				probe = false
+			}
+		case <-ticker.C:
+			if hedge != nil {
+				continue
+			}
+			samples = append(samples, stats.read.Load())
+			waits = append(waits, stats.throttled.Load()+stats.blocked.Load())
+			if len(samples) <= window {
+				continue
+			}
+			samples = samples[len(samples)-window-1:]
+			waits = waits[len(waits)-window-1:]
+			if waits[window] > waits[0] {
+				continue
+			}
+			if rate := (samples[window] - samples[0]) / int64(window); rate >= threshold {
+				continue
+			}
+			if hedge, probe = upstream.Pick(u); hedge == nil {
+				continue
+			}
+			zap.S().Infof("file:%s, task %d, %s is slow, hedge remaining range from %d on %s", rr.task.FileName, rr.task.TaskNo, u.Host, rr.pos(), hedge.Host)
+			running++
+			go func(h *upstream.Upstream) {
+				var hedgeStats fetchStats
+				statusCode, err := rr.fetch(ctx, h, &hedgeStats)
+				results <- fetchResult{upstream: h, statusCode: statusCode, err: err}
+			}(hedge)
+		}
+	}
+	return primary.statusCode, primary.err
+}
+
+func countHedge(u *upstream.Upstream, win bool) {
+	if !config.SysConfig.EnableMetric() {
+		return
+	}
+	result := "lose"
+	if win {
+		result = "win"
+	}
+	prom.HedgeRequestCnt.WithLabelValues(u.Host, result).Inc()
+}
+
+// fetch 从上游u下载[当前位置, endPos)并按顺序输出，每次读取后按带宽限制等待，stats统计读取的数据量和等待时间
+func (rr *remoteRange) fetch(ctx context.Context, u *upstream.Upstream, stats *fetchStats) (int, error) {
+	from := rr.pos()
+	if from >= rr.endPos {
+		return http.StatusPartialContent, nil
+	}
+	headers := make(map[string]string)
+	if rr.task.authorization != "" {
+		headers["authorization"] = rr.task.authorization
+	}
+	headers["range"] = fmt.Sprintf("bytes=%d-%d", from, rr.endPos-1)
+	var (
+		statusCode int
+		readErr    error
+	)
+	err := util.GetStream(ctx, u.Url+rr.task.hfPath, headers, config.SysConfig.GetReqTimeOut(), func(resp *http.Response) {
+		statusCode = resp.StatusCode
+		if upstream.IsFailure(statusCode) {
+			return
+		}
+		if statusCode != http.StatusOK && statusCode != http.StatusPartialContent {
+			// 其他上游的结果相同，不再切换，也不能将错误内容作为文件数据
+			zap.S().Errorf("file:%s, task %d, req remote statusCode:%d", rr.task.FileName, rr.task.TaskNo, statusCode)
+			return
+		}
+		if from > 0 {
+			// 从中间位置请求时，上游忽略Range或返回的起始位置不符都会使数据错位，视为该上游失败
+			contentRange := resp.Header.Get("content-range")
+			if statusCode != http.StatusPartialContent || contentRangeStart(contentRange) != from {
+				readErr = fmt.Errorf("upstream %s returned statusCode:%d, content-range:%q for range from %d", u.Host, statusCode, contentRange, from)
+				zap.S().Errorf("file:%s, task %d, %v", rr.task.FileName, rr.task.TaskNo, readErr)
+				return
+			}
+		}
+		contentEncoding := resp.Header.Get("content-encoding")
+		if contentLengthStr := resp.Header.Get("content-length"); contentEncoding == "" && contentLengthStr != "" {
+			if contentLength, err := strconv.ParseInt(contentLengthStr, 10, 64); err != nil || contentLength != rr.endPos-from {
+				zap.S().Errorf("file:%s, taskNo:%d,The content of the response is incomplete. Expected-%d. Accepted-%s", rr.task.FileName, rr.task.TaskNo, rr.endPos-from, contentLengthStr)
+			}
+		}
+		var (
+			rawData   []byte
+			throttled time.Duration
+			blocked   time.Duration
+		)
+		pos := from
+		start := time.Now()
+		defer func() {
+			// 等待带宽及等待客户端读取的时间不计入上游的吞吐
+			observeThroughput(u, pos-from+int64(len(rawData)), time.Since(start)-throttled-blocked)
+		}()
+		for {
+			chunk := make([]byte, config.SysConfig.Download.RespChunkSize)
+			n, err := resp.Body.Read(chunk)
+			if n > 0 {
+				stats.read.Add(int64(n))
+				if config.SysConfig.EnableMetric() {
+					prom.PromRemoteByteCounter(rr.source, u.Host, int64(n))
+				}
+				if contentEncoding != "" { // 数据有编码，先收集，后面解码
+					rawData = append(rawData, chunk[:n]...)
+				} else {
+					d := rr.forward(ctx, pos, chunk[:n])
+					blocked += d
+					stats.blocked.Add(int64(d))
+					pos += int64(n)
+				}
+				d, waitErr := waitBandwidth(ctx, u, rr.task.flowId, n)
+				throttled += d
+				stats.throttled.Add(int64(d))
+				if waitErr != nil {
+					readErr = waitErr
+					return
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					zap.S().Errorf("file:%s, task %d, req remote %s err.%v", rr.task.FileName, rr.task.TaskNo, u.Host, err)
+				}
+				readErr = err
+				return
+			}
+		}
+		if contentEncoding != "" {
+			finalData, err := util.DecompressData(rawData, contentEncoding)
+			if err != nil {
+				zap.S().Errorf("DecompressData err.%v", err)
+				readErr = err
+				return
+			}
+			d := rr.forward(ctx, from, finalData) // 返回解码后的数据流
+			blocked += d
+			stats.blocked.Add(int64(d))
+		}
+	})
+	if err != nil {
+		return statusCode, err
+	}
+	if readErr == nil && ctx.Err() != nil {
+		readErr = ctx.Err()
+	}
+	return statusCode, readErr
+}
+
+// contentRangeStart 返回Content-Range头（如bytes 100-199/1000）中的起始位置，格式不正确时返回-1
+func contentRangeStart(contentRange string) int64 {
+	spec, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return -1
+	}
+	startStr, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return -1
+	}
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
@@ -0,0 +1,143 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"dingospeed/pkg/config"
+)
+
+// 优先上游过慢时向另一个上游发起对冲请求，先完成的对冲请求胜出，原请求被取消，输出的数据不重复
+func TestHedgeSlowRange(t *testing.T) {
+	threshold, window := config.SysConfig.Upstream.HedgeThroughput, config.SysConfig.Upstream.HedgeWindow
+	config.SysConfig.Upstream.HedgeThroughput = 1024 * 1024
+	config.SysConfig.Upstream.HedgeWindow = 1
+	t.Cleanup(func() {
+		config.SysConfig.Upstream.HedgeThroughput, config.SysConfig.Upstream.HedgeWindow = threshold, window
+	})
+
+	hfPath := "/test/repo/resolve/main/hedge"
+	content := testContent(64 * testChunkSize)
+	slowRequests := hub.addWithDelay(hfPath, content, 50*time.Millisecond)
+	fastRequests := mirror.add(hfPath, content)
+	aborted := hub.aborted.Load()
+
+	task := RemoteFileTask{}
+	task.Context = context.Background()
+	task.hfPath = hfPath
+	task.FileName = "hedge"
+	startPos, endPos := int64(100), int64(len(content)-100)
+	contentChan := make(chan []byte, len(content)/testChunkSize*2)
+	rr := &remoteRange{task: task, startPos: startPos, endPos: endPos, contentChan: contentChan}
+	start := time.Now()
+	rr.run()
+	close(contentChan)
+
+	var got bytes.Buffer
+	for chunk := range contentChan {
+		got.Write(chunk)
+	}
+	if !bytes.Equal(got.Bytes(), content[startPos:endPos]) {
+		t.Fatalf("got %d bytes, want %d", got.Len(), endPos-startPos)
+	}
+	// 慢速上游单独完成需要3秒以上，对冲请求应在此之前完成
+	if cost := time.Since(start); cost > 3*time.Second {
+		t.Fatalf("hedged range took %s", cost)
+	}
+	if slowRequests.Load() != 1 || fastRequests.Load() != 1 {
+		t.Fatalf("requests slow:%d fast:%d, want 1 and 1", slowRequests.Load(), fastRequests.Load())
+	}
+	deadline := time.Now().Add(time.Second)
+	for hub.aborted.Load() == aborted && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if hub.aborted.Load() == aborted {
+		t.Fatal("the slow request is not cancelled after the hedge wins")
+	}
+}
+
+// 客户端读取较慢导致的吞吐下降不触发对冲请求
+func TestSlowClientNoHedge(t *testing.T) {
+	threshold, window := config.SysConfig.Upstream.HedgeThroughput, config.SysConfig.Upstream.HedgeWindow
+	config.SysConfig.Upstream.HedgeThroughput = 1024 * 1024
+	config.SysConfig.Upstream.HedgeWindow = 1
+	t.Cleanup(func() {
+		config.SysConfig.Upstream.HedgeThroughput, config.SysConfig.Upstream.HedgeWindow = threshold, window
+	})
+
+	hfPath := "/test/repo/resolve/main/slow-client"
+	content := testContent(48 * testChunkSize)
+	requests := hub.addWithDelay(hfPath, content, 0)
+	mirrorRequests := mirror.add(hfPath, content)
+
+	task := RemoteFileTask{}
+	task.Context = context.Background()
+	task.hfPath = hfPath
+	task.FileName = "slow-client"
+	contentChan := make(chan []byte)
+	rr := &remoteRange{task: task, startPos: 0, endPos: int64(len(content)), contentChan: contentChan}
+	var got bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for chunk := range contentChan {
+			got.Write(chunk)
+			time.Sleep(50 * time.Millisecond)
+		}
+	}()
+	rr.run()
+	close(contentChan)
+	<-done
+
+	if !bytes.Equal(got.Bytes(), content) {
+		t.Fatalf("got %d bytes, want %d", got.Len(), len(content))
+	}
+	if requests.Load() != 1 || mirrorRequests.Load() != 0 {
+		t.Fatalf("requests hub:%d mirror:%d, want 1 and 0", requests.Load(), mirrorRequests.Load())
+	}
+}
+
+// 从中间位置请求时，上游忽略Range返回完整内容视为失败，切换到下一个上游，输出的数据不错位
+func TestRangeIgnoredFailover(t *testing.T) {
+	hfPath := "/test/repo/resolve/main/range-ignored"
+	content := testContent(4 * testChunkSize)
+	requests := hub.addIgnoringRange(hfPath, content)
+	mirrorRequests := mirror.add(hfPath, content)
+
+	task := RemoteFileTask{}
+	task.Context = context.Background()
+	task.hfPath = hfPath
+	task.FileName = "range-ignored"
+	startPos, endPos := int64(100), int64(len(content))
+	contentChan := make(chan []byte, len(content)/testChunkSize*2)
+	rr := &remoteRange{task: task, startPos: startPos, endPos: endPos, contentChan: contentChan}
+	rr.run()
+	close(contentChan)
+
+	var got bytes.Buffer
+	for chunk := range contentChan {
+		got.Write(chunk)
+	}
+	if !bytes.Equal(got.Bytes(), content[startPos:endPos]) {
+		t.Fatalf("got %d bytes, want %d", got.Len(), endPos-startPos)
+	}
+	if requests.Load() != 1 || mirrorRequests.Load() != 1 {
+		t.Fatalf("requests hub:%d mirror:%d, want 1 and 1", requests.Load(), mirrorRequests.Load())
+	}
+}
@@ -16,15 +16,9 @@ package downloader
 
 import (
 	"bytes"
-	"fmt"
-	"io"
-	"net/http"
-	"strconv"
 	"sync"
 
-	"dingospeed/pkg/config"
 	"dingospeed/pkg/consts"
-	"dingospeed/pkg/prom"
 	"dingospeed/pkg/util"
 
 	"go.uber.org/zap"
@@ -32,9 +26,10 @@ import (
 
 type RemoteFileTask struct {
 	DownloadTask
-	authorization string
-	hfUrl         string
-	Queue         chan []byte `json:"-"`
+	Queue          chan []byte            `json:"-"` // 为空时只写入缓存，不输出给客户端
+	inflightBlocks map[int64]*Broadcaster // 当前任务负责下载并写入缓存的数据块
+	upstreamNo     int                    // 优先使用的上游序号，开启stripe时同一文件的分段轮流使用各个上游
+	slot           *remoteSlot            // 下载期间占用的全局并发
 }
 
 func NewRemoteFileTask(taskNo int, rangeStartPos int64, rangeEndPos int64) *RemoteFileTask {
@@ -51,6 +46,15 @@ func (r RemoteFileTask) DoTask() {
 		curBlock int64
 		wg       sync.WaitGroup
 	)
+	defer r.releaseInflightBlocks()
+	if r.slot == nil {
+		r.slot = &remoteSlot{}
+	}
+	if err := r.slot.acquire(r.Context); err != nil {
+		zap.S().Warnf("file:%s/%s, task %d, wait global remote concurrency err.%v", r.orgRepo, r.FileName, r.TaskNo, err)
+		return
+	}
+	defer r.slot.release()
 	contentChan := make(chan []byte, consts.RespChanSize)
 	rangeStartPos, rangeEndPos := r.RangeStartPos, r.RangeEndPos
 	zap.S().Infof("remote file download:%s/%s, taskNo:%d, size:%d, startPos:%d, endPos:%d", r.orgRepo, r.FileName, r.TaskNo, r.TaskSize, rangeStartPos, rangeEndPos)
@@ -62,7 +66,9 @@ func (r RemoteFileTask) DoTask() {
 	blockNumber := r.DingFile.getBlockNumber()
 	go func() {
 		defer func() {
-			close(r.Queue)
+			if r.Queue != nil {
+				close(r.Queue)
+			}
 			wg.Done()
 		}()
 		for {
@@ -72,22 +78,15 @@ func (r RemoteFileTask) DoTask() {
 					if !ok {
 						return
 					}
-					// 先写到缓存
-					select {
-					case r.Queue <- chunk:
-					case <-r.Context.Done():
+					// 等待该数据块的请求先于写入缓存读取到数据
+					r.feedInflightBlocks(curPos, chunk)
+					if r.Queue != nil && !r.sendQueue(chunk) {
 						return
 					}
 
 					chunkLen := int64(len(chunk))
 					curPos += chunkLen
 
-					if config.SysConfig.EnableMetric() {
-						// 原子性地更新总下载字节数
-						source := util.Itoa(r.Context.Value(consts.PromSource))
-						prom.PromRequestByteCounter(prom.RequestRemoteByte, source, chunkLen)
-					}
-
 					if len(chunk) != 0 {
 						streamCache.Write(chunk)
 					}
@@ -115,6 +114,7 @@ func (r RemoteFileTask) DoTask() {
 								zap.S().Debugf("%s/%s, taskNo:%d, block：%d(%d)write done, range：%d-%d.", r.orgRepo, r.FileName, r.TaskNo, lastBlock, blockNumber, lastBlockStartPos, lastBlockEndPos)
 							}
 						}
+						r.releaseInflightBlock(lastBlock)
 						nextBlock := streamCacheBytes[splitPos:] // 下一个块的数据
 						streamCache.Truncate(0)
 						streamCache.Write(nextBlock)
@@ -130,8 +130,8 @@ func (r RemoteFileTask) DoTask() {
 	wg.Wait()
 	rawBlock := streamCache.Bytes()
 	if curBlock == r.DingFile.getBlockNumber()-1 {
-		// 对不足一个block的数据做补全
-		if int64(len(rawBlock)) == r.DingFile.GetFileSize()%r.DingFile.getBlockSize() {
+		// 对不足一个block的数据做补全，文件大小为块大小整数倍时最后一块不需要补全，避免未收到数据时写入全零的块
+		if tail := r.DingFile.GetFileSize() % r.DingFile.getBlockSize(); tail != 0 && int64(len(rawBlock)) == tail {
 			padding := bytes.Repeat([]byte{0}, int(r.DingFile.getBlockSize())-len(rawBlock))
 			rawBlock = append(rawBlock, padding...)
 		}
@@ -158,6 +158,50 @@ func (r RemoteFileTask) DoTask() {
 	}
 }
 
+// sendQueue 将数据放入输出队列。队列已满说明客户端读取较慢或输出顺序在前的任务尚未输出完，
+// 等待期间释放全局并发，之后重新占用，避免占用并发的任务互相等待
+func (r RemoteFileTask) sendQueue(chunk []byte) bool {
+	select {
+	case r.Queue <- chunk:
+		return true
+	default:
+	}
+	r.slot.release()
+	select {
+	case r.Queue <- chunk:
+	case <-r.Context.Done():
+		return false
+	}
+	return r.slot.acquire(r.Context) == nil
+}
+
+// feedInflightBlocks 将从pos开始的数据按数据块拆分，追加到当前任务登记的数据块
+func (r RemoteFileTask) feedInflightBlocks(pos int64, chunk []byte) {
+	blockSize := r.DingFile.getBlockSize()
+	for len(chunk) > 0 {
+		blockIndex := pos / blockSize
+		n := min(int64(len(chunk)), (blockIndex+1)*blockSize-pos)
+		feedInflightBlock(r.inflightBlocks[blockIndex], chunk[:n])
+		pos += n
+		chunk = chunk[n:]
+	}
+}
+
+// releaseInflightBlock 数据块已接收完，不再保留其广播实例，未成功写入缓存时通知等待者重新获取
+func (r RemoteFileTask) releaseInflightBlock(blockIndex int64) {
+	if b, ok := r.inflightBlocks[blockIndex]; ok {
+		r.DingFile.finishInflightBlock(blockIndex, b, false)
+		delete(r.inflightBlocks, blockIndex)
+	}
+}
+
+// releaseInflightBlocks 任务结束时，通知仍在等待未成功写入的数据块的请求
+func (r RemoteFileTask) releaseInflightBlocks() {
+	for blockIndex, b := range r.inflightBlocks {
+		r.DingFile.finishInflightBlock(blockIndex, b, false)
+	}
+}
+
 func (r RemoteFileTask) OutResult() {
 	for {
 		select {
@@ -184,81 +228,16 @@ func (r RemoteFileTask) GetResponseChan() chan []byte {
 }
 
 func (r RemoteFileTask) getFileRangeFromRemote(wg *sync.WaitGroup, startPos, endPos int64, contentChan chan<- []byte) {
-	headers := make(map[string]string)
-	if r.authorization != "" {
-		headers["authorization"] = r.authorization
-	}
-	headers["range"] = fmt.Sprintf("bytes=%d-%d", startPos, endPos-1)
 	defer func() {
 		close(contentChan)
 		wg.Done()
 	}()
-	var rawData []byte
-	chunkByteLen := 0
-	var contentEncoding, contentLengthStr = "", ""
-
-	if err := util.GetStream(r.hfUrl, headers, config.SysConfig.GetReqTimeOut(), func(resp *http.Response) {
-		contentEncoding = resp.Header.Get("content-encoding")
-		contentLengthStr = resp.Header.Get("content-length")
-		for {
-			select {
-			case <-r.Context.Done():
-				zap.S().Warnf("getFileRangeFromRemote Context.Done err :%s", r.FileName)
-				return
-			default:
-				chunk := make([]byte, config.SysConfig.Download.RespChunkSize)
-				n, err := resp.Body.Read(chunk)
-				if n > 0 {
-					if contentEncoding != "" { // 数据有编码，先收集，后面解码
-						rawData = append(rawData, chunk[:n]...)
-					} else {
-						select {
-						case contentChan <- chunk[:n]:
-						case <-r.Context.Done():
-							return
-						}
-					}
-					chunkByteLen += n // 原始数量
-				}
-				if err != nil {
-					if err == io.EOF {
-						return
-					}
-					zap.S().Errorf("file:%s, task %d, req remote err.%v", r.FileName, r.TaskNo, err)
-					return
-				}
-			}
-		}
-	}); err != nil {
-		zap.S().Errorf("GetStream err.%v", err)
-		return
-	}
-	if contentEncoding != "" {
-		// 这里需要实现解压缩逻辑
-		finalData, err := util.DecompressData(rawData, contentEncoding)
-		if err != nil {
-			zap.S().Errorf("DecompressData err.%v", err)
-			return
-		}
-		contentChan <- finalData      // 返回解码后的数据流
-		chunkByteLen = len(finalData) // 将解码后的长度复制为原理的chunkBytes
-	}
-	if contentLengthStr != "" {
-		contentLength, err := strconv.Atoi(contentLengthStr) // 原始数据长度
-		if err != nil {
-			zap.S().Errorf("contentLengthStr conv err.%s", contentLengthStr)
-			return
-		}
-		if contentEncoding != "" {
-			contentLength = chunkByteLen
-		}
-		if endPos-startPos != int64(contentLength) {
-			zap.S().Errorf("file:%s, taskNo:%d,The content of the response is incomplete. Expected-%d. Accepted-%d", r.FileName, r.TaskNo, endPos-startPos, contentLength)
-			return
-		}
-	}
-	if endPos-startPos != int64(chunkByteLen) {
-		zap.S().Warnf("file:%s, taskNo:%d,The block is incomplete. Expected-%d. Accepted-%d", r.FileName, r.TaskNo, endPos-startPos, chunkByteLen)
-		return
+	rr := &remoteRange{
+		task:        r,
+		startPos:    startPos,
+		endPos:      endPos,
+		contentChan: contentChan,
+		source:      util.Itoa(r.Context.Value(consts.PromSource)),
 	}
+	rr.run()
 }
@@ -14,6 +14,49 @@
 
 package downloader
 
-import "dingospeed/pkg/common"
+import (
+	"dingospeed/pkg/common"
+)
 
+// RespNoticeMap 正在从远端下载的数据块，key为数据块的key，等待该块的请求从广播实例读取已到达的数据
 var RespNoticeMap = common.NewSafeMap[string, *Broadcaster]()
+
+// registerInflightBlock 将数据块登记为下载中，调用方需持有inflightLock
+func (c *DingCache) registerInflightBlock(blockIndex int64) *Broadcaster {
+	b := NewBroadcaster()
+	RespNoticeMap.Set(c.getBlockKey(blockIndex), b)
+	return b
+}
+
+// getInflightBlock 返回正在下载该数据块的广播实例，没有时返回nil，调用方需持有inflightLock
+func (c *DingCache) getInflightBlock(blockIndex int64) *Broadcaster {
+	b, _ := RespNoticeMap.Get(c.getBlockKey(blockIndex))
+	return b
+}
+
+// isInflightBlock 判断数据块是否正在被其他请求下载，调用方需持有inflightLock
+func (c *DingCache) isInflightBlock(blockIndex int64) bool {
+	return c.getInflightBlock(blockIndex) != nil
+}
+
+// feedInflightBlock 将下载的数据追加到数据块的广播实例，b为空时不处理
+func feedInflightBlock(b *Broadcaster, chunk []byte) {
+	if b != nil {
+		b.Write(chunk)
+	}
+}
+
+// finishInflightBlock 数据块下载结束（成功写入或下载失败），通知所有等待者。
+// b不为空时，只有登记的广播实例与b一致才会处理，避免误关闭其他请求登记的实例。
+func (c *DingCache) finishInflightBlock(blockIndex int64, b *Broadcaster, done bool) {
+	key := c.getBlockKey(blockIndex)
+	c.inflightLock.Lock()
+	registered, ok := RespNoticeMap.Get(key)
+	if ok && (b == nil || registered == b) {
+		RespNoticeMap.Delete(key)
+	}
+	c.inflightLock.Unlock()
+	if ok && (b == nil || registered == b) {
+		registered.Close(done)
+	}
+}
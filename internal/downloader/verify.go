@@ -0,0 +1,298 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package downloader
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	cache "dingospeed/internal/data"
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/prom"
+	"dingospeed/pkg/util"
+
+	"go.uber.org/zap"
+)
+
+const (
+	BlobVerifyStatusUnknown    = "unknown"    // 本次启动后尚未校验
+	BlobVerifyStatusIncomplete = "incomplete" // 数据块未全部缓存
+	BlobVerifyStatusVerifying  = "verifying"
+	BlobVerifyStatusVerified   = "verified"
+	BlobVerifyStatusMismatch   = "mismatch" // 内容与oid不一致，已隔离
+	BlobVerifyStatusFailed     = "failed"   // 校验过程出错
+	BlobVerifyStatusSkipped    = "skipped"  // 文件名不是sha256或git sha1，无法校验
+
+	verifyAlgorithmSha256  = "sha256"   // lfs文件的oid
+	verifyAlgorithmGitSha1 = "git-sha1" // 普通文件的oid，为git blob对象的sha1
+)
+
+// BlobVerifyInfo blob文件的完整性校验状态
+type BlobVerifyInfo struct {
+	Oid        string `json:"oid"`
+	Size       int64  `json:"size"`
+	Algorithm  string `json:"algorithm,omitempty"`
+	Status     string `json:"status"`
+	Actual     string `json:"actual,omitempty"`
+	Message    string `json:"message,omitempty"`
+	VerifyTime int64  `json:"verifyTime,omitempty"`
+}
+
+var (
+	blobVerifyLock  sync.Mutex
+	blobVerifyInfos = make(map[string]*BlobVerifyInfo)
+)
+
+// GetBlobVerifyInfo 返回blob文件最近一次的校验状态
+func GetBlobVerifyInfo(blobsFile string) (BlobVerifyInfo, bool) {
+	blobVerifyLock.Lock()
+	defer blobVerifyLock.Unlock()
+	if info, ok := blobVerifyInfos[blobsFile]; ok {
+		return *info, true
+	}
+	return BlobVerifyInfo{}, false
+}
+
+// StartBlobVerify 异步校验blob文件，已在校验中的文件不重复校验
+func StartBlobVerify(blobsFile string) bool {
+	blobVerifyLock.Lock()
+	defer blobVerifyLock.Unlock()
+	if info, ok := blobVerifyInfos[blobsFile]; ok && info.Status == BlobVerifyStatusVerifying {
+		return false
+	}
+	blobVerifyInfos[blobsFile] = &BlobVerifyInfo{Oid: filepath.Base(blobsFile), Status: BlobVerifyStatusVerifying}
+	go VerifyBlob(blobsFile)
+	return true
+}
+
+func setBlobVerifyInfo(blobsFile string, info *BlobVerifyInfo) {
+	info.VerifyTime = time.Now().Unix()
+	blobVerifyLock.Lock()
+	blobVerifyInfos[blobsFile] = info
+	blobVerifyLock.Unlock()
+	if config.SysConfig.EnableMetric() {
+		prom.BlobVerifyCnt.WithLabelValues(info.Status).Inc()
+	}
+}
+
+// VerifyBlob 计算blob文件完整内容的摘要并与文件名（即oid）比较，不一致时隔离该文件。
+// lfs文件的oid为内容的sha256，普通文件的oid为git blob对象的sha1。
+// 开启materializeBlob时，校验的同时生成不带头部的普通文件，校验通过后替换缓存文件。
+func VerifyBlob(blobsFile string) {
+	oid := filepath.Base(blobsFile)
+	info := &BlobVerifyInfo{Oid: oid}
+	defer setBlobVerifyInfo(blobsFile, info)
+	h, prefix, algorithm := newOidHash(oid)
+	if h == nil {
+		info.Status = BlobVerifyStatusSkipped
+		return
+	}
+	info.Algorithm = algorithm
+	if !util.FileExists(blobsFile) {
+		info.Status = BlobVerifyStatusFailed
+		info.Message = "blob file not exist"
+		return
+	}
+	if !IsCacheFile(blobsFile) {
+		verifyPlainBlob(blobsFile, h, prefix, info)
+		return
+	}
+	dingCacheManager := GetInstance()
+	dingFile, err := dingCacheManager.GetDingFile(blobsFile, 0)
+	if err != nil {
+		info.Status = BlobVerifyStatusFailed
+		info.Message = err.Error()
+		return
+	}
+	defer dingCacheManager.ReleasedDingFile(blobsFile)
+	info.Size = dingFile.GetFileSize()
+	if !dingFile.isComplete() {
+		info.Status = BlobVerifyStatusIncomplete
+		return
+	}
+	startTime := time.Now()
+	plain := createPlainBlob(blobsFile)
+	actual, err := dingFile.digest(h, prefix(info.Size), plain)
+	finishPlainBlob(blobsFile, plain, err == nil && actual == oid)
+	if err != nil {
+		zap.S().Errorf("verify blob %s err.%v", blobsFile, err)
+		info.Status = BlobVerifyStatusFailed
+		info.Message = err.Error()
+		return
+	}
+	if actual == oid {
+		zap.S().Infof("verify blob %s success, size:%d, cost:%s", blobsFile, info.Size, time.Since(startTime))
+		info.Status = BlobVerifyStatusVerified
+		return
+	}
+	quarantineBlob(blobsFile, actual, info, dingFile.quarantine)
+}
+
+// verifyPlainBlob 校验已转换的普通文件，不一致时直接移至隔离目录，正在读取的请求持有文件句柄，不受影响
+func verifyPlainBlob(blobsFile string, h hash.Hash, prefix func(size int64) []byte, info *BlobVerifyInfo) {
+	f, err := os.Open(blobsFile)
+	if err != nil {
+		info.Status = BlobVerifyStatusFailed
+		info.Message = err.Error()
+		return
+	}
+	defer f.Close()
+	if stat, err := f.Stat(); err == nil {
+		info.Size = stat.Size()
+	}
+	actual, err := sumOid(h, prefix(info.Size), f, nil)
+	if err != nil {
+		info.Status = BlobVerifyStatusFailed
+		info.Message = err.Error()
+		return
+	}
+	if actual == info.Oid {
+		info.Status = BlobVerifyStatusVerified
+		return
+	}
+	quarantineBlob(blobsFile, actual, info, func(quarantinePath string) error {
+		if err := util.MakeDirs(quarantinePath); err != nil {
+			return err
+		}
+		return os.Rename(blobsFile, quarantinePath)
+	})
+}
+
+// quarantineBlob 记录校验不一致的结果，并将blob移至隔离目录
+func quarantineBlob(blobsFile, actual string, info *BlobVerifyInfo, move func(quarantinePath string) error) {
+	info.Status = BlobVerifyStatusMismatch
+	info.Actual = actual
+	quarantinePath, err := getQuarantinePath(blobsFile)
+	if err == nil {
+		err = move(quarantinePath)
+	}
+	if err != nil {
+		zap.S().Errorf("blob %s %s mismatch, actual:%s, quarantine err.%v", blobsFile, info.Algorithm, actual, err)
+		info.Message = fmt.Sprintf("quarantine err: %v", err)
+		return
+	}
+	zap.S().Errorf("blob %s %s mismatch, actual:%s, moved to %s", blobsFile, info.Algorithm, actual, quarantinePath)
+	info.Message = fmt.Sprintf("quarantined to %s", quarantinePath)
+}
+
+// sumOid 计算内容的摘要，w不为空时同时将内容写入w
+func sumOid(h hash.Hash, prefix []byte, r io.Reader, w io.Writer) (string, error) {
+	h.Write(prefix)
+	var dst io.Writer = h
+	if w != nil {
+		dst = io.MultiWriter(h, w)
+	}
+	if _, err := io.Copy(dst, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// newOidHash 根据oid的长度选择摘要算法，prefix返回计算摘要前需要写入的内容
+func newOidHash(oid string) (hash.Hash, func(size int64) []byte, string) {
+	if _, err := hex.DecodeString(oid); err != nil {
+		return nil, nil, ""
+	}
+	switch len(oid) {
+	case sha256.Size * 2:
+		return sha256.New(), func(int64) []byte { return nil }, verifyAlgorithmSha256
+	case sha1.Size * 2:
+		return sha1.New(), func(size int64) []byte { return []byte(fmt.Sprintf("blob %d\x00", size)) }, verifyAlgorithmGitSha1
+	}
+	return nil, nil, ""
+}
+
+// getQuarantinePath 隔离目录与files目录结构保持一致，文件名追加隔离时间，避免多次隔离时互相覆盖
+func getQuarantinePath(blobsFile string) (string, error) {
+	relPath, err := filepath.Rel(config.SysConfig.Repos(), blobsFile)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(relPath, "..") {
+		return "", errors.New("blob file is not in repos dir")
+	}
+	return fmt.Sprintf("%s.%d", filepath.Join(config.SysConfig.Repos(), "quarantine", relPath), time.Now().Unix()), nil
+}
+
+// isComplete 所有数据块是否均已缓存
+func (c *DingCache) isComplete() bool {
+	c.headerLock.RLock()
+	defer c.headerLock.RUnlock()
+	for i := int64(0); i < c.header.BlockNumber; i++ {
+		if ok, err := c.header.BlockMask.Test(i); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// digest 计算缓存文件数据部分的摘要，w不为空时同时将数据写入w
+func (c *DingCache) digest(h hash.Hash, prefix []byte, w *os.File) (string, error) {
+	f, err := os.OpenFile(c.path, os.O_RDONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err = f.Seek(c.getHeaderSize(), 0); err != nil {
+		return "", err
+	}
+	if w == nil {
+		return sumOid(h, prefix, io.LimitReader(f, c.GetFileSize()), nil)
+	}
+	return sumOid(h, prefix, io.LimitReader(f, c.GetFileSize()), w)
+}
+
+// quarantine 将校验失败的缓存文件移至隔离目录，并在原路径重建空的缓存文件，后续请求会重新从远端获取
+func (c *DingCache) quarantine(quarantinePath string) error {
+	c.fileLock.Lock()
+	defer c.fileLock.Unlock()
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+	if err := util.MakeDirs(quarantinePath); err != nil {
+		return err
+	}
+	if err := os.Rename(c.path, quarantinePath); err != nil {
+		return err
+	}
+	header := NewDingCacheHeader(CURRENT_OLAH_CACHE_VERSION, c.header.BlockSize, c.header.FileSize)
+	f, err := os.OpenFile(c.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = header.Write(f); err != nil {
+		return err
+	}
+	if err = f.Truncate(header.GetHeaderSize() + header.FileSize); err != nil {
+		return err
+	}
+	if config.SysConfig.Cache.Enabled {
+		for i := int64(0); i < header.BlockNumber; i++ {
+			cache.FileBlockCache.Delete(c.getBlockKey(i))
+		}
+	}
+	c.header = header
+	return nil
+}
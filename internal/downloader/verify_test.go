@@ -0,0 +1,77 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package downloader
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"dingospeed/pkg/config"
+)
+
+// 内容与oid不一致的blob被隔离，之后的请求不再使用已缓存的内容
+func TestMismatchedBlobQuarantined(t *testing.T) {
+	content := testContent(2*testBlockSize + 7)
+	sha256Sum := sha256.Sum256(content)
+	gitSha1 := sha1.New()
+	fmt.Fprintf(gitSha1, "blob %d\x00", len(content))
+	gitSha1.Write(content)
+	otherSha256 := sha256.Sum256([]byte("other"))
+	otherSha1 := sha1.Sum([]byte("other"))
+	for _, tc := range []struct {
+		name      string
+		oid       string
+		algorithm string
+		status    string
+	}{
+		{"sha256", hex.EncodeToString(sha256Sum[:]), verifyAlgorithmSha256, BlobVerifyStatusVerified},
+		{"sha256 mismatch", hex.EncodeToString(otherSha256[:]), verifyAlgorithmSha256, BlobVerifyStatusMismatch},
+		{"git-sha1", hex.EncodeToString(gitSha1.Sum(nil)), verifyAlgorithmGitSha1, BlobVerifyStatusVerified},
+		{"git-sha1 mismatch", hex.EncodeToString(otherSha1[:]), verifyAlgorithmGitSha1, BlobVerifyStatusMismatch},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			blobsFile := filepath.Join(newTestRepo(t), tc.oid)
+			hfPath := "/test/repo/resolve/main/" + tc.oid
+			requests := hub.add(hfPath, content)
+			download(context.Background(), blobsFile, hfPath, int64(len(content)), 0, int64(len(content)))
+			info := waitBlobVerify(t, blobsFile)
+			if info.Status != tc.status || info.Algorithm != tc.algorithm {
+				t.Fatalf("verify status = %s/%s, want %s/%s", info.Status, info.Algorithm, tc.status, tc.algorithm)
+			}
+			quarantined, _ := filepath.Glob(filepath.Join(config.SysConfig.Repos(), "quarantine", "blobs", tc.oid+".*"))
+			cached := IsBlobCached(blobsFile, int64(len(content)))
+			if tc.status == BlobVerifyStatusVerified {
+				if len(quarantined) != 0 || !cached {
+					t.Fatalf("verified blob quarantined:%v, cached:%v", quarantined, cached)
+				}
+				return
+			}
+			if len(quarantined) != 1 || cached {
+				t.Fatalf("mismatched blob quarantined:%v, cached:%v", quarantined, cached)
+			}
+			// 隔离后原路径为空的缓存文件，再次请求时从远端获取
+			download(context.Background(), blobsFile, hfPath, int64(len(content)), 0, int64(len(content)))
+			if got := requests.Load(); got != 2 {
+				t.Fatalf("upstream requests = %d, want 2", got)
+			}
+			waitBlobVerify(t, blobsFile)
+		})
+	}
+}
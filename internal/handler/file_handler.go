@@ -41,96 +41,62 @@ func NewFileHandler(fileService *service.FileService, sysService *service.SysSer
 	}
 }
 
-func (handler *FileHandler) HeadFileHandler1(c echo.Context) error {
-	repoType, org, repo, commit, filePath, err := paramProcess(c, 1)
+func (handler *FileHandler) HeadFileHandler(c echo.Context) error {
+	repoType, org, repo, commit, filePath, err := ResolveParams(c)
 	if err != nil {
-		zap.S().Error("解码出错:%v", err)
+		zap.S().Errorf("解码出错:%v", err)
 		return util.ErrorRequestParam(c)
 	}
 	return handler.fileService.FileHeadCommon(c, repoType, org, repo, commit, filePath)
 }
 
-func (handler *FileHandler) HeadFileHandler2(c echo.Context) error {
-	repoType, org, repo, commit, filePath, err := paramProcess(c, 2)
+func (handler *FileHandler) GetFileHandler(c echo.Context) error {
+	repoType, org, repo, commit, filePath, err := ResolveParams(c)
 	if err != nil {
-		zap.S().Error("解码出错:%v", err)
+		zap.S().Errorf("解码出错:%v", err)
 		return util.ErrorRequestParam(c)
 	}
-	return handler.fileService.FileHeadCommon(c, repoType, org, repo, commit, filePath)
-}
-
-func (handler *FileHandler) HeadFileHandler3(c echo.Context) error {
-	repoType, org, repo, commit, filePath, err := paramProcess(c, 3)
-	if err != nil {
-		zap.S().Error("解码出错:%v", err)
-		return util.ErrorRequestParam(c)
-	}
-	return handler.fileService.FileHeadCommon(c, repoType, org, repo, commit, filePath)
+	return handler.fileGetCommon(c, repoType, org, repo, commit, filePath)
 }
 
-func paramProcess(c echo.Context, processMode int) (string, string, string, string, string, error) {
+// ResolveParams 解析resolve路由的参数，路由见router.repoRoutes：
+// /{repoType}/{org}/{repo}、/{orgOrRepoType}/{repo}、/{repo}，第二种首段为仓库类型时为没有org的数据集或空间，否则为模型。
+func ResolveParams(c echo.Context) (string, string, string, string, string, error) {
 	var (
-		repoType string
-		org      string
-		repo     string
-		commit   string
-		filePath string
-	)
-	if processMode == 1 {
 		repoType = c.Param("repoType")
-		org = c.Param("org")
-		repo = c.Param("repo")
-		commit = c.Param("commit")
-		filePath = c.Param("filePath")
-	} else if processMode == 2 {
-		orgOrRepoType := c.Param("orgOrRepoType")
-		repo = c.Param("repo")
-		commit = c.Param("commit")
-		filePath = c.Param("filePath")
+		org      = c.Param("org")
+		repo     = c.Param("repo")
+	)
+	if orgOrRepoType := c.Param("orgOrRepoType"); orgOrRepoType != "" {
 		if _, ok := consts.RepoTypesMapping[orgOrRepoType]; ok {
 			repoType = orgOrRepoType
-			org = ""
 		} else {
-			repoType = "models"
 			org = orgOrRepoType
 		}
-	} else if processMode == 3 {
-		repo = c.Param("repo")
-		commit = c.Param("commit")
-		filePath = c.Param("filePath")
+	}
+	if repoType == "" {
 		repoType = "models"
-	} else {
-		panic("param process error.")
 	}
-	filePath, err := url.QueryUnescape(filePath)
-	return repoType, org, repo, commit, filePath, err
-}
-
-func (handler *FileHandler) GetFileHandler1(c echo.Context) error {
-	repoType, org, repo, commit, filePath, err := paramProcess(c, 1)
+	commit, err := unescapeParam(c, c.Param("commit"))
 	if err != nil {
-		zap.S().Error("解码出错:%v", err)
-		return util.ErrorRequestParam(c)
+		return "", "", "", "", "", err
 	}
-	return handler.fileGetCommon(c, repoType, org, repo, commit, filePath)
-}
-
-func (handler *FileHandler) GetFileHandler2(c echo.Context) error {
-	repoType, org, repo, commit, filePath, err := paramProcess(c, 2)
+	filePath, err := unescapeParam(c, c.Param("*"))
 	if err != nil {
-		zap.S().Error("解码出错:%v", err)
-		return util.ErrorRequestParam(c)
+		return "", "", "", "", "", err
 	}
-	return handler.fileGetCommon(c, repoType, org, repo, commit, filePath)
+	if !util.ValidRepoPath(filePath) {
+		return "", "", "", "", "", fmt.Errorf("invalid file path %q", filePath)
+	}
+	return repoType, org, repo, commit, filePath, nil
 }
 
-func (handler *FileHandler) GetFileHandler3(c echo.Context) error {
-	repoType, org, repo, commit, filePath, err := paramProcess(c, 3)
-	if err != nil {
-		zap.S().Error("解码出错:%v", err)
-		return util.ErrorRequestParam(c)
+// unescapeParam 路径中有转义字符（如%2F）时，echo按原始路径匹配路由，参数需要解码；否则参数已是解码后的值
+func unescapeParam(c echo.Context, v string) (string, error) {
+	if c.Request().URL.RawPath == "" {
+		return v, nil
 	}
-	return handler.fileGetCommon(c, repoType, org, repo, commit, filePath)
+	return url.PathUnescape(v)
 }
 
 func (handler *FileHandler) fileGetCommon(c echo.Context, repoType, org, repo, commit, filePath string) error {
@@ -0,0 +1,128 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// 文件按文件名返回Content-Type，lfs文件与huggingface.co一致返回x-linked-size和x-linked-etag
+func TestResolveGet(t *testing.T) {
+	e := newTestEcho(t)
+	for _, tc := range []struct {
+		name        string
+		contentType string
+	}{
+		{"config.json", "application/json"},
+		{"model.safetensors", "application/octet-stream"},
+	} {
+		f := hubFiles[tc.name]
+		rec := serve(e, http.MethodGet, "/org/repo/resolve/main/"+tc.name, "")
+		if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), f.content) {
+			t.Fatalf("%s: %d, %d bytes, want 200 and %d bytes", tc.name, rec.Code, rec.Body.Len(), len(f.content))
+		}
+		checkFileHeaders(t, tc.name, rec.Header(), tc.contentType, f)
+	}
+}
+
+// HEAD请求返回与GET相同的响应头，响应体为空
+func TestResolveHead(t *testing.T) {
+	e := newTestEcho(t)
+	for _, tc := range []struct {
+		name        string
+		contentType string
+	}{
+		{"config.json", "application/json"},
+		{"model.safetensors", "application/octet-stream"},
+	} {
+		rec := serve(e, http.MethodHead, "/org/repo/resolve/main/"+tc.name, "")
+		if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+			t.Fatalf("%s: %d, body %q, want 200 and an empty body", tc.name, rec.Code, rec.Body)
+		}
+		checkFileHeaders(t, tc.name, rec.Header(), tc.contentType, hubFiles[tc.name])
+	}
+	// HEAD请求不下载文件
+	if n := hub.count("/org/repo/resolve/" + testSha + "/model.safetensors"); n != 0 {
+		t.Fatalf("HEAD downloads the file %d times", n)
+	}
+}
+
+func checkFileHeaders(t *testing.T, name string, header http.Header, contentType string, f hubFile) {
+	t.Helper()
+	want := map[string]string{
+		"Content-Type":   contentType,
+		"Content-Length": strconv.Itoa(len(f.content)),
+		"Accept-Ranges":  "bytes",
+		"Etag":           fmt.Sprintf("%q", f.oid()),
+		"X-Repo-Commit":  testSha,
+		"X-Linked-Size":  "",
+		"X-Linked-Etag":  "",
+		"Location":       "",
+	}
+	if f.lfs {
+		want["X-Linked-Size"] = strconv.Itoa(len(f.content))
+		want["X-Linked-Etag"] = fmt.Sprintf("%q", f.oid())
+	}
+	for k, v := range want {
+		if got := header.Get(k); got != v {
+			t.Errorf("%s header %s = %q, want %q", name, k, got, v)
+		}
+	}
+}
+
+// 多个区间以multipart/byteranges返回，Content-Length与响应体一致
+func TestResolveMultiRange(t *testing.T) {
+	e := newTestEcho(t)
+	f := hubFiles["model.safetensors"]
+	req := httptest.NewRequest(http.MethodGet, "/org/repo/resolve/main/model.safetensors", nil)
+	req.Header.Set("Range", "bytes=0-9,100-199,-5")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("multi-range: %d, want 206", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(rec.Body.Len()) {
+		t.Fatalf("Content-Length %s, body length %d", got, rec.Body.Len())
+	}
+	mediaType, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("Content-Type %q, err %v", rec.Header().Get("Content-Type"), err)
+	}
+	size := len(f.content)
+	reader := multipart.NewReader(rec.Body, params["boundary"])
+	for i, r := range [][2]int{{0, 10}, {100, 200}, {size - 5, size}} {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatalf("part %d err.%v", i, err)
+		}
+		if got, want := part.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-%d/%d", r[0], r[1]-1, size); got != want {
+			t.Fatalf("part %d Content-Range %q, want %q", i, got, want)
+		}
+		if data, err := io.ReadAll(part); err != nil || !bytes.Equal(data, f.content[r[0]:r[1]]) {
+			t.Fatalf("part %d got %q, err %v", i, data, err)
+		}
+	}
+	if _, err = reader.NextPart(); err != io.EOF {
+		t.Fatalf("after the last part err = %v, want EOF", err)
+	}
+}
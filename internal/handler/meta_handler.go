@@ -17,9 +17,12 @@ package handler
 import (
 	"strings"
 
+	"dingospeed/internal/model"
 	"dingospeed/internal/service"
+	"dingospeed/pkg/util"
 
 	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
 )
 
 type MetaHandler struct {
@@ -36,11 +39,89 @@ func (handler *MetaHandler) MetaProxyCommonHandler(c echo.Context) error {
 	repoType := c.Param("repoType")
 	org := c.Param("org")
 	repo := c.Param("repo")
-	commit := c.Param("commit")
+	commit, err := unescapeParam(c, c.Param("commit"))
+	if err != nil {
+		return util.ErrorRequestParam(c)
+	}
 	method := strings.ToLower(c.Request().Method)
 	return handler.metaService.MetaProxyCommon(c, repoType, org, repo, commit, method)
 }
 
+func (handler *MetaHandler) TreeHandler(c echo.Context) error {
+	repoType := c.Param("repoType")
+	org := c.Param("org")
+	repo := c.Param("repo")
+	commit, err := unescapeParam(c, c.Param("commit"))
+	if err != nil {
+		return util.ErrorRequestParam(c)
+	}
+	filePath, err := unescapeParam(c, c.Param("*"))
+	if err != nil {
+		return util.ErrorRequestParam(c)
+	}
+	return handler.metaService.Tree(c, repoType, org, repo, commit, filePath)
+}
+
+func (handler *MetaHandler) PathsInfoHandler(c echo.Context) error {
+	var req model.PathsInfoRequest
+	if err := c.Bind(&req); err != nil {
+		zap.S().Warnf("bind paths-info request err.%v", err)
+		return util.ErrorRequestParam(c)
+	}
+	repoType := c.Param("repoType")
+	org := c.Param("org")
+	repo := c.Param("repo")
+	commit, err := unescapeParam(c, c.Param("commit"))
+	if err != nil {
+		return util.ErrorRequestParam(c)
+	}
+	return handler.metaService.PathsInfo(c, repoType, org, repo, commit, req.Paths, req.Expand)
+}
+
+func (handler *MetaHandler) RepoInfoHandler(c echo.Context) error {
+	return handler.metaService.RepoInfo(c, c.Param("repoType"), c.Param("org"), c.Param("repo"))
+}
+
+func (handler *MetaHandler) RefsHandler(c echo.Context) error {
+	return handler.metaService.Refs(c, c.Param("repoType"), c.Param("org"), c.Param("repo"))
+}
+
+func (handler *MetaHandler) CommitsHandler(c echo.Context) error {
+	commit, err := unescapeParam(c, c.Param("commit"))
+	if err != nil {
+		return util.ErrorRequestParam(c)
+	}
+	return handler.metaService.Commits(c, c.Param("repoType"), c.Param("org"), c.Param("repo"), commit)
+}
+
+func (handler *MetaHandler) ParquetHandler(c echo.Context) error {
+	config, err := unescapeParam(c, c.Param("config"))
+	if err != nil {
+		return util.ErrorRequestParam(c)
+	}
+	split, err := unescapeParam(c, c.Param("split"))
+	if err != nil {
+		return util.ErrorRequestParam(c)
+	}
+	return handler.metaService.Parquet(c, c.Param("repoType"), c.Param("org"), c.Param("repo"), config, split)
+}
+
+func (handler *MetaHandler) ParquetShardHandler(c echo.Context) error {
+	config, err := unescapeParam(c, c.Param("config"))
+	if err != nil {
+		return util.ErrorRequestParam(c)
+	}
+	split, err := unescapeParam(c, c.Param("split"))
+	if err != nil {
+		return util.ErrorRequestParam(c)
+	}
+	return handler.metaService.ParquetShard(c, c.Param("repoType"), c.Param("org"), c.Param("repo"), config, split, c.Param("shard"))
+}
+
+func (handler *MetaHandler) RepoListHandler(c echo.Context) error {
+	return handler.metaService.RepoList(c, c.Param("repoType"))
+}
+
 func (handler *MetaHandler) WhoamiV2Handler(c echo.Context) error {
 	return handler.metaService.WhoamiV2(c)
 }
@@ -0,0 +1,419 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dingospeed/internal/dao"
+	"dingospeed/internal/service"
+	"dingospeed/pkg/config"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	testSha  = strings.Repeat("c3", 20)
+	treePath = "/api/models/org/repo/tree/" + testSha
+)
+
+// testHub 模拟huggingface上游，按路径记录请求次数及每次paths-info请求的文件，down为true时断开连接
+type testHub struct {
+	mu        sync.Mutex
+	requests  map[string]int
+	pathsInfo [][]string
+	down      atomic.Bool
+}
+
+func (h *testHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.down.Load() {
+		panic(http.ErrAbortHandler)
+	}
+	h.mu.Lock()
+	h.requests[r.URL.Path]++
+	h.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/api/models/org/repo":
+		fmt.Fprintf(w, `{"id":"org/repo","sha":%q,"downloads":10}`, testSha)
+	case "/api/models/org/repo/refs":
+		fmt.Fprintf(w, `{"branches":[{"name":"main","ref":"refs/heads/main","targetCommit":%q}],"converts":[],"tags":[]}`, testSha)
+	case "/api/models/org/repo/revision/main":
+		fmt.Fprintf(w, `{"id":"org/repo","sha":%q,"siblings":[{"rfilename":"config.json"}]}`, testSha)
+	case treePath:
+		if r.URL.Query().Get("cursor") == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<https://huggingface.co%s?cursor=page2>; rel="next"`, treePath))
+			w.Write([]byte(`[{"type":"file","path":"config.json"}]`))
+		} else {
+			w.Write([]byte(`[{"type":"file","path":"model.bin"}]`))
+		}
+	case "/api/datasets/org/data/parquet/default/train/0.parquet":
+		w.Header().Set("Location", "https://huggingface.co/datasets/org/data/resolve/refs%2Fconvert%2Fparquet/default/train/0000.parquet")
+		w.WriteHeader(http.StatusFound)
+	case "/api/datasets/org/data/parquet/default/train/1.parquet":
+		w.WriteHeader(http.StatusOK)
+	case "/api/models/org/repo/paths-info/" + testSha:
+		var req struct {
+			Paths []string `json:"paths"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		h.mu.Lock()
+		h.pathsInfo = append(h.pathsInfo, req.Paths)
+		h.mu.Unlock()
+		items := make([]map[string]interface{}, 0, len(req.Paths))
+		for _, p := range req.Paths {
+			if f, ok := hubFiles[p]; ok {
+				items = append(items, f.pathInfo(p))
+				continue
+			}
+			items = append(items, map[string]interface{}{"type": "file", "path": p, "size": len(p), "oid": testSha})
+		}
+		json.NewEncoder(w).Encode(items)
+	default:
+		if name, ok := strings.CutPrefix(r.URL.Path, "/org/repo/resolve/"+testSha+"/"); ok {
+			if f, ok := hubFiles[name]; ok {
+				w.Header().Del("Content-Type")
+				http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(f.content))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"Revision Not Found"}`))
+	}
+}
+
+// hubFile 上游仓库中可下载的文件，lfs文件的paths-info带有lfs信息
+type hubFile struct {
+	content []byte
+	lfs     bool
+}
+
+var hubFiles = map[string]hubFile{
+	"config.json":       {content: []byte(`{"model_type":"bert"}`)},
+	"model.safetensors": {content: bytes.Repeat([]byte("weights"), 1000), lfs: true},
+}
+
+// oid 非lfs文件为git blob的sha1，lfs文件为sha256
+func (f hubFile) oid() string {
+	if f.lfs {
+		sum := sha256.Sum256(f.content)
+		return hex.EncodeToString(sum[:])
+	}
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(f.content))
+	h.Write(f.content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (f hubFile) pathInfo(p string) map[string]interface{} {
+	if !f.lfs {
+		return map[string]interface{}{"type": "file", "path": p, "size": len(f.content), "oid": f.oid()}
+	}
+	// lfs文件的oid为指针文件的git sha1
+	return map[string]interface{}{"type": "file", "path": p, "size": len(f.content), "oid": testSha,
+		"lfs": map[string]interface{}{"oid": f.oid(), "size": len(f.content), "pointerSize": 134}}
+}
+
+func (h *testHub) count(path string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.requests[path]
+}
+
+var hub = &testHub{}
+
+func TestMain(m *testing.M) {
+	server := httptest.NewServer(hub)
+	config.SysConfig = &config.Config{}
+	config.SysConfig.Upstream.Urls = []string{server.URL}
+	config.SysConfig.Retry.Attempts = 1
+	config.SysConfig.SetDefaults()
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+// newTestEcho 使用临时的repos目录，在线且上游可用，注册仓库api及文件下载的路由
+func newTestEcho(t *testing.T) *echo.Echo {
+	config.SysConfig.Server.Repos = t.TempDir()
+	config.SysConfig.Server.Online = true
+	hub.down.Store(false)
+	hub.mu.Lock()
+	hub.requests = make(map[string]int)
+	hub.pathsInfo = nil
+	hub.mu.Unlock()
+
+	fileDao := &dao.FileDao{}
+	h := NewMetaHandler(service.NewMetaService(fileDao, dao.NewMetaDao(fileDao)))
+	e := echo.New()
+	prefix := "/api/:repoType/:org/:repo"
+	e.GET(prefix+"/tree/:commit", h.TreeHandler)
+	e.GET(prefix+"/tree/:commit/*", h.TreeHandler)
+	e.POST(prefix+"/paths-info/:commit", h.PathsInfoHandler)
+	e.GET(prefix, h.RepoInfoHandler)
+	e.GET(prefix+"/refs", h.RefsHandler)
+	e.GET(prefix+"/commits/:commit", h.CommitsHandler)
+	e.HEAD(prefix+"/parquet/:config/:split/:shard", h.ParquetShardHandler)
+	e.GET("/api/:repoType", h.RepoListHandler)
+	fileHandler := NewFileHandler(service.NewFileService(fileDao), nil)
+	e.HEAD("/:orgOrRepoType/:repo/resolve/:commit/*", fileHandler.HeadFileHandler)
+	e.GET("/:orgOrRepoType/:repo/resolve/:commit/*", fileHandler.GetFileHandler)
+	return e
+}
+
+// goOffline 切换为离线，上游同时不可用，确认响应只来自缓存
+func goOffline() {
+	config.SysConfig.Server.Online = false
+	hub.down.Store(true)
+}
+
+func serve(e *echo.Echo, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// 按分支请求目录列表：只请求一次上游的版本信息，下一页地址改写为本服务的地址；离线后同一地址从缓存返回相同的内容
+func TestTreeOnlineThenOffline(t *testing.T) {
+	e := newTestEcho(t)
+	wantNext := fmt.Sprintf(`<http://example.com%s?cursor=page2>; rel="next"`, treePath)
+	check := func(stage string) {
+		rec := serve(e, http.MethodGet, "/api/models/org/repo/tree/main", "")
+		if rec.Code != http.StatusOK || rec.Body.String() != `[{"type":"file","path":"config.json"}]` {
+			t.Fatalf("%s first page: %d %s", stage, rec.Code, rec.Body)
+		}
+		if link := rec.Header().Get("Link"); link != wantNext {
+			t.Fatalf("%s link %q, want %q", stage, link, wantNext)
+		}
+		// 按Link翻页
+		rec = serve(e, http.MethodGet, treePath+"?cursor=page2", "")
+		if rec.Code != http.StatusOK || rec.Body.String() != `[{"type":"file","path":"model.bin"}]` || rec.Header().Get("Link") != "" {
+			t.Fatalf("%s second page: %d %s, link %q", stage, rec.Code, rec.Body, rec.Header().Get("Link"))
+		}
+	}
+
+	check("online")
+	if n := hub.count("/api/models/org/repo/revision/main"); n != 1 {
+		t.Fatalf("revision is requested %d times, want 1", n)
+	}
+	if n := hub.count(treePath); n != 2 {
+		t.Fatalf("tree is requested %d times, want 2", n)
+	}
+	goOffline()
+	check("offline")
+}
+
+// 无效的版本返回400，上游不存在的版本返回上游的状态码，且不按空的commit缓存
+func TestTreeRevisionErrors(t *testing.T) {
+	e := newTestEcho(t)
+	if rec := serve(e, http.MethodGet, "/api/models/org/repo/tree/..", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid revision: %d, want 400", rec.Code)
+	}
+	if rec := serve(e, http.MethodGet, "/api/models/org/repo/tree/missing", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("missing revision: %d, want 404", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(config.SysConfig.Repos(), "api", "models", "org", "repo", "tree")); !os.IsNotExist(err) {
+		t.Fatalf("tree of a missing revision is cached: %v", err)
+	}
+}
+
+// postPathsInfo 请求paths-info，返回响应中的文件路径
+func postPathsInfo(t *testing.T, e *echo.Echo, contentType, body string) []string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/models/org/repo/paths-info/main", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, contentType)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("paths-info %s: %d %s", body, rec.Code, rec.Body)
+	}
+	var items []struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+		t.Fatal(err)
+	}
+	paths := make([]string, 0, len(items))
+	for _, item := range items {
+		paths = append(paths, item.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// paths-info支持表单及json，已缓存的文件不再请求上游；离线后只返回已缓存的文件
+func TestPathsInfoOnlineThenOffline(t *testing.T) {
+	e := newTestEcho(t)
+	got := postPathsInfo(t, e, echo.MIMEApplicationForm, "paths=config.json&paths=model.bin&expand=False")
+	if !reflect.DeepEqual(got, []string{"config.json", "model.bin"}) {
+		t.Fatalf("form request returns %v", got)
+	}
+	got = postPathsInfo(t, e, echo.MIMEApplicationJSON, `{"paths":["config.json","tokenizer.json"]}`)
+	if !reflect.DeepEqual(got, []string{"config.json", "tokenizer.json"}) {
+		t.Fatalf("json request returns %v", got)
+	}
+	hub.mu.Lock()
+	batches := hub.pathsInfo
+	hub.mu.Unlock()
+	if len(batches) != 2 || len(batches[0]) != 2 || !reflect.DeepEqual(batches[1], []string{"tokenizer.json"}) {
+		t.Fatalf("upstream paths-info requests %v, want only the uncached paths", batches)
+	}
+
+	goOffline()
+	got = postPathsInfo(t, e, echo.MIMEApplicationJSON, `{"paths":["config.json","model.bin","tokenizer.json","missing.json"]}`)
+	if !reflect.DeepEqual(got, []string{"config.json", "model.bin", "tokenizer.json"}) {
+		t.Fatalf("offline request returns %v", got)
+	}
+}
+
+// 仓库信息及refs离线后从缓存返回在线时上游的内容
+func TestRepoInfoOnlineThenOffline(t *testing.T) {
+	e := newTestEcho(t)
+	targets := []string{"/api/models/org/repo", "/api/models/org/repo/refs"}
+	online := make(map[string]string, len(targets))
+	for _, target := range targets {
+		rec := serve(e, http.MethodGet, target, "")
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), testSha) {
+			t.Fatalf("online %s: %d %s", target, rec.Code, rec.Body)
+		}
+		online[target] = rec.Body.String()
+	}
+	goOffline()
+	for _, target := range targets {
+		if rec := serve(e, http.MethodGet, target, ""); rec.Code != http.StatusOK || rec.Body.String() != online[target] {
+			t.Fatalf("offline %s: %d %s, want %s", target, rec.Code, rec.Body, online[target])
+		}
+	}
+}
+
+// 没有缓存的接口离线时由已缓存的版本信息合成，仓库列表只列出已缓存的仓库
+func TestRepoApiSynthesizedOffline(t *testing.T) {
+	e := newTestEcho(t)
+	// 请求目录列表时缓存了main及commit的版本信息
+	if rec := serve(e, http.MethodGet, "/api/models/org/repo/tree/main", ""); rec.Code != http.StatusOK {
+		t.Fatalf("tree: %d %s", rec.Code, rec.Body)
+	}
+	goOffline()
+
+	rec := serve(e, http.MethodGet, "/api/models/org/repo/refs", "")
+	var refs struct {
+		Branches []struct {
+			Name         string `json:"name"`
+			TargetCommit string `json:"targetCommit"`
+		} `json:"branches"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &refs); err != nil || rec.Code != http.StatusOK ||
+		len(refs.Branches) != 1 || refs.Branches[0].Name != "main" || refs.Branches[0].TargetCommit != testSha {
+		t.Fatalf("refs: %d %s, %v", rec.Code, rec.Body, err)
+	}
+
+	rec = serve(e, http.MethodGet, "/api/models/org/repo/commits/main", "")
+	var commits []struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &commits); err != nil || rec.Code != http.StatusOK || len(commits) != 1 || commits[0].Id != testSha {
+		t.Fatalf("commits: %d %s, %v", rec.Code, rec.Body, err)
+	}
+	if rec = serve(e, http.MethodGet, "/api/models/org/repo/commits/dev", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("commits of an uncached revision: %d, want 404", rec.Code)
+	}
+
+	rec = serve(e, http.MethodGet, "/api/models/org/repo", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"siblings"`) {
+		t.Fatalf("repo info: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(e, http.MethodGet, "/api/models?search=REPO", "")
+	var repos []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &repos); err != nil || rec.Code != http.StatusOK ||
+		len(repos) != 1 || repos[0]["id"] != "org/repo" || repos[0]["siblings"] != nil {
+		t.Fatalf("repo list: %d %s, %v", rec.Code, rec.Body, err)
+	}
+	if rec = serve(e, http.MethodGet, "/api/models?author=other", ""); rec.Body.String() != "[]\n" {
+		t.Fatalf("repo list of another author: %s", rec.Body)
+	}
+}
+
+// 分片地址在线时使用上游返回的地址，上游没有返回重定向地址时不猜测；离线时使用缓存，没有缓存时按默认布局拼接
+func TestParquetShard(t *testing.T) {
+	e := newTestEcho(t)
+	shardPath := "/api/datasets/org/data/parquet/default/train/"
+	wantLocation := "http://example.com/datasets/org/data/resolve/refs%2Fconvert%2Fparquet/default/train/0000.parquet"
+	if rec := serve(e, http.MethodHead, shardPath+"0.parquet", ""); rec.Code != http.StatusFound || rec.Header().Get("Location") != wantLocation {
+		t.Fatalf("online shard 0: %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := serve(e, http.MethodHead, shardPath+"1.parquet", ""); rec.Code != http.StatusBadGateway || rec.Header().Get("Location") != "" {
+		t.Fatalf("online shard 1 without location: %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	goOffline()
+	if rec := serve(e, http.MethodHead, shardPath+"0.parquet", ""); rec.Code != http.StatusFound || rec.Header().Get("Location") != wantLocation {
+		t.Fatalf("offline shard 0: %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	wantLocation = strings.Replace(wantLocation, "0000", "0002", 1)
+	if rec := serve(e, http.MethodHead, shardPath+"2.parquet", ""); rec.Code != http.StatusFound || rec.Header().Get("Location") != wantLocation {
+		t.Fatalf("offline shard 2: %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+// 旧版本按多级目录缓存的版本信息在启动时迁移到转义后的目录，迁移后离线仍可按该版本请求
+func TestMigrateLegacyRevisionDir(t *testing.T) {
+	e := newTestEcho(t)
+	revisionDir := filepath.Join(config.SysConfig.Repos(), "api", "datasets", "org", "data", "revision")
+	legacyPath := filepath.Join(revisionDir, "refs", "convert", "parquet", "meta_get.json")
+	if err := os.MkdirAll(filepath.Dir(legacyPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte(fmt.Sprintf(`{"sha":%q}`, testSha))
+	if err := (&dao.FileDao{}).WriteCacheRequest(legacyPath, http.StatusOK, map[string]string{"content-type": "application/json"}, content); err != nil {
+		t.Fatal(err)
+	}
+
+	dao.NewFileDao()
+	if _, err := os.Stat(filepath.Join(revisionDir, "refs%2Fconvert%2Fparquet", "meta_get.json")); err != nil {
+		t.Fatalf("legacy revision dir is not migrated: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(revisionDir, "refs")); !os.IsNotExist(err) {
+		t.Fatalf("empty legacy revision dir is kept: %v", err)
+	}
+	goOffline()
+	rec := serve(e, http.MethodGet, "/api/datasets/org/data/commits/refs%2Fconvert%2Fparquet", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), testSha) {
+		t.Fatalf("commits of the migrated revision: %d %s", rec.Code, rec.Body)
+	}
+}
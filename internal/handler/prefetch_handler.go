@@ -0,0 +1,83 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package handler
+
+import (
+	"dingospeed/internal/model"
+	"dingospeed/internal/service"
+	"dingospeed/pkg/util"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type PrefetchHandler struct {
+	prefetchService *service.PrefetchService
+	syncService     *service.SyncService
+}
+
+func NewPrefetchHandler(prefetchService *service.PrefetchService, syncService *service.SyncService) *PrefetchHandler {
+	return &PrefetchHandler{
+		prefetchService: prefetchService,
+		syncService:     syncService,
+	}
+}
+
+func (h *PrefetchHandler) CreateJob(c echo.Context) error {
+	var req model.PrefetchRequest
+	if err := c.Bind(&req); err != nil {
+		zap.S().Warnf("bind prefetch request err.%v", err)
+		return util.ErrorRequestParam(c)
+	}
+	return h.prefetchService.CreateJob(c, req)
+}
+
+func (h *PrefetchHandler) ListJobs(c echo.Context) error {
+	return h.prefetchService.ListJobs(c)
+}
+
+func (h *PrefetchHandler) GetJob(c echo.Context) error {
+	return h.prefetchService.GetJob(c, c.Param("id"))
+}
+
+func (h *PrefetchHandler) CancelJob(c echo.Context) error {
+	return h.prefetchService.CancelJob(c, c.Param("id"))
+}
+
+func (h *PrefetchHandler) ListTracked(c echo.Context) error {
+	return h.syncService.ListTracked(c)
+}
+
+func (h *PrefetchHandler) AddTracked(c echo.Context) error {
+	var req model.PrefetchRequest
+	if err := c.Bind(&req); err != nil {
+		zap.S().Warnf("bind tracked repo err.%v", err)
+		return util.ErrorRequestParam(c)
+	}
+	return h.syncService.AddTracked(c, req)
+}
+
+func (h *PrefetchHandler) RemoveTracked(c echo.Context) error {
+	req := model.PrefetchRequest{
+		RepoType: c.QueryParam("repoType"),
+		RepoId:   c.QueryParam("repoId"),
+		Revision: c.QueryParam("revision"),
+	}
+	return h.syncService.RemoveTracked(c, req)
+}
+
+func (h *PrefetchHandler) SyncTracked(c echo.Context) error {
+	return h.syncService.SyncTracked(c)
+}
@@ -31,3 +31,11 @@ func (s *SysHandler) Info(c echo.Context) error {
 	info.HfNetLoc = config.SysConfig.GetHfNetLoc()
 	return util.ResponseData(c, info)
 }
+
+func (s *SysHandler) BlobVerifyStatus(c echo.Context) error {
+	return s.sysService.BlobVerifyStatus(c, c.QueryParam("repoType"), c.QueryParam("org"), c.QueryParam("repo"))
+}
+
+func (s *SysHandler) BlobVerify(c echo.Context) error {
+	return s.sysService.BlobVerify(c, c.QueryParam("repoType"), c.QueryParam("org"), c.QueryParam("repo"), c.QueryParam("oid"))
+}
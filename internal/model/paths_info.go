@@ -0,0 +1,7 @@
+package model
+
+// PathsInfoRequest paths-info请求，huggingface_hub以表单提交（paths可重复，expand为True/False），也支持json
+type PathsInfoRequest struct {
+	Paths  []string `json:"paths" form:"paths"`
+	Expand bool     `json:"expand" form:"expand"`
+}
@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+const (
+	PrefetchStatusPending   = "pending"
+	PrefetchStatusRunning   = "running"
+	PrefetchStatusCompleted = "completed"
+	PrefetchStatusFailed    = "failed"
+	PrefetchStatusCancelled = "cancelled"
+)
+
+// PrefetchRequest 预热任务的参数，allow和ignore为glob模式，与huggingface_hub的allow_patterns、ignore_patterns一致
+type PrefetchRequest struct {
+	RepoType string   `json:"repoType"`
+	RepoId   string   `json:"repoId"`
+	Revision string   `json:"revision"`
+	Allow    []string `json:"allow,omitempty"`
+	Ignore   []string `json:"ignore,omitempty"`
+}
+
+// PrefetchJob 预热任务及其进度，持久化到磁盘，服务重启后继续执行未完成的任务
+type PrefetchJob struct {
+	PrefetchRequest
+	Id            string    `json:"id"`
+	Status        string    `json:"status"`
+	Commit        string    `json:"commit,omitempty"`
+	TotalFiles    int       `json:"totalFiles"`
+	DoneFiles     int       `json:"doneFiles"`
+	TotalBytes    int64     `json:"totalBytes"`
+	DoneBytes     int64     `json:"doneBytes"`
+	FailedFiles   []string  `json:"failedFiles,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	Authorization string    `json:"-"` // 只保存在内存中，重启后继续执行的任务不携带token
+}
+
+func (j *PrefetchJob) Finished() bool {
+	return j.Status == PrefetchStatusCompleted || j.Status == PrefetchStatusFailed || j.Status == PrefetchStatusCancelled
+}
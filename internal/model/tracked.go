@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+const (
+	TrackedSourceConfig = "config"
+	TrackedSourceApi    = "api"
+)
+
+// TrackedRepo 跟踪的仓库及其同步状态
+type TrackedRepo struct {
+	PrefetchRequest
+	Source        string    `json:"source"`
+	Commit        string    `json:"commit,omitempty"`       // 已完成同步的commit
+	LatestCommit  string    `json:"latestCommit,omitempty"` // 上游最新的commit
+	JobId         string    `json:"jobId,omitempty"`        // 最近一次同步的预热任务
+	Error         string    `json:"error,omitempty"`
+	CheckedAt     time.Time `json:"checkedAt,omitempty"`
+	SyncedAt      time.Time `json:"syncedAt,omitempty"`
+	Authorization string    `json:"-"`
+}
+
+func (r *TrackedRepo) Key() string {
+	return r.RepoType + "/" + r.RepoId + "@" + r.Revision
+}
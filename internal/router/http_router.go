@@ -15,8 +15,11 @@
 package router
 
 import (
+	"net/http"
+
 	"dingospeed/internal/handler"
 	"dingospeed/pkg/config"
+	"dingospeed/pkg/middleware"
 
 	"github.com/labstack/echo/v4"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -27,14 +30,17 @@ type HttpRouter struct {
 	fileHandler *handler.FileHandler
 	metaHandler *handler.MetaHandler
 	sysHandler  *handler.SysHandler
+
+	prefetchHandler *handler.PrefetchHandler
 }
 
-func NewHttpRouter(echo *echo.Echo, fileHandler *handler.FileHandler, metaHandler *handler.MetaHandler, sysHandler *handler.SysHandler) *HttpRouter {
+func NewHttpRouter(echo *echo.Echo, fileHandler *handler.FileHandler, metaHandler *handler.MetaHandler, sysHandler *handler.SysHandler, prefetchHandler *handler.PrefetchHandler) *HttpRouter {
 	r := &HttpRouter{
-		echo:        echo,
-		fileHandler: fileHandler,
-		metaHandler: metaHandler,
-		sysHandler:  sysHandler,
+		echo:            echo,
+		fileHandler:     fileHandler,
+		metaHandler:     metaHandler,
+		sysHandler:      sysHandler,
+		prefetchHandler: prefetchHandler,
 	}
 	r.initRouter()
 	return r
@@ -46,21 +52,68 @@ func (r *HttpRouter) initRouter() {
 	if config.SysConfig.EnableMetric() {
 		r.echo.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
 	}
+	// 管理接口
+	admin := r.echo.Group("/admin", middleware.AdminAuthMiddleware)
+	// blob文件完整性校验
+	admin.GET("/blobs/verify", r.sysHandler.BlobVerifyStatus)
+	admin.POST("/blobs/verify", r.sysHandler.BlobVerify)
+	// 仓库预热任务
+	admin.POST("/prefetch", r.prefetchHandler.CreateJob)
+	admin.GET("/prefetch", r.prefetchHandler.ListJobs)
+	admin.GET("/prefetch/:id", r.prefetchHandler.GetJob)
+	admin.DELETE("/prefetch/:id", r.prefetchHandler.CancelJob)
+	// 跟踪的仓库，定期同步上游的新版本
+	admin.GET("/tracked", r.prefetchHandler.ListTracked)
+	admin.POST("/tracked", r.prefetchHandler.AddTracked)
+	admin.DELETE("/tracked", r.prefetchHandler.RemoveTracked)
+	admin.POST("/tracked/sync", r.prefetchHandler.SyncTracked)
 
-	// 单个文件
-	r.echo.HEAD("/:repoType/:org/:repo/resolve/:commit/:filePath", r.fileHandler.HeadFileHandler1)
-	r.echo.HEAD("/:orgOrRepoType/:repo/resolve/:commit/:filePath", r.fileHandler.HeadFileHandler2)
-	r.echo.HEAD("/:repo/resolve/:commit/:filePath", r.fileHandler.HeadFileHandler3)
+	for _, rt := range r.repoRoutes() {
+		r.echo.Add(rt.method, rt.path, rt.handler)
+	}
+	r.echo.GET("/repos", r.metaHandler.ReposHandler)
+}
 
-	r.echo.GET("/:repoType/:org/:repo/resolve/:commit/:filePath", r.fileHandler.GetFileHandler1)
-	r.echo.GET("/:orgOrRepoType/:repo/resolve/:commit/:filePath", r.fileHandler.GetFileHandler2)
-	r.echo.GET("/:repo/resolve/:commit/:filePath", r.fileHandler.GetFileHandler3)
+type route struct {
+	method  string
+	path    string
+	handler echo.HandlerFunc
+}
 
+// repoRoutes 文件下载及仓库api的路由，与huggingface的url一致：模型为/{org}/{repo}，数据集、空间带有datasets/、spaces/前缀，
+// 没有org的旧仓库（如gpt2、squad）只有{repo}；文件路径可以有多级。匹配规则见http_router_test.go。
+func (r *HttpRouter) repoRoutes() []route {
+	routes := make([]route, 0)
+	// 单个文件
+	for _, p := range []string{
+		"/:repoType/:org/:repo/resolve/:commit/*",
+		"/:orgOrRepoType/:repo/resolve/:commit/*",
+		"/:repo/resolve/:commit/*",
+	} {
+		routes = append(routes,
+			route{http.MethodHead, p, r.fileHandler.HeadFileHandler},
+			route{http.MethodGet, p, r.fileHandler.GetFileHandler},
+		)
+	}
 	// 模型
-	r.echo.HEAD("/api/:repoType/:org/:repo/revision/:commit", r.metaHandler.MetaProxyCommonHandler)
-	r.echo.GET("/api/:repoType/:org/:repo/revision/:commit", r.metaHandler.MetaProxyCommonHandler)
-
-	r.echo.GET("/api/whoami-v2", r.metaHandler.WhoamiV2Handler)
-	r.echo.GET("/repos", r.metaHandler.ReposHandler)
-
+	for _, prefix := range []string{"/api/:repoType/:org/:repo", "/api/:repoType/:repo"} {
+		routes = append(routes,
+			route{http.MethodHead, prefix + "/revision/:commit", r.metaHandler.MetaProxyCommonHandler},
+			route{http.MethodGet, prefix + "/revision/:commit", r.metaHandler.MetaProxyCommonHandler},
+			route{http.MethodGet, prefix + "/tree/:commit", r.metaHandler.TreeHandler},
+			route{http.MethodGet, prefix + "/tree/:commit/*", r.metaHandler.TreeHandler},
+			route{http.MethodPost, prefix + "/paths-info/:commit", r.metaHandler.PathsInfoHandler},
+			route{http.MethodGet, prefix, r.metaHandler.RepoInfoHandler},
+			route{http.MethodGet, prefix + "/refs", r.metaHandler.RefsHandler},
+			route{http.MethodGet, prefix + "/commits/:commit", r.metaHandler.CommitsHandler},
+			route{http.MethodGet, prefix + "/parquet", r.metaHandler.ParquetHandler},
+			route{http.MethodGet, prefix + "/parquet/:config/:split", r.metaHandler.ParquetHandler},
+			route{http.MethodHead, prefix + "/parquet/:config/:split/:shard", r.metaHandler.ParquetShardHandler},
+			route{http.MethodGet, prefix + "/parquet/:config/:split/:shard", r.metaHandler.ParquetShardHandler},
+		)
+	}
+	return append(routes,
+		route{http.MethodGet, "/api/:repoType", r.metaHandler.RepoListHandler},
+		route{http.MethodGet, "/api/whoami-v2", r.metaHandler.WhoamiV2Handler},
+	)
 }
@@ -0,0 +1,131 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dingospeed/internal/handler"
+
+	"github.com/labstack/echo/v4"
+)
+
+type matched struct {
+	route    string
+	repoType string
+	org      string
+	repo     string
+	commit   string
+	path     string
+}
+
+// newTestEcho 注册与服务相同的路由，处理函数只记录匹配到的路由及解析出的参数
+func newTestEcho(got *matched, gotErr *error) *echo.Echo {
+	e := echo.New()
+	for _, rt := range (&HttpRouter{}).repoRoutes() {
+		e.Add(rt.method, rt.path, func(c echo.Context) error {
+			*got = matched{route: c.Path()}
+			if strings.Contains(c.Path(), "/resolve/") {
+				got.repoType, got.org, got.repo, got.commit, got.path, *gotErr = handler.ResolveParams(c)
+			} else {
+				got.repoType, got.org, got.repo, got.commit, got.path = c.Param("repoType"), c.Param("org"), c.Param("repo"), c.Param("commit"), c.Param("*")
+			}
+			return c.NoContent(http.StatusOK)
+		})
+	}
+	return e
+}
+
+func TestRepoRoutes(t *testing.T) {
+	const (
+		resolve1 = "/:repoType/:org/:repo/resolve/:commit/*"
+		resolve2 = "/:orgOrRepoType/:repo/resolve/:commit/*"
+		resolve3 = "/:repo/resolve/:commit/*"
+	)
+	cases := []struct {
+		method string
+		url    string
+		want   matched
+	}{
+		// 模型
+		{http.MethodGet, "/org/repo/resolve/main/config.json", matched{resolve2, "models", "org", "repo", "main", "config.json"}},
+		{http.MethodHead, "/org/repo/resolve/main/data/train/0000.parquet", matched{resolve2, "models", "org", "repo", "main", "data/train/0000.parquet"}},
+		{http.MethodGet, "/org/repo/resolve/main/data%2Ftrain%2F0000.parquet", matched{resolve2, "models", "org", "repo", "main", "data/train/0000.parquet"}},
+		{http.MethodGet, "/org/repo/resolve/refs%2Fpr%2F1/config.json", matched{resolve2, "models", "org", "repo", "refs/pr/1", "config.json"}},
+		{http.MethodGet, "/org/repo/resolve/main/a+b%20c.txt", matched{resolve2, "models", "org", "repo", "main", "a+b c.txt"}},
+		{http.MethodGet, "/gpt2/resolve/main/config.json", matched{resolve3, "models", "", "gpt2", "main", "config.json"}},
+		{http.MethodGet, "/gpt2/resolve/main/resolve/a.bin", matched{resolve3, "models", "", "gpt2", "main", "resolve/a.bin"}},
+		// 数据集及空间
+		{http.MethodGet, "/datasets/org/ds/resolve/main/data/train/0000.parquet", matched{resolve1, "datasets", "org", "ds", "main", "data/train/0000.parquet"}},
+		{http.MethodHead, "/datasets/squad/resolve/main/plain_text/train.parquet", matched{resolve2, "datasets", "", "squad", "main", "plain_text/train.parquet"}},
+		{http.MethodGet, "/spaces/org/space/resolve/main/app.py", matched{resolve1, "spaces", "org", "space", "main", "app.py"}},
+		{http.MethodGet, "/spaces/space/resolve/main/src/app.py", matched{resolve2, "spaces", "", "space", "main", "src/app.py"}},
+		// api
+		{http.MethodGet, "/api/models/org/repo/revision/main", matched{"/api/:repoType/:org/:repo/revision/:commit", "models", "org", "repo", "main", ""}},
+		{http.MethodHead, "/api/models/gpt2/revision/main", matched{"/api/:repoType/:repo/revision/:commit", "models", "", "gpt2", "main", ""}},
+		{http.MethodGet, "/api/datasets/org/ds/tree/main", matched{"/api/:repoType/:org/:repo/tree/:commit", "datasets", "org", "ds", "main", ""}},
+		{http.MethodGet, "/api/datasets/org/ds/tree/main/data/train", matched{"/api/:repoType/:org/:repo/tree/:commit/*", "datasets", "org", "ds", "main", "data/train"}},
+		{http.MethodGet, "/api/datasets/squad/tree/main/plain_text", matched{"/api/:repoType/:repo/tree/:commit/*", "datasets", "", "squad", "main", "plain_text"}},
+		{http.MethodPost, "/api/models/org/repo/paths-info/main", matched{"/api/:repoType/:org/:repo/paths-info/:commit", "models", "org", "repo", "main", ""}},
+		{http.MethodPost, "/api/models/gpt2/paths-info/main", matched{"/api/:repoType/:repo/paths-info/:commit", "models", "", "gpt2", "main", ""}},
+		{http.MethodGet, "/api/models/org/repo", matched{"/api/:repoType/:org/:repo", "models", "org", "repo", "", ""}},
+		{http.MethodGet, "/api/models/gpt2", matched{"/api/:repoType/:repo", "models", "", "gpt2", "", ""}},
+		{http.MethodGet, "/api/models/org/repo/refs", matched{"/api/:repoType/:org/:repo/refs", "models", "org", "repo", "", ""}},
+		{http.MethodGet, "/api/models/gpt2/refs", matched{"/api/:repoType/:repo/refs", "models", "", "gpt2", "", ""}},
+		{http.MethodGet, "/api/spaces/org/space/commits/main", matched{"/api/:repoType/:org/:repo/commits/:commit", "spaces", "org", "space", "main", ""}},
+		{http.MethodGet, "/api/datasets/org/ds/parquet", matched{"/api/:repoType/:org/:repo/parquet", "datasets", "org", "ds", "", ""}},
+		{http.MethodGet, "/api/datasets/org/ds/parquet/default/train", matched{"/api/:repoType/:org/:repo/parquet/:config/:split", "datasets", "org", "ds", "", ""}},
+		{http.MethodGet, "/api/datasets/squad/parquet/default/train", matched{"/api/:repoType/:repo/parquet/:config/:split", "datasets", "", "squad", "", ""}},
+		{http.MethodGet, "/api/datasets/squad/parquet/default/train/0.parquet", matched{"/api/:repoType/:repo/parquet/:config/:split/:shard", "datasets", "", "squad", "", ""}},
+		{http.MethodGet, "/datasets/org/ds/resolve/refs%2Fconvert%2Fparquet/default/train/0000.parquet", matched{resolve1, "datasets", "org", "ds", "refs/convert/parquet", "default/train/0000.parquet"}},
+		{http.MethodGet, "/api/models", matched{"/api/:repoType", "models", "", "", "", ""}},
+		{http.MethodGet, "/api/whoami-v2", matched{"/api/whoami-v2", "", "", "", "", ""}},
+	}
+	var got matched
+	var gotErr error
+	e := newTestEcho(&got, &gotErr)
+	for _, c := range cases {
+		got, gotErr = matched{}, nil
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(c.method, c.url, nil))
+		if rec.Code != http.StatusOK || gotErr != nil {
+			t.Errorf("%s %s: code %d, err %v", c.method, c.url, rec.Code, gotErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s %s = %+v, want %+v", c.method, c.url, got, c.want)
+		}
+	}
+}
+
+func TestResolveParamsInvalidPath(t *testing.T) {
+	var got matched
+	var gotErr error
+	e := newTestEcho(&got, &gotErr)
+	for _, u := range []string{
+		"/org/repo/resolve/main/..%2F..%2Fetc%2Fpasswd",
+		"/org/repo/resolve/main/a/%2E%2E/b",
+		"/org/repo/resolve/main/",
+	} {
+		gotErr = nil
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, u, nil))
+		if gotErr == nil {
+			t.Errorf("GET %s: expected error, got %+v", u, got)
+		}
+	}
+}
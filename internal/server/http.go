@@ -79,6 +79,7 @@ func (s *HTTPServer) Stop(ctx context.Context) error {
 func NewEngine() *echo.Echo {
 	r := echo.New()
 	middleware.InitMiddlewareConfig()
+	r.Use(middleware.ClientLimitMiddleware)
 	r.Use(middleware.QueueLimitMiddleware)
 
 	t := &Template{
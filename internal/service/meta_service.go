@@ -15,15 +15,25 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
 	"dingospeed/internal/dao"
 	"dingospeed/pkg/config"
 	"dingospeed/pkg/consts"
+	myerr "dingospeed/pkg/error"
 	"dingospeed/pkg/util"
 
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 )
 
+var commitShaRe = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
 type MetaService struct {
 	fileDao *dao.FileDao
 	metaDao *dao.MetaDao
@@ -72,6 +82,172 @@ func (d *MetaService) MetaProxyCommon(c echo.Context, repoType, org, repo, commi
 	}
 }
 
+// Tree 目录列表，分支或标签先解析为commit，按commit缓存，分页请求的下一页地址已是commit，无需再解析
+func (d *MetaService) Tree(c echo.Context, repoType, org, repo, revision, filePath string) error {
+	zap.S().Debugf("Tree:%s/%s/%s/%s/%s", repoType, org, repo, revision, filePath)
+	if ok, err := checkRepo(c, repoType, org, repo); !ok {
+		return err
+	}
+	filePath = strings.Trim(filePath, "/")
+	if !util.ValidRepoPath(revision) || (filePath != "" && !util.ValidRepoPath(filePath)) {
+		return util.ErrorRequestParam(c)
+	}
+	commitSha, err := d.resolveRevision(c, repoType, org, repo, revision)
+	if err != nil {
+		zap.S().Errorf("Tree resolveRevision err.%v", err)
+		return errorRevision(c, err)
+	}
+	return d.metaDao.TreeGenerator(c, repoType, org, repo, commitSha, filePath)
+}
+
+// PathsInfo 批量获取文件信息，已缓存的文件直接返回，其余合并为一次上游请求
+func (d *MetaService) PathsInfo(c echo.Context, repoType, org, repo, revision string, paths []string, expand bool) error {
+	zap.S().Debugf("PathsInfo:%s/%s/%s/%s, paths:%d, expand:%v", repoType, org, repo, revision, len(paths), expand)
+	if ok, err := checkRepo(c, repoType, org, repo); !ok {
+		return err
+	}
+	if !util.ValidRepoPath(revision) {
+		return util.ErrorRequestParam(c)
+	}
+	validPaths := make([]string, 0, len(paths))
+	for _, p := range paths {
+		p = strings.Trim(p, "/")
+		// 不合法的路径在上游同样不存在，不返回即可
+		if util.ValidRepoPath(p) {
+			validPaths = append(validPaths, p)
+		}
+	}
+	commitSha, err := d.resolveRevision(c, repoType, org, repo, revision)
+	if err != nil {
+		zap.S().Errorf("PathsInfo resolveRevision err.%v", err)
+		return errorRevision(c, err)
+	}
+	authorization := c.Request().Header.Get("authorization")
+	pathsInfos, err := d.fileDao.PathsInfoGenerator(repoType, org, repo, commitSha, authorization, validPaths, expand)
+	if err != nil {
+		if e, ok := err.(myerr.Error); ok {
+			zap.S().Errorf("PathsInfoGenerator code:%d, err:%v", e.StatusCode(), err)
+			return util.ErrorEntryUnknown(c, e.StatusCode(), e.Error())
+		}
+		zap.S().Errorf("PathsInfoGenerator err:%v", err)
+		return util.ErrorProxyError(c)
+	}
+	return util.ResponseData(c, pathsInfos)
+}
+
+// RepoInfo 不带版本的仓库信息
+func (d *MetaService) RepoInfo(c echo.Context, repoType, org, repo string) error {
+	if ok, err := checkRepo(c, repoType, org, repo); !ok {
+		return err
+	}
+	return d.metaDao.RepoInfoGenerator(c, repoType, org, repo)
+}
+
+// Refs 仓库的分支及标签
+func (d *MetaService) Refs(c echo.Context, repoType, org, repo string) error {
+	if ok, err := checkRepo(c, repoType, org, repo); !ok {
+		return err
+	}
+	return d.metaDao.RefsGenerator(c, repoType, org, repo)
+}
+
+// Commits 版本的提交记录
+func (d *MetaService) Commits(c echo.Context, repoType, org, repo, revision string) error {
+	if ok, err := checkRepo(c, repoType, org, repo); !ok {
+		return err
+	}
+	if !util.ValidRepoPath(revision) {
+		return util.ErrorRequestParam(c)
+	}
+	return d.metaDao.CommitsGenerator(c, repoType, org, repo, revision)
+}
+
+// Parquet 数据集的parquet分片列表，parquetConfig为空时列出全部config及split
+func (d *MetaService) Parquet(c echo.Context, repoType, org, repo, parquetConfig, split string) error {
+	if ok, err := checkParquet(c, repoType, org, repo, parquetConfig, split); !ok {
+		return err
+	}
+	return d.metaDao.ParquetGenerator(c, org, repo, parquetConfig, split)
+}
+
+// ParquetShard 数据集的parquet分片，shard形如0.parquet
+func (d *MetaService) ParquetShard(c echo.Context, repoType, org, repo, parquetConfig, split, shard string) error {
+	if ok, err := checkParquet(c, repoType, org, repo, parquetConfig, split); !ok {
+		return err
+	}
+	index, err := strconv.Atoi(strings.TrimSuffix(shard, ".parquet"))
+	if err != nil || index < 0 || !strings.HasSuffix(shard, ".parquet") {
+		return util.ErrorRequestParam(c)
+	}
+	return d.metaDao.ParquetShardGenerator(c, org, repo, parquetConfig, split, index)
+}
+
+// RepoList 仓库搜索及列表
+func (d *MetaService) RepoList(c echo.Context, repoType string) error {
+	if _, ok := consts.RepoTypesMapping[repoType]; !ok {
+		zap.S().Errorf("RepoList repoType:%s is not exist RepoTypesMapping", repoType)
+		return util.ErrorPageNotFound(c)
+	}
+	return d.metaDao.RepoListGenerator(c, repoType)
+}
+
+// checkRepo 校验仓库类型及仓库名，不合法时返回false及错误响应的结果
+func checkRepo(c echo.Context, repoType, org, repo string) (bool, error) {
+	if _, ok := consts.RepoTypesMapping[repoType]; !ok {
+		zap.S().Errorf("repoType:%s is not exist RepoTypesMapping", repoType)
+		return false, util.ErrorPageNotFound(c)
+	}
+	if org == "" && repo == "" {
+		zap.S().Errorf("org and repo is null")
+		return false, util.ErrorRepoNotFound(c)
+	}
+	return true, nil
+}
+
+// checkParquet 只有数据集有parquet接口，config及split均为单级名称
+func checkParquet(c echo.Context, repoType, org, repo, parquetConfig, split string) (bool, error) {
+	if repoType != "datasets" {
+		zap.S().Errorf("repoType:%s has no parquet api", repoType)
+		return false, util.ErrorPageNotFound(c)
+	}
+	if ok, err := checkRepo(c, repoType, org, repo); !ok {
+		return false, err
+	}
+	for _, name := range []string{parquetConfig, split} {
+		if name != "" && (strings.Contains(name, "/") || !util.ValidRepoPath(name)) {
+			return false, util.ErrorRequestParam(c)
+		}
+	}
+	return true, nil
+}
+
+// resolveRevision 将分支或标签解析为commit。在线时只请求一次上游的版本信息，同时缓存分支及commit对应的版本信息，
+// 离线时按分支请求也可以找到对应的缓存。上游返回错误时，错误中带有上游的状态码。
+func (d *MetaService) resolveRevision(c echo.Context, repoType, org, repo, revision string) (string, error) {
+	if commitShaRe.MatchString(revision) {
+		return revision, nil
+	}
+	authorization := c.Request().Header.Get("authorization")
+	info, err := d.fileDao.GetRevisionInfo(repoType, org, repo, revision, authorization)
+	if err != nil {
+		return "", err
+	}
+	if info.Sha == "" {
+		// 不能按空的commit缓存
+		return "", myerr.NewAppendCode(http.StatusNotFound, fmt.Sprintf("revision %s of %s has no commit sha", revision, util.GetOrgRepo(org, repo)))
+	}
+	return info.Sha, nil
+}
+
+// errorRevision 返回解析版本失败的响应，有上游状态码时按该状态码返回
+func errorRevision(c echo.Context, err error) error {
+	var e myerr.Error
+	if errors.As(err, &e) && e.StatusCode() != 0 {
+		return util.ErrorEntryUnknown(c, e.StatusCode(), e.Error())
+	}
+	return util.ErrorRepoNotFound(c)
+}
+
 func (d *MetaService) WhoamiV2(c echo.Context) error {
 	err := d.fileDao.WhoamiV2Generator(c)
 	return err
@@ -0,0 +1,389 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dingospeed/internal/dao"
+	"dingospeed/internal/model"
+	"dingospeed/pkg/common"
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/consts"
+	"dingospeed/pkg/util"
+
+	"github.com/bytedance/sonic"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	prefetchSaveInterval  = 5 * time.Second // 下载过程中持久化进度的间隔
+	prefetchPathsInfoSize = 100             // 每次请求paths-info的文件数
+)
+
+var prefetchOnce sync.Once
+
+// PrefetchService 仓库预热：在后台将仓库的文件下载到缓存，任务按创建顺序执行，持久化在repos/prefetch目录下
+type PrefetchService struct {
+	fileDao *dao.FileDao
+	mu      sync.Mutex
+	jobs    map[string]*model.PrefetchJob
+	cancels map[string]context.CancelFunc
+	pending []string
+	notify  chan struct{}
+}
+
+func NewPrefetchService(fileDao *dao.FileDao) *PrefetchService {
+	s := &PrefetchService{
+		fileDao: fileDao,
+		jobs:    make(map[string]*model.PrefetchJob),
+		cancels: make(map[string]context.CancelFunc),
+		notify:  make(chan struct{}, 1),
+	}
+	prefetchOnce.Do(func() {
+		s.loadJobs()
+		for i := 0; i < config.SysConfig.Prefetch.Concurrency; i++ {
+			go s.worker()
+		}
+	})
+	return s
+}
+
+func prefetchDir() string {
+	return filepath.Join(config.SysConfig.Repos(), "prefetch")
+}
+
+// loadJobs 加载持久化的任务，未完成的任务重新排队
+func (s *PrefetchService) loadJobs() {
+	entries, err := os.ReadDir(prefetchDir())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			zap.S().Errorf("read prefetch dir err.%v", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(prefetchDir(), entry.Name()))
+		if err != nil {
+			zap.S().Errorf("read prefetch job %s err.%v", entry.Name(), err)
+			continue
+		}
+		job := &model.PrefetchJob{}
+		if err = sonic.Unmarshal(b, job); err != nil {
+			zap.S().Errorf("unmarshal prefetch job %s err.%v", entry.Name(), err)
+			continue
+		}
+		s.jobs[job.Id] = job
+	}
+	unfinished := make([]*model.PrefetchJob, 0)
+	for _, job := range s.jobs {
+		if !job.Finished() {
+			job.Status = model.PrefetchStatusPending
+			unfinished = append(unfinished, job)
+		}
+	}
+	sort.Slice(unfinished, func(i, j int) bool {
+		return unfinished[i].CreatedAt.Before(unfinished[j].CreatedAt)
+	})
+	for _, job := range unfinished {
+		s.pending = append(s.pending, job.Id)
+	}
+	if len(unfinished) > 0 {
+		zap.S().Infof("resume %d prefetch jobs", len(unfinished))
+	}
+}
+
+// saveJob 调用方需持有s.mu
+func (s *PrefetchService) saveJob(job *model.PrefetchJob) {
+	job.UpdatedAt = time.Now()
+	if err := saveJsonFile(filepath.Join(prefetchDir(), job.Id+".json"), job); err != nil {
+		zap.S().Errorf("save prefetch job %s err.%v", job.Id, err)
+	}
+}
+
+// saveJsonFile 先写临时文件再重命名，避免中途退出时文件损坏
+func saveJsonFile(path string, v interface{}) error {
+	b, err := sonic.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err = os.WriteFile(path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// snapshot 返回任务的副本，避免读取时与执行中的任务竞争，调用方需持有s.mu
+func snapshot(job *model.PrefetchJob) model.PrefetchJob {
+	ret := *job
+	ret.FailedFiles = append([]string(nil), job.FailedFiles...)
+	return ret
+}
+
+func (s *PrefetchService) CreateJob(c echo.Context, req model.PrefetchRequest) error {
+	if !validPrefetchRequest(&req) {
+		return util.ErrorRequestParam(c)
+	}
+	return util.ResponseData(c, s.Submit(req, c.Request().Header.Get("authorization")))
+}
+
+// validPrefetchRequest 校验仓库及glob模式，未指定版本时使用main
+func validPrefetchRequest(req *model.PrefetchRequest) bool {
+	if _, ok := consts.RepoTypesMapping[req.RepoType]; !ok {
+		return false
+	}
+	if _, _, ok := splitRepoId(req.RepoId); !ok {
+		return false
+	}
+	if req.Revision == "" {
+		req.Revision = "main"
+	}
+	if _, err := util.FilterPaths(nil, req.Allow, req.Ignore); err != nil {
+		zap.S().Warnf("invalid prefetch pattern.%v", err)
+		return false
+	}
+	return true
+}
+
+// Submit 创建预热任务并排队，返回任务的副本，调用方需保证req已校验
+func (s *PrefetchService) Submit(req model.PrefetchRequest, authorization string) model.PrefetchJob {
+	job := &model.PrefetchJob{
+		PrefetchRequest: req,
+		Id:              util.UUID(),
+		Status:          model.PrefetchStatusPending,
+		CreatedAt:       time.Now(),
+		Authorization:   authorization,
+	}
+	s.mu.Lock()
+	s.jobs[job.Id] = job
+	s.pending = append(s.pending, job.Id)
+	s.saveJob(job)
+	ret := snapshot(job)
+	s.mu.Unlock()
+	s.wakeup()
+	zap.S().Infof("create prefetch job %s, %s/%s@%s", job.Id, req.RepoType, req.RepoId, req.Revision)
+	return ret
+}
+
+// Job 返回任务的副本
+func (s *PrefetchService) Job(id string) (model.PrefetchJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return model.PrefetchJob{}, false
+	}
+	return snapshot(job), true
+}
+
+func (s *PrefetchService) ListJobs(c echo.Context) error {
+	s.mu.Lock()
+	jobs := make([]model.PrefetchJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, snapshot(job))
+	}
+	s.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return util.ResponseData(c, jobs)
+}
+
+func (s *PrefetchService) GetJob(c echo.Context, id string) error {
+	job, ok := s.Job(id)
+	if !ok {
+		return util.ErrorEntryNotFound(c)
+	}
+	return util.ResponseData(c, job)
+}
+
+// CancelJob 取消排队或执行中的任务，已下载的文件保留在缓存中
+func (s *PrefetchService) CancelJob(c echo.Context, id string) error {
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	if !ok {
+		s.mu.Unlock()
+		return util.ErrorEntryNotFound(c)
+	}
+	if cancel, running := s.cancels[id]; running {
+		cancel()
+	} else if job.Status == model.PrefetchStatusPending {
+		s.removePending(id)
+		job.Status = model.PrefetchStatusCancelled
+		s.saveJob(job)
+	}
+	ret := snapshot(job)
+	s.mu.Unlock()
+	return util.ResponseData(c, ret)
+}
+
+// removePending 调用方需持有s.mu
+func (s *PrefetchService) removePending(id string) {
+	for i, pendingId := range s.pending {
+		if pendingId == id {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *PrefetchService) wakeup() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *PrefetchService) worker() {
+	for {
+		s.mu.Lock()
+		if len(s.pending) == 0 {
+			s.mu.Unlock()
+			<-s.notify
+			continue
+		}
+		job := s.jobs[s.pending[0]]
+		s.pending = s.pending[1:]
+		ctx, cancel := context.WithCancel(context.Background())
+		s.cancels[job.Id] = cancel
+		job.Status = model.PrefetchStatusRunning
+		job.DoneFiles, job.DoneBytes, job.FailedFiles, job.Error = 0, 0, nil, ""
+		s.saveJob(job)
+		s.mu.Unlock()
+		// 还有任务时唤醒其他worker
+		s.wakeup()
+
+		err := s.runJob(ctx, job)
+
+		s.mu.Lock()
+		delete(s.cancels, job.Id)
+		switch {
+		case ctx.Err() != nil:
+			job.Status = model.PrefetchStatusCancelled
+		case err != nil:
+			job.Status = model.PrefetchStatusFailed
+			job.Error = err.Error()
+		case len(job.FailedFiles) > 0:
+			job.Status = model.PrefetchStatusFailed
+			job.Error = fmt.Sprintf("%d file(s) failed", len(job.FailedFiles))
+		default:
+			job.Status = model.PrefetchStatusCompleted
+		}
+		s.saveJob(job)
+		zap.S().Infof("prefetch job %s %s, files:%d/%d, bytes:%d/%d", job.Id, job.Status, job.DoneFiles, job.TotalFiles, job.DoneBytes, job.TotalBytes)
+		s.mu.Unlock()
+		cancel()
+	}
+}
+
+// runJob 获取文件列表，按allow和ignore过滤后依次下载，单个文件失败不影响其他文件
+func (s *PrefetchService) runJob(ctx context.Context, job *model.PrefetchJob) error {
+	org, repo, _ := splitRepoId(job.RepoId)
+	info, err := s.fileDao.GetRevisionInfo(job.RepoType, org, repo, job.Revision, job.Authorization)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(info.Siblings))
+	for _, sibling := range info.Siblings {
+		names = append(names, sibling.Rfilename)
+	}
+	names, err = util.FilterPaths(names, job.Allow, job.Ignore)
+	if err != nil {
+		return err
+	}
+	pathsInfos := make([]common.PathsInfo, 0, len(names))
+	for start := 0; start < len(names); start += prefetchPathsInfoSize {
+		batch := names[start:min(start+prefetchPathsInfoSize, len(names))]
+		infos, err := s.fileDao.GetPathsInfos(job.RepoType, org, repo, info.Sha, job.Authorization, batch)
+		if err != nil {
+			return err
+		}
+		pathsInfos = append(pathsInfos, infos...)
+	}
+	found := make(map[string]struct{}, len(pathsInfos))
+	s.mu.Lock()
+	job.Commit = info.Sha
+	job.TotalFiles = len(names)
+	job.TotalBytes = 0
+	for _, pathInfo := range pathsInfos {
+		found[pathInfo.Path] = struct{}{}
+		job.TotalBytes += pathInfo.Size
+	}
+	for _, name := range names {
+		if _, ok := found[name]; !ok {
+			job.FailedFiles = append(job.FailedFiles, name)
+		}
+	}
+	s.saveJob(job)
+	s.mu.Unlock()
+
+	lastSave := time.Now()
+	for _, pathInfo := range pathsInfos {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var fileBytes int64
+		err := s.fileDao.FilePrefetch(ctx, job.RepoType, org, repo, info.Sha, job.Authorization, pathInfo, func(n int64) {
+			s.mu.Lock()
+			fileBytes += n
+			job.DoneBytes += n
+			if time.Since(lastSave) >= prefetchSaveInterval {
+				s.saveJob(job)
+				lastSave = time.Now()
+			}
+			s.mu.Unlock()
+		})
+		s.mu.Lock()
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				zap.S().Errorf("prefetch job %s, file %s err.%v", job.Id, pathInfo.Path, err)
+				job.FailedFiles = append(job.FailedFiles, pathInfo.Path)
+			}
+			// 未完成的文件不计入已下载的数据量
+			job.DoneBytes -= fileBytes
+		} else {
+			job.DoneFiles++
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// splitRepoId 拆分org/repo，没有组织的仓库org为空
+func splitRepoId(repoId string) (string, string, bool) {
+	org, repo, found := strings.Cut(repoId, "/")
+	if !found {
+		return "", repoId, isPathSegment(repoId)
+	}
+	if !isPathSegment(org) || !isPathSegment(repo) {
+		return "", "", false
+	}
+	return org, repo, true
+}
@@ -0,0 +1,191 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dingospeed/internal/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+func resolvePath(commit, name string) string {
+	return "/" + testRepoId + "/resolve/" + commit + "/" + name
+}
+
+// savedJob 读取持久化的任务
+func savedJob(t *testing.T, id string) model.PrefetchJob {
+	b, err := os.ReadFile(filepath.Join(prefetchDir(), id+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job model.PrefetchJob
+	if err = json.Unmarshal(b, &job); err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func cancelJob(t *testing.T, s *PrefetchService, id string) model.PrefetchJob {
+	rec := httptest.NewRecorder()
+	if err := s.CancelJob(echo.New().NewContext(httptest.NewRequest(http.MethodDelete, "/", nil), rec), id); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("cancel job %s: %d", id, rec.Code)
+	}
+	var job model.PrefetchJob
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+// 只下载匹配allow且不匹配ignore的文件，进度按文件数和数据量统计，失败的文件不计入已下载的数据量
+func TestPrefetchFilterAndProgress(t *testing.T) {
+	setup(t)
+	files := map[string][]byte{
+		"config.json":     []byte(`{"v":1}`),
+		"tokenizer.json":  []byte(`{"tokens":[]}`),
+		"onnx/model.json": []byte(`{"onnx":true}`),
+		"model.bin":       []byte("weights"),
+		"README.md":       []byte("# repo"),
+	}
+	commit := hub.commit(files)
+	hub.setBroken("tokenizer.json", true)
+	s := newTestPrefetchService()
+
+	job := s.Submit(model.PrefetchRequest{RepoType: "models", RepoId: testRepoId, Revision: "main", Allow: []string{"*.json"}, Ignore: []string{"onnx/*"}}, "")
+	job = waitJob(t, s, job.Id)
+	if job.Status != model.PrefetchStatusFailed || job.Error != "1 file(s) failed" || job.Commit != commit {
+		t.Fatalf("job %s at %s, err %q", job.Status, job.Commit, job.Error)
+	}
+	if job.TotalFiles != 2 || job.DoneFiles != 1 || len(job.FailedFiles) != 1 || job.FailedFiles[0] != "tokenizer.json" {
+		t.Fatalf("files %d/%d, failed %v", job.DoneFiles, job.TotalFiles, job.FailedFiles)
+	}
+	total := int64(len(files["config.json"]) + len(files["tokenizer.json"]))
+	if job.TotalBytes != total || job.DoneBytes != int64(len(files["config.json"])) {
+		t.Fatalf("bytes %d/%d, want %d/%d", job.DoneBytes, job.TotalBytes, len(files["config.json"]), total)
+	}
+	if !cached(commit, "config.json", files["config.json"]) {
+		t.Fatal("config.json is not cached")
+	}
+	for _, name := range []string{"onnx/model.json", "model.bin", "README.md"} {
+		if n := hub.count(resolvePath(commit, name)); n != 0 {
+			t.Fatalf("filtered %s is downloaded %d times", name, n)
+		}
+	}
+
+	// 重新执行时已缓存的文件不再下载
+	hub.setBroken("tokenizer.json", false)
+	job = waitJob(t, s, s.Submit(model.PrefetchRequest{RepoType: "models", RepoId: testRepoId, Revision: commit, Allow: []string{"*.json"}, Ignore: []string{"onnx/*"}}, "").Id)
+	if job.Status != model.PrefetchStatusCompleted || job.DoneFiles != 2 || job.DoneBytes != total {
+		t.Fatalf("job %s, files %d, bytes %d after retry", job.Status, job.DoneFiles, job.DoneBytes)
+	}
+	if n := hub.count(resolvePath(commit, "config.json")); n != 1 {
+		t.Fatalf("cached config.json is downloaded %d times", n)
+	}
+}
+
+// 取消排队的任务后不再执行，取消执行中的任务时中断下载，已下载的文件不计入完成数
+func TestPrefetchCancel(t *testing.T) {
+	setup(t)
+	commit := hub.commit(map[string][]byte{"model.bin": []byte("weights")})
+	release := hub.hold("model.bin")
+	defer release()
+	s := newTestPrefetchService()
+	req := model.PrefetchRequest{RepoType: "models", RepoId: testRepoId, Revision: commit}
+
+	running := s.Submit(req, "")
+	pending := s.Submit(req, "")
+	deadline := time.Now().Add(5 * time.Second)
+	for hub.count(resolvePath(commit, "model.bin")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if job, _ := s.Job(running.Id); job.Status != model.PrefetchStatusRunning {
+		t.Fatalf("first job %s, want running", job.Status)
+	}
+
+	if job := cancelJob(t, s, pending.Id); job.Status != model.PrefetchStatusCancelled {
+		t.Fatalf("pending job %s after cancel, want cancelled", job.Status)
+	}
+	cancelJob(t, s, running.Id)
+	job := waitJob(t, s, running.Id)
+	if job.Status != model.PrefetchStatusCancelled || job.DoneFiles != 0 || job.DoneBytes != 0 || len(job.FailedFiles) != 0 {
+		t.Fatalf("running job %+v after cancel", job)
+	}
+	// 取消的排队任务不会再执行
+	time.Sleep(100 * time.Millisecond)
+	if n := hub.count(resolvePath(commit, "model.bin")); n != 1 {
+		t.Fatalf("model.bin is requested %d times, want 1", n)
+	}
+	if job, _ = s.Job(pending.Id); job.Status != model.PrefetchStatusCancelled || savedJob(t, pending.Id).Status != model.PrefetchStatusCancelled {
+		t.Fatalf("pending job %s after cancel", job.Status)
+	}
+}
+
+// 任务及进度持久化，服务重启后未完成的任务按创建顺序重新执行，已结束的任务不再执行，token不持久化
+func TestPrefetchResume(t *testing.T) {
+	setup(t)
+	files := map[string][]byte{"config.json": []byte(`{"v":1}`), "model.bin": []byte("weights")}
+	commit := hub.commit(files)
+	s := newTestPrefetchService()
+	done := waitJob(t, s, s.Submit(model.PrefetchRequest{RepoType: "models", RepoId: testRepoId, Revision: commit, Allow: []string{"config.json"}}, "Bearer secret").Id)
+	saved := savedJob(t, done.Id)
+	if saved.Status != model.PrefetchStatusCompleted || saved.DoneFiles != 1 || saved.DoneBytes != int64(len(files["config.json"])) || saved.Authorization != "" {
+		t.Fatalf("saved job %+v", saved)
+	}
+	if b, err := os.ReadFile(filepath.Join(prefetchDir(), done.Id+".json")); err != nil || strings.Contains(string(b), "secret") {
+		t.Fatalf("saved job %s, err %v", b, err)
+	}
+
+	// 模拟执行中退出：任务持久化为执行中，下载了部分文件
+	interrupted := []*model.PrefetchJob{
+		{PrefetchRequest: model.PrefetchRequest{RepoType: "models", RepoId: testRepoId, Revision: commit}, Id: "second", Status: model.PrefetchStatusPending, CreatedAt: time.Now()},
+		{PrefetchRequest: model.PrefetchRequest{RepoType: "models", RepoId: testRepoId, Revision: commit}, Id: "first", Status: model.PrefetchStatusRunning, DoneFiles: 1, CreatedAt: time.Now().Add(-time.Minute)},
+	}
+	for _, job := range interrupted {
+		if err := saveJsonFile(filepath.Join(prefetchDir(), job.Id+".json"), job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	restarted := newTestPrefetchService()
+	if job, ok := restarted.Job(done.Id); !ok || job.Status != model.PrefetchStatusCompleted {
+		t.Fatalf("finished job %+v after restart", job)
+	}
+	first, second := waitJob(t, restarted, "first"), waitJob(t, restarted, "second")
+	for _, job := range []model.PrefetchJob{first, second} {
+		if job.Status != model.PrefetchStatusCompleted || job.DoneFiles != 2 || job.TotalFiles != 2 || job.Commit != commit {
+			t.Fatalf("resumed job %+v", job)
+		}
+	}
+	if second.UpdatedAt.Before(first.UpdatedAt) {
+		t.Fatal("resumed jobs are not run in creation order")
+	}
+	// 已缓存的文件不再下载
+	for name := range files {
+		if n := hub.count(resolvePath(commit, name)); n != 1 {
+			t.Fatalf("%s is downloaded %d times", name, n)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dingospeed/internal/dao"
+	"dingospeed/internal/downloader"
+	"dingospeed/internal/model"
+	"dingospeed/pkg/config"
+)
+
+const testRepoId = "org/repo"
+
+// testHub 模拟huggingface上游的仓库版本、paths-info及文件下载，broken中的文件下载时返回404，
+// held中的文件下载时等待通道关闭后再返回
+type testHub struct {
+	mu       sync.Mutex
+	commits  int
+	latest   string                       // main分支最新的commit
+	files    map[string]map[string][]byte // commit → 文件名 → 内容
+	broken   map[string]bool
+	held     map[string]chan struct{}
+	requests map[string]int
+}
+
+func (h *testHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.requests[r.URL.Path]++
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/"+testRepoId+"/resolve/"); ok {
+		commit, name, _ := strings.Cut(rest, "/")
+		content, ok := h.files[commit][name]
+		broken, held := h.broken[name], h.held[name]
+		h.mu.Unlock()
+		if held != nil {
+			select {
+			case <-held:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if !ok || broken {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+		return
+	}
+	defer h.mu.Unlock()
+	apiPrefix := "/api/models/" + testRepoId
+	if rev, ok := strings.CutPrefix(r.URL.Path, apiPrefix+"/revision/"); ok {
+		if rev == "main" {
+			rev = h.latest
+		}
+		files, ok := h.files[rev]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		siblings := make([]map[string]string, 0, len(files))
+		for name := range files {
+			siblings = append(siblings, map[string]string{"rfilename": name})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": testRepoId, "sha": rev, "siblings": siblings})
+		return
+	}
+	if commit, ok := strings.CutPrefix(r.URL.Path, apiPrefix+"/paths-info/"); ok {
+		var req struct {
+			Paths []string `json:"paths"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		items := make([]map[string]interface{}, 0, len(req.Paths))
+		for _, p := range req.Paths {
+			if content, ok := h.files[commit][p]; ok {
+				items = append(items, map[string]interface{}{"type": "file", "path": p, "size": len(content), "oid": oid(content)})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(items)
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+// commit 上游main分支提交新的commit，返回commit的sha
+func (h *testHub) commit(files map[string][]byte) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.commits++
+	sha := fmt.Sprintf("%040x", h.commits)
+	h.files[sha] = files
+	h.latest = sha
+	return sha
+}
+
+func (h *testHub) setBroken(name string, broken bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.broken[name] = broken
+}
+
+// hold 使name的下载请求等待，直到调用返回的函数
+func (h *testHub) hold(name string) func() {
+	ch := make(chan struct{})
+	h.mu.Lock()
+	h.held[name] = ch
+	h.mu.Unlock()
+	return func() {
+		h.mu.Lock()
+		delete(h.held, name)
+		h.mu.Unlock()
+		close(ch)
+	}
+}
+
+func (h *testHub) count(path string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.requests[path]
+}
+
+// oid 与huggingface一致，非lfs文件的oid为git blob的sha1
+func oid(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+var hub = &testHub{}
+
+func TestMain(m *testing.M) {
+	server := httptest.NewServer(hub)
+	config.SysConfig = &config.Config{}
+	config.SysConfig.Upstream.Urls = []string{server.URL}
+	config.SysConfig.Retry.Attempts = 1
+	config.SysConfig.Download.BlockSize = 64 * 1024
+	config.SysConfig.SetDefaults()
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+// setup 使用临时的repos目录，在线且上游没有任何commit
+func setup(t *testing.T) {
+	config.SysConfig.Server.Repos = t.TempDir()
+	config.SysConfig.Server.Online = true
+	hub.mu.Lock()
+	hub.latest = ""
+	hub.files = make(map[string]map[string][]byte)
+	hub.broken = make(map[string]bool)
+	hub.held = make(map[string]chan struct{})
+	hub.requests = make(map[string]int)
+	hub.mu.Unlock()
+}
+
+// newTestPrefetchService 与NewPrefetchService相同，每次都加载持久化的任务并启动一个worker
+func newTestPrefetchService() *PrefetchService {
+	s := &PrefetchService{
+		fileDao: &dao.FileDao{},
+		jobs:    make(map[string]*model.PrefetchJob),
+		cancels: make(map[string]context.CancelFunc),
+		notify:  make(chan struct{}, 1),
+	}
+	s.loadJobs()
+	go s.worker()
+	return s
+}
+
+// waitJob 等待任务结束并返回任务的副本
+func waitJob(t *testing.T, s *PrefetchService, id string) model.PrefetchJob {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, ok := s.Job(id); ok && job.Finished() {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("prefetch job %s is not finished", id)
+	return model.PrefetchJob{}
+}
+
+// cached 判断按版本缓存的文件是否链接到已完整缓存的blob
+func cached(commit, name string, content []byte) bool {
+	repoDir := filepath.Join(config.SysConfig.Repos(), "files", "models", testRepoId)
+	blobsFile := filepath.Join(repoDir, "blobs", oid(content))
+	target, err := filepath.EvalSymlinks(filepath.Join(repoDir, "resolve", commit, name))
+	return err == nil && target == blobsFile && downloader.IsBlobCached(blobsFile, int64(len(content)))
+}
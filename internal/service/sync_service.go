@@ -0,0 +1,330 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dingospeed/internal/dao"
+	"dingospeed/internal/model"
+	"dingospeed/pkg/common"
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/util"
+
+	"github.com/bytedance/sonic"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+var syncOnce sync.Once
+
+const syncJobPollInterval = 5 * time.Second
+
+// SyncService 跟踪仓库的同步：定期从上游获取跟踪版本的commit，commit变化时提交预热任务下载新版本的文件，
+// 已缓存的文件不会重复下载，任务成功后再刷新跟踪版本的meta缓存。离线节点同样从上游同步。
+type SyncService struct {
+	fileDao         *dao.FileDao
+	prefetchService *PrefetchService
+	mu              sync.Mutex
+	repos           map[string]*model.TrackedRepo
+	pendingMeta     map[string]*common.Response // 预热任务成功后写入跟踪版本的meta，按任务id索引
+	trigger         chan struct{}
+}
+
+func NewSyncService(fileDao *dao.FileDao, prefetchService *PrefetchService) *SyncService {
+	s := &SyncService{
+		fileDao:         fileDao,
+		prefetchService: prefetchService,
+		repos:           make(map[string]*model.TrackedRepo),
+		pendingMeta:     make(map[string]*common.Response),
+		trigger:         make(chan struct{}, 1),
+	}
+	syncOnce.Do(func() {
+		s.loadRepos()
+		go s.cycleSync()
+	})
+	return s
+}
+
+func trackedFile() string {
+	return filepath.Join(config.SysConfig.Repos(), "tracked.json")
+}
+
+// loadRepos 合并配置文件中的仓库与持久化的仓库，保留已同步的状态，配置文件中已删除的仓库不再跟踪
+func (s *SyncService) loadRepos() {
+	saved := make([]*model.TrackedRepo, 0)
+	if b, err := os.ReadFile(trackedFile()); err == nil {
+		if err = sonic.Unmarshal(b, &saved); err != nil {
+			zap.S().Errorf("unmarshal %s err.%v", trackedFile(), err)
+		}
+	} else if !os.IsNotExist(err) {
+		zap.S().Errorf("read %s err.%v", trackedFile(), err)
+	}
+	for _, r := range saved {
+		if r.Source == model.TrackedSourceApi {
+			s.repos[r.Key()] = r
+		}
+	}
+	for _, c := range config.SysConfig.Sync.Repos {
+		req := model.PrefetchRequest{RepoType: c.RepoType, RepoId: c.RepoId, Revision: c.Revision, Allow: c.Allow, Ignore: c.Ignore}
+		if !validPrefetchRequest(&req) {
+			zap.S().Errorf("invalid tracked repo %s/%s", c.RepoType, c.RepoId)
+			continue
+		}
+		r := &model.TrackedRepo{PrefetchRequest: req}
+		for _, old := range saved {
+			if old.Key() == r.Key() {
+				r = old
+				r.PrefetchRequest = req
+				break
+			}
+		}
+		r.Source = model.TrackedSourceConfig
+		r.Authorization = ""
+		if c.Token != "" {
+			r.Authorization = "Bearer " + strings.TrimPrefix(c.Token, "Bearer ")
+		}
+		s.repos[r.Key()] = r
+	}
+}
+
+// saveRepos 调用方需持有s.mu
+func (s *SyncService) saveRepos() {
+	repos := make([]*model.TrackedRepo, 0, len(s.repos))
+	for _, r := range s.repos {
+		repos = append(repos, r)
+	}
+	if err := saveJsonFile(trackedFile(), repos); err != nil {
+		zap.S().Errorf("save tracked repos err.%v", err)
+	}
+}
+
+func (s *SyncService) cycleSync() {
+	s.syncAll()
+	if config.SysConfig.Sync.Period <= 0 {
+		// 未开启定期同步时，只响应手动触发
+		for range s.trigger {
+			s.syncAll()
+		}
+		return
+	}
+	ticker := time.NewTicker(config.SysConfig.GetSyncPeriod())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.trigger:
+		}
+		s.syncAll()
+	}
+}
+
+func (s *SyncService) syncAll() {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.repos))
+	for key := range s.repos {
+		keys = append(keys, key)
+	}
+	s.mu.Unlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		s.syncRepo(key)
+	}
+}
+
+// refreshJob 根据最近一次预热任务的结果更新同步状态，返回任务是否仍在执行，调用方需持有s.mu
+func (s *SyncService) refreshJob(r *model.TrackedRepo) bool {
+	if r.JobId == "" {
+		return false
+	}
+	job, ok := s.prefetchService.Job(r.JobId)
+	if !ok {
+		return false
+	}
+	if !job.Finished() {
+		return true
+	}
+	resp, pending := s.pendingMeta[job.Id]
+	delete(s.pendingMeta, job.Id)
+	if job.Status == model.PrefetchStatusCompleted {
+		// 新版本的文件已下载，跟踪版本指向新的commit
+		org, repo, _ := splitRepoId(r.RepoId)
+		if pending {
+			s.fileDao.SaveRevisionInfo(r.RepoType, org, repo, resp, r.Revision)
+		} else if r.Commit != job.Commit {
+			// 服务重启后没有上游的响应，使用提交任务时缓存的新commit的meta，失败时保留原commit，下次同步重新提交任务
+			if err := s.fileDao.CopyRevisionInfo(r.RepoType, org, repo, job.Commit, r.Revision); err != nil {
+				zap.S().Errorf("switch tracked repo %s to %s err.%v", r.Key(), job.Commit, err)
+				r.Error = err.Error()
+				return false
+			}
+		}
+		if r.Commit != job.Commit {
+			r.Commit = job.Commit
+			r.SyncedAt = job.UpdatedAt
+		}
+	} else if job.Commit != r.Commit {
+		r.Error = fmt.Sprintf("prefetch job %s %s", job.Id, job.Status)
+	}
+	return false
+}
+
+// syncRepo 从上游获取最新的commit，与已同步的commit不一致时提交该commit的预热任务，上一次的任务未结束时跳过。
+// 任务成功前跟踪版本的meta缓存仍指向已同步的commit，避免离线节点提供文件尚未下载的版本。
+func (s *SyncService) syncRepo(key string) {
+	s.mu.Lock()
+	r, ok := s.repos[key]
+	if !ok || s.refreshJob(r) {
+		s.mu.Unlock()
+		return
+	}
+	org, repo, _ := splitRepoId(r.RepoId)
+	repoType, revision, authorization := r.RepoType, r.Revision, r.Authorization
+	s.mu.Unlock()
+
+	info, resp, err := s.fileDao.FetchRevisionInfo(repoType, org, repo, revision, authorization)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok = s.repos[key]; !ok {
+		return
+	}
+	r.CheckedAt = time.Now()
+	if err != nil {
+		zap.S().Errorf("sync tracked repo %s err.%v", key, err)
+		r.Error = err.Error()
+		s.saveRepos()
+		return
+	}
+	r.LatestCommit = info.Sha
+	if info.Sha == r.Commit {
+		s.fileDao.SaveRevisionInfo(repoType, org, repo, resp, revision, info.Sha)
+	} else {
+		zap.S().Infof("tracked repo %s has new commit %s, last synced commit %s", key, info.Sha, r.Commit)
+		// 只写入新commit的meta，预热任务按commit获取文件列表，离线节点也能执行
+		s.fileDao.SaveRevisionInfo(repoType, org, repo, resp, info.Sha)
+		req := r.PrefetchRequest
+		req.Revision = info.Sha
+		job := s.prefetchService.Submit(req, r.Authorization)
+		r.JobId = job.Id
+		s.pendingMeta[job.Id] = resp
+		go s.waitJob(key, job.Id)
+	}
+	r.Error = ""
+	s.saveRepos()
+}
+
+// waitJob 等待同步的预热任务结束，及时更新同步状态及跟踪版本的meta缓存
+func (s *SyncService) waitJob(key, jobId string) {
+	for {
+		time.Sleep(syncJobPollInterval)
+		job, ok := s.prefetchService.Job(jobId)
+		if !ok || job.Finished() {
+			break
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.repos[key]; ok && r.JobId == jobId {
+		s.refreshJob(r)
+		s.saveRepos()
+	} else {
+		delete(s.pendingMeta, jobId)
+	}
+}
+
+func (s *SyncService) trackedList() []model.TrackedRepo {
+	s.mu.Lock()
+	repos := make([]model.TrackedRepo, 0, len(s.repos))
+	for _, r := range s.repos {
+		s.refreshJob(r)
+		repos = append(repos, *r)
+	}
+	s.mu.Unlock()
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].Key() < repos[j].Key()
+	})
+	return repos
+}
+
+func (s *SyncService) ListTracked(c echo.Context) error {
+	return util.ResponseData(c, s.trackedList())
+}
+
+// AddTracked 通过接口添加跟踪的仓库并立即同步，token只保存在内存中
+func (s *SyncService) AddTracked(c echo.Context, req model.PrefetchRequest) error {
+	if !validPrefetchRequest(&req) {
+		return util.ErrorRequestParam(c)
+	}
+	r := &model.TrackedRepo{PrefetchRequest: req, Source: model.TrackedSourceApi}
+	s.mu.Lock()
+	if old, ok := s.repos[r.Key()]; ok {
+		if old.Source == model.TrackedSourceConfig {
+			s.mu.Unlock()
+			return util.ErrorEntryUnknown(c, http.StatusConflict, "repo is tracked by config file")
+		}
+		old.Allow, old.Ignore = req.Allow, req.Ignore
+		r = old
+	}
+	if authorization := c.Request().Header.Get("authorization"); authorization != "" {
+		r.Authorization = authorization
+	}
+	s.repos[r.Key()] = r
+	s.saveRepos()
+	ret := *r
+	s.mu.Unlock()
+	s.Trigger()
+	return util.ResponseData(c, ret)
+}
+
+// RemoveTracked 取消跟踪通过接口添加的仓库，已缓存的文件保留
+func (s *SyncService) RemoveTracked(c echo.Context, req model.PrefetchRequest) error {
+	if req.Revision == "" {
+		req.Revision = "main"
+	}
+	r := &model.TrackedRepo{PrefetchRequest: req}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.repos[r.Key()]
+	if !ok {
+		return util.ErrorEntryNotFound(c)
+	}
+	if old.Source == model.TrackedSourceConfig {
+		return util.ErrorEntryUnknown(c, http.StatusConflict, "repo is tracked by config file")
+	}
+	delete(s.repos, r.Key())
+	s.saveRepos()
+	return util.ResponseData(c, *old)
+}
+
+// Trigger 立即同步所有跟踪的仓库，正在同步时合并为一次
+func (s *SyncService) Trigger() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (s *SyncService) SyncTracked(c echo.Context) error {
+	s.Trigger()
+	return util.ResponseData(c, s.trackedList())
+}
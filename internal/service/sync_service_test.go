@@ -0,0 +1,279 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dingospeed/internal/dao"
+	"dingospeed/internal/model"
+	"dingospeed/pkg/common"
+	"dingospeed/pkg/config"
+
+	"github.com/labstack/echo/v4"
+)
+
+const trackedKey = "models/" + testRepoId + "@main"
+
+// newTestSyncService 与NewSyncService相同，但不启动定期同步，测试结束后不再跟踪任何仓库，避免等待任务的协程写入已删除的目录
+func newTestSyncService(t *testing.T, prefetchService *PrefetchService) *SyncService {
+	s := &SyncService{
+		fileDao:         prefetchService.fileDao,
+		prefetchService: prefetchService,
+		repos:           make(map[string]*model.TrackedRepo),
+		pendingMeta:     make(map[string]*common.Response),
+		trigger:         make(chan struct{}, 1),
+	}
+	s.loadRepos()
+	t.Cleanup(func() {
+		s.mu.Lock()
+		s.repos = make(map[string]*model.TrackedRepo)
+		s.mu.Unlock()
+	})
+	return s
+}
+
+// trackRepo 通过配置文件跟踪testRepoId的main分支
+func trackRepo(t *testing.T) {
+	config.SysConfig.Sync.Repos = []config.TrackedRepo{{RepoType: "models", RepoId: testRepoId}}
+	t.Cleanup(func() {
+		config.SysConfig.Sync.Repos = nil
+	})
+}
+
+// syncAndWait 同步一次并等待提交的任务结束，返回同步后的状态
+func syncAndWait(t *testing.T, s *SyncService) (model.PrefetchJob, model.TrackedRepo) {
+	s.syncRepo(trackedKey)
+	s.mu.Lock()
+	jobId := s.repos[trackedKey].JobId
+	s.mu.Unlock()
+	job := waitJob(t, s.prefetchService, jobId)
+	return job, tracked(t, s)
+}
+
+func tracked(t *testing.T, s *SyncService) model.TrackedRepo {
+	for _, r := range s.trackedList() {
+		if r.Key() == trackedKey {
+			return r
+		}
+	}
+	t.Fatalf("%s is not tracked", trackedKey)
+	return model.TrackedRepo{}
+}
+
+// mainCommit 返回跟踪版本的meta缓存指向的commit
+func mainCommit(t *testing.T, s *SyncService) string {
+	cacheContent, err := s.fileDao.ReadCacheRequest(filepath.Join(config.SysConfig.Repos(), "api", "models", testRepoId, "revision", "main", "meta_get.json"))
+	if err != nil {
+		t.Fatalf("read cached meta of main err.%v", err)
+	}
+	var info dao.CommitHfSha
+	if err = json.Unmarshal(cacheContent.OriginContent, &info); err != nil {
+		t.Fatal(err)
+	}
+	return info.Sha
+}
+
+// 上游有新的commit时提交预热任务，任务成功后跟踪版本的meta才指向新的commit，未变化的文件不重复下载
+func TestSyncNewCommit(t *testing.T) {
+	setup(t)
+	trackRepo(t)
+	config.SysConfig.Server.Online = false // 离线节点同样从上游同步
+	weights := []byte("weights")
+	first := hub.commit(map[string][]byte{"config.json": []byte(`{"v":1}`), "model.bin": weights})
+	s := newTestSyncService(t, newTestPrefetchService())
+
+	job, r := syncAndWait(t, s)
+	if job.Status != model.PrefetchStatusCompleted || job.Commit != first {
+		t.Fatalf("job %s at %s, want completed at %s", job.Status, job.Commit, first)
+	}
+	if r.Commit != first || r.LatestCommit != first || r.Error != "" || r.Source != model.TrackedSourceConfig {
+		t.Fatalf("tracked repo %+v after the first sync", r)
+	}
+	if got := mainCommit(t, s); got != first {
+		t.Fatalf("main points to %s, want %s", got, first)
+	}
+
+	second := hub.commit(map[string][]byte{"config.json": []byte(`{"v":2}`), "model.bin": weights})
+	s.syncRepo(trackedKey)
+	s.mu.Lock()
+	jobId := s.repos[trackedKey].JobId
+	s.mu.Unlock()
+	waitJob(t, s.prefetchService, jobId)
+	// 任务结束但尚未刷新同步状态时，跟踪版本仍指向已同步的commit
+	if got := mainCommit(t, s); got != first {
+		t.Fatalf("main points to %s before the job is refreshed, want %s", got, first)
+	}
+	if r = tracked(t, s); r.Commit != second || r.Error != "" {
+		t.Fatalf("tracked repo %+v after the second sync", r)
+	}
+	if got := mainCommit(t, s); got != second {
+		t.Fatalf("main points to %s, want %s", got, second)
+	}
+	if !cached(second, "config.json", []byte(`{"v":2}`)) || !cached(second, "model.bin", weights) {
+		t.Fatal("files of the new commit are not cached")
+	}
+	if n := hub.count("/" + testRepoId + "/resolve/" + second + "/model.bin"); n != 0 {
+		t.Fatalf("unchanged model.bin is downloaded %d times", n)
+	}
+
+	// commit未变化时不提交任务
+	s.syncRepo(trackedKey)
+	if r = tracked(t, s); r.JobId != jobId {
+		t.Fatalf("job %s is submitted for an unchanged commit", r.JobId)
+	}
+}
+
+// 预热任务失败时跟踪版本的meta保留原commit，下次同步重新提交任务
+func TestSyncFailedJobKeepsMeta(t *testing.T) {
+	setup(t)
+	trackRepo(t)
+	first := hub.commit(map[string][]byte{"config.json": []byte(`{"v":1}`)})
+	s := newTestSyncService(t, newTestPrefetchService())
+	syncAndWait(t, s)
+
+	second := hub.commit(map[string][]byte{"config.json": []byte(`{"v":1}`), "model.bin": []byte("new weights")})
+	hub.setBroken("model.bin", true)
+	job, r := syncAndWait(t, s)
+	if job.Status != model.PrefetchStatusFailed {
+		t.Fatalf("job %s, want failed", job.Status)
+	}
+	if r.Commit != first || r.LatestCommit != second || !strings.Contains(r.Error, job.Id) {
+		t.Fatalf("tracked repo %+v after the failed job", r)
+	}
+	if got := mainCommit(t, s); got != first {
+		t.Fatalf("main points to %s after the failed job, want %s", got, first)
+	}
+
+	hub.setBroken("model.bin", false)
+	job, r = syncAndWait(t, s)
+	if job.Status != model.PrefetchStatusCompleted || r.Commit != second || r.Error != "" {
+		t.Fatalf("job %s, tracked repo %+v after retry", job.Status, r)
+	}
+	if got := mainCommit(t, s); got != second {
+		t.Fatalf("main points to %s after retry, want %s", got, second)
+	}
+}
+
+// 任务结束前服务重启时，重启后使用缓存的新commit的meta切换跟踪版本
+func TestSyncJobFinishedAfterRestart(t *testing.T) {
+	setup(t)
+	trackRepo(t)
+	first := hub.commit(map[string][]byte{"config.json": []byte(`{"v":1}`)})
+	s := newTestSyncService(t, newTestPrefetchService())
+	syncAndWait(t, s)
+
+	second := hub.commit(map[string][]byte{"config.json": []byte(`{"v":2}`)})
+	s.syncRepo(trackedKey)
+	s.mu.Lock()
+	jobId := s.repos[trackedKey].JobId
+	s.mu.Unlock()
+	waitJob(t, s.prefetchService, jobId)
+	if got := mainCommit(t, s); got != first {
+		t.Fatalf("main points to %s before restart, want %s", got, first)
+	}
+
+	restarted := newTestSyncService(t, newTestPrefetchService())
+	if r := tracked(t, restarted); r.Commit != second || r.JobId != jobId || r.Error != "" {
+		t.Fatalf("tracked repo %+v after restart", r)
+	}
+	if got := mainCommit(t, restarted); got != second {
+		t.Fatalf("main points to %s after restart, want %s", got, second)
+	}
+}
+
+// 配置文件中的仓库覆盖持久化的参数并保留同步状态，配置文件中删除的仓库不再跟踪；接口只能修改通过接口添加的仓库
+func TestTrackedSources(t *testing.T) {
+	setup(t)
+	saved := []*model.TrackedRepo{
+		{PrefetchRequest: model.PrefetchRequest{RepoType: "models", RepoId: testRepoId, Revision: "main"}, Source: model.TrackedSourceConfig, Commit: "c1"},
+		{PrefetchRequest: model.PrefetchRequest{RepoType: "models", RepoId: "org/removed", Revision: "main"}, Source: model.TrackedSourceConfig},
+		{PrefetchRequest: model.PrefetchRequest{RepoType: "datasets", RepoId: "org/data", Revision: "main"}, Source: model.TrackedSourceApi, Commit: "d1"},
+	}
+	if err := saveJsonFile(trackedFile(), saved); err != nil {
+		t.Fatal(err)
+	}
+	config.SysConfig.Sync.Repos = []config.TrackedRepo{{RepoType: "models", RepoId: testRepoId, Allow: []string{"*.json"}, Token: "secret"}}
+	t.Cleanup(func() {
+		config.SysConfig.Sync.Repos = nil
+	})
+	s := newTestSyncService(t, newTestPrefetchService())
+
+	repos := s.trackedList()
+	if len(repos) != 2 {
+		t.Fatalf("tracked %d repos, want 2: %+v", len(repos), repos)
+	}
+	if r := repos[0]; r.Key() != "datasets/org/data@main" || r.Source != model.TrackedSourceApi || r.Commit != "d1" {
+		t.Fatalf("api repo %+v", r)
+	}
+	if r := repos[1]; r.Key() != trackedKey || r.Source != model.TrackedSourceConfig || r.Commit != "c1" ||
+		len(r.Allow) != 1 || r.Allow[0] != "*.json" || r.Authorization != "Bearer secret" {
+		t.Fatalf("config repo %+v", r)
+	}
+
+	e := echo.New()
+	call := func(f func(c echo.Context, req model.PrefetchRequest) error, req model.PrefetchRequest, authorization string) int {
+		httpReq := httptest.NewRequest(http.MethodPost, "/", nil)
+		if authorization != "" {
+			httpReq.Header.Set("authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		if err := f(e.NewContext(httpReq, rec), req); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code
+	}
+	configured := model.PrefetchRequest{RepoType: "models", RepoId: testRepoId}
+	if code := call(s.AddTracked, configured, ""); code != http.StatusConflict {
+		t.Fatalf("add a repo tracked by config: %d, want 409", code)
+	}
+	if code := call(s.RemoveTracked, configured, ""); code != http.StatusConflict {
+		t.Fatalf("remove a repo tracked by config: %d, want 409", code)
+	}
+	added := model.PrefetchRequest{RepoType: "models", RepoId: "org/added"}
+	if code := call(s.AddTracked, added, "Bearer token"); code != http.StatusOK {
+		t.Fatalf("add repo: %d, want 200", code)
+	}
+	s.mu.Lock()
+	r, ok := s.repos["models/org/added@main"]
+	s.mu.Unlock()
+	if !ok || r.Source != model.TrackedSourceApi || r.Authorization != "Bearer token" {
+		t.Fatalf("added repo %+v", r)
+	}
+	// token不持久化
+	b, err := os.ReadFile(filepath.Join(config.SysConfig.Repos(), "tracked.json"))
+	if err != nil || strings.Contains(string(b), "token") || strings.Contains(string(b), "secret") {
+		t.Fatalf("tracked.json %s, err %v", b, err)
+	}
+	var persisted []model.TrackedRepo
+	if err = json.Unmarshal(b, &persisted); err != nil || len(persisted) != 3 {
+		t.Fatalf("persisted %d repos, err %v", len(persisted), err)
+	}
+	if code := call(s.RemoveTracked, added, ""); code != http.StatusOK {
+		t.Fatalf("remove repo: %d, want 200", code)
+	}
+	if code := call(s.RemoveTracked, added, ""); code != http.StatusNotFound {
+		t.Fatalf("remove a removed repo: %d, want 404", code)
+	}
+	if code := call(s.AddTracked, model.PrefetchRequest{RepoType: "models", RepoId: "../repo"}, ""); code != http.StatusBadRequest {
+		t.Fatalf("add an invalid repo: %d, want 400", code)
+	}
+}
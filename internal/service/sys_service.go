@@ -4,12 +4,18 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	"dingospeed/internal/bundle"
+	"dingospeed/internal/downloader"
 	"dingospeed/pkg/config"
+	"dingospeed/pkg/consts"
+	"dingospeed/pkg/upstream"
 	"dingospeed/pkg/util"
 
+	"github.com/labstack/echo/v4"
 	"github.com/shirou/gopsutil/mem"
 	"go.uber.org/zap"
 )
@@ -30,6 +36,14 @@ func NewSysService() *SysService {
 			if config.SysConfig.DiskClean.Enabled {
 				go sysSvc.cycleCheckDiskUsage()
 			}
+
+			if config.SysConfig.Online() && config.SysConfig.Upstream.HealthCheckPeriod > 0 {
+				go upstream.HealthCheck()
+			}
+
+			if config.SysConfig.HubCache.Enabled {
+				go sysSvc.cycleLinkHubCache()
+			}
 		})
 	return sysSvc
 }
@@ -61,6 +75,24 @@ func (s SysService) cycleCheckDiskUsage() {
 	}
 }
 
+// cycleLinkHubCache 定期将新转换为普通文件的blob链接到huggingface_hub缓存目录，并清理被删除的文件
+func (s SysService) cycleLinkHubCache() {
+	if !config.SysConfig.Download.MaterializeBlob {
+		zap.S().Warnf("materializeBlob is disabled, hub cache %s only links blobs that are already plain files", config.SysConfig.HubCache.Path)
+	}
+	ticker := time.NewTicker(config.SysConfig.GetHubCachePeriod())
+	defer ticker.Stop()
+	for {
+		result, err := bundle.LinkHfLayout(config.SysConfig.Repos(), config.SysConfig.HubCache.Path)
+		if err != nil {
+			zap.S().Errorf("link hub cache %s err.%v", config.SysConfig.HubCache.Path, err)
+		} else if result.Linked > 0 || result.Refs > 0 || result.Removed > 0 {
+			zap.S().Infof("hub cache linked %d files, %d refs, removed %d links, %d files pending", result.Linked, result.Refs, result.Removed, result.Pending)
+		}
+		<-ticker.C
+	}
+}
+
 // 检查磁盘使用情况
 func checkDiskUsage() {
 	if !config.SysConfig.Online() {
@@ -137,3 +169,62 @@ func checkDiskUsage() {
 	currentSizeH = util.ConvertBytesToHumanReadable(currentSize)
 	zap.S().Infof("Cleaning finished. Limit: %s, Current: %s.\n", limitSizeH, currentSizeH)
 }
+
+// BlobVerifyStatus 返回仓库下所有blob文件的完整性校验状态
+func (s SysService) BlobVerifyStatus(c echo.Context, repoType, org, repo string) error {
+	blobsDir, ok := getBlobsDir(repoType, org, repo)
+	if !ok {
+		return util.ErrorRequestParam(c)
+	}
+	entries, err := os.ReadDir(blobsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return util.ErrorRepoNotFound(c)
+		}
+		zap.S().Errorf("read blobs dir %s err.%v", blobsDir, err)
+		return util.ErrorProxyError(c)
+	}
+	infos := make([]downloader.BlobVerifyInfo, 0, len(entries))
+	for _, entry := range entries {
+		// 跳过转换中的临时文件等非blob文件
+		if entry.IsDir() || strings.Contains(entry.Name(), ".") {
+			continue
+		}
+		info, ok := downloader.GetBlobVerifyInfo(filepath.Join(blobsDir, entry.Name()))
+		if !ok {
+			info = downloader.BlobVerifyInfo{Oid: entry.Name(), Status: downloader.BlobVerifyStatusUnknown}
+		}
+		infos = append(infos, info)
+	}
+	return util.ResponseData(c, infos)
+}
+
+// BlobVerify 手动触发blob文件的完整性校验，校验异步执行，结果通过BlobVerifyStatus查询
+func (s SysService) BlobVerify(c echo.Context, repoType, org, repo, oid string) error {
+	blobsDir, ok := getBlobsDir(repoType, org, repo)
+	if !ok || !isPathSegment(oid) {
+		return util.ErrorRequestParam(c)
+	}
+	blobsFile := filepath.Join(blobsDir, oid)
+	if !util.FileExists(blobsFile) {
+		return util.ErrorEntryNotFound(c)
+	}
+	downloader.StartBlobVerify(blobsFile)
+	info, _ := downloader.GetBlobVerifyInfo(blobsFile)
+	return util.ResponseData(c, info)
+}
+
+func getBlobsDir(repoType, org, repo string) (string, bool) {
+	if _, ok := consts.RepoTypesMapping[repoType]; !ok {
+		return "", false
+	}
+	if (org != "" && !isPathSegment(org)) || !isPathSegment(repo) {
+		return "", false
+	}
+	return filepath.Join(config.SysConfig.Repos(), "files", repoType, util.GetOrgRepo(org, repo), "blobs"), true
+}
+
+// isPathSegment 参数只能是单级目录名，防止访问repos以外的路径
+func isPathSegment(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\")
+}
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"dingospeed/internal/model"
@@ -40,6 +41,11 @@ type Config struct {
 	Retry            Retry            `json:"retry" yaml:"retry"`
 	TokenBucketLimit TokenBucketLimit `json:"tokenBucketLimit" yaml:"tokenBucketLimit"`
 	DiskClean        DiskClean        `json:"diskClean" yaml:"diskClean"`
+	Upstream         Upstream         `json:"upstream" yaml:"upstream"`
+	Bandwidth        Bandwidth        `json:"bandwidth" yaml:"bandwidth"`
+	Prefetch         Prefetch         `json:"prefetch" yaml:"prefetch"`
+	Sync             Sync             `json:"sync" yaml:"sync"`
+	HubCache         HubCache         `json:"hubCache" yaml:"hubCache"`
 }
 
 type ServerConfig struct {
@@ -53,11 +59,16 @@ type ServerConfig struct {
 	Repos     string `json:"repos" yaml:"repos"`
 	HfNetLoc  string `json:"hfNetLoc" yaml:"hfNetLoc"`
 	HfScheme  string `json:"hfScheme" yaml:"hfScheme" validate:"oneof=https http"`
+	// 客户端访问本服务的地址，如https://mirror.example.com，用于返回给客户端的绝对地址（分页的Link等），
+	// 经TLS终止的反向代理访问时需配置，未配置时按请求的协议及Host拼接
+	ExternalUrl string `json:"externalUrl" yaml:"externalUrl" validate:"omitempty,url"`
+	// 访问/admin接口需在X-Admin-Token头中携带的token，未配置时只允许本机访问
+	AdminToken string `json:"-" yaml:"adminToken"`
 }
 
 type Download struct {
 	RetryChannelNum         int   `json:"retryChannelNum" yaml:"retryChannelNum"`
-	GoroutineMaxNumPerFile  int   `json:"goroutineMaxNumPerFile" yaml:"goroutineMaxNumPerFile" validate:"min=1,max=8"`
+	GoroutineMaxNumPerFile  int   `json:"goroutineMaxNumPerFile" yaml:"goroutineMaxNumPerFile" validate:"min=1,max=64"`
 	BlockSize               int64 `json:"blockSize" yaml:"blockSize" validate:"min=1048576,max=134217728"`
 	ReqTimeout              int64 `json:"reqTimeout" yaml:"reqTimeout"`
 	RespChunkSize           int64 `json:"respChunkSize" yaml:"respChunkSize" validate:"min=4096,max=8388608"`
@@ -65,6 +76,9 @@ type Download struct {
 	RemoteFileRangeSize     int64 `json:"remoteFileRangeSize" yaml:"remoteFileRangeSize" validate:"min=0,max=1073741824"`
 	RemoteFileRangeWaitTime int64 `json:"remoteFileRangeWaitTime" yaml:"remoteFileRangeWaitTime" validate:"min=1,max=10"`
 	RemoteFileBufferSize    int64 `json:"remoteFileBufferSize" yaml:"remoteFileBufferSize" validate:"min=0,max=134217728"`
+	MaterializeBlob         bool  `json:"materializeBlob" yaml:"materializeBlob"`                                           // 完整且校验通过的blob转换为不带头部的普通文件
+	Adaptive                bool  `json:"adaptive" yaml:"adaptive"`                                                         // 按吞吐自适应调整每个文件的并发分段数及每个上游的分段大小
+	GlobalRemoteConcurrency int   `json:"globalRemoteConcurrency" yaml:"globalRemoteConcurrency" validate:"min=0,max=4096"` // 所有文件同时进行的分段下载数上限，0表示不限制
 }
 
 type Cache struct {
@@ -87,10 +101,15 @@ type LogConfig struct {
 	MaxAge     int `json:"maxAge" yaml:"maxAge"`
 }
 
+// TokenBucketLimit 请求并发限制和按客户端（来源IP、token）的限流，限流各项为0表示不限制
 type TokenBucketLimit struct {
-	Capacity        int `json:"capacity" yaml:"capacity"`
-	Rate            int `json:"rate" yaml:"rate"`
-	HandlerCapacity int `json:"handlerCapacity" yaml:"handlerCapacity"`
+	Capacity        int   `json:"capacity" yaml:"capacity" validate:"min=0"` // 每个客户端的请求令牌桶容量，即允许的突发请求数
+	Rate            int   `json:"rate" yaml:"rate" validate:"min=0"`         // 每个客户端每秒允许的请求数
+	HandlerCapacity int   `json:"handlerCapacity" yaml:"handlerCapacity"`
+	MaxWaitTime     int   `json:"maxWaitTime" yaml:"maxWaitTime" validate:"min=0"`   // 处理任务已满时请求的最长排队时间，单位秒，0表示不排队
+	MaxQueueSize    int   `json:"maxQueueSize" yaml:"maxQueueSize" validate:"min=0"` // 排队请求数的上限，0表示不限制
+	ByteRate        int64 `json:"byteRate" yaml:"byteRate" validate:"min=0"`         // 每个客户端的下载速率上限，单位字节/秒
+	DailyQuota      int64 `json:"dailyQuota" yaml:"dailyQuota" validate:"min=0"`     // 每个客户端每天的下载量上限，单位字节
 }
 
 type DiskClean struct {
@@ -100,10 +119,86 @@ type DiskClean struct {
 	CollectTimePeriod  int    `json:"collectTimePeriod" yaml:"collectTimePeriod" validate:"min=1,max=600"` // 周期采集内存使用量，单位秒
 }
 
+// Upstream 上游Hub地址列表，按顺序优先使用，不可用时自动切换到下一个
+type Upstream struct {
+	Urls              []string `json:"urls" yaml:"urls" validate:"dive,url"`                                 // 未配置时使用hfScheme://hfNetLoc
+	HealthCheckPeriod int      `json:"healthCheckPeriod" yaml:"healthCheckPeriod" validate:"min=0,max=3600"` // 健康检查周期，单位秒，0表示不检查
+	HealthCheckPath   string   `json:"healthCheckPath" yaml:"healthCheckPath"`
+	FailureThreshold  int      `json:"failureThreshold" yaml:"failureThreshold" validate:"min=1,max=100"` // 连续失败多少次后熔断
+	BreakerOpenTime   int      `json:"breakerOpenTime" yaml:"breakerOpenTime" validate:"min=1,max=3600"`  // 熔断持续时间，单位秒，之后放行一个请求试探
+	Stripe            bool     `json:"stripe" yaml:"stripe"`                                              // 同一文件的分段下载任务轮流优先使用各个上游
+	HedgeThroughput   int64    `json:"hedgeThroughput" yaml:"hedgeThroughput" validate:"min=0"`           // 分段下载吞吐低于该值时向另一个上游发起对冲请求，单位字节/秒，0表示不对冲
+	HedgeWindow       int      `json:"hedgeWindow" yaml:"hedgeWindow" validate:"min=1,max=60"`            // 统计吞吐的时间窗口，单位秒
+}
+
+// Bandwidth 从上游下载的带宽上限，单位字节/秒，0表示不限制
+type Bandwidth struct {
+	Limit     int64               `json:"limit" yaml:"limit" validate:"min=0"`
+	Upstreams map[string]int64    `json:"upstreams" yaml:"upstreams" validate:"dive,min=0"` // 按上游host单独限制，与全局上限同时生效
+	Schedule  []BandwidthSchedule `json:"schedule" yaml:"schedule" validate:"dive"`         // 按时间段覆盖全局上限，使用第一个匹配的时间段
+}
+
+type BandwidthSchedule struct {
+	Start string `json:"start" yaml:"start" validate:"datetime=15:04"`
+	End   string `json:"end" yaml:"end" validate:"datetime=15:04"` // 早于start时表示跨越零点
+	Limit int64  `json:"limit" yaml:"limit" validate:"min=0"`
+}
+
+// Prefetch 仓库预热任务
+type Prefetch struct {
+	Concurrency int `json:"concurrency" yaml:"concurrency" validate:"min=0,max=16"` // 同时执行的预热任务数
+}
+
+// Sync 定期检查跟踪的仓库，上游有新的commit时预热变化的文件，成功后更新元数据，离线节点同样从上游同步
+type Sync struct {
+	Period int           `json:"period" yaml:"period" validate:"min=0"` // 检查周期，单位分钟，0表示只在启动和手动触发时同步
+	Repos  []TrackedRepo `json:"repos" yaml:"repos" validate:"dive"`
+}
+
+type TrackedRepo struct {
+	RepoType string   `json:"repoType" yaml:"repoType" validate:"oneof=models datasets spaces"`
+	RepoId   string   `json:"repoId" yaml:"repoId" validate:"required"`
+	Revision string   `json:"revision" yaml:"revision"` // 未配置时为main
+	Allow    []string `json:"allow" yaml:"allow"`
+	Ignore   []string `json:"ignore" yaml:"ignore"`
+	Token    string   `json:"-" yaml:"token"` // 访问私有仓库的token
+}
+
+func (c *Config) GetSyncPeriod() time.Duration {
+	return time.Duration(c.Sync.Period) * time.Minute
+}
+
+// HubCache 在path下以huggingface_hub缓存目录的结构链接repos中已转换为普通文件的blob，
+// 共享存储上的作业可将HF_HUB_CACHE指向该目录直接读取文件，由服务负责写入
+type HubCache struct {
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	Path    string `json:"path" yaml:"path"`
+	Period  int    `json:"period" yaml:"period" validate:"min=0"` // 更新周期，单位秒
+}
+
+func (c *Config) GetHubCachePeriod() time.Duration {
+	if c.HubCache.Period <= 0 {
+		return time.Minute
+	}
+	return time.Duration(c.HubCache.Period) * time.Second
+}
+
+// GetHFURLBase 返回首选的上游地址
 func (c *Config) GetHFURLBase() string {
+	if len(c.Upstream.Urls) > 0 {
+		return c.Upstream.Urls[0]
+	}
 	return fmt.Sprintf("%s://%s", c.GetHfScheme(), c.GetHfNetLoc())
 }
 
+func (c *Config) GetHealthCheckPeriod() time.Duration {
+	return time.Duration(c.Upstream.HealthCheckPeriod) * time.Second
+}
+
+func (c *Config) GetBreakerOpenTime() time.Duration {
+	return time.Duration(c.Upstream.BreakerOpenTime) * time.Second
+}
+
 func (c *Config) Online() bool {
 	return c.Server.Online
 }
@@ -116,6 +211,14 @@ func (c *Config) GetHost() string {
 	return c.Server.Host
 }
 
+func (c *Config) GetExternalUrl() string {
+	return strings.TrimSuffix(c.Server.ExternalUrl, "/")
+}
+
+func (c *Config) GetAdminToken() string {
+	return c.Server.AdminToken
+}
+
 func (c *Config) GetHfNetLoc() string {
 	return c.Server.HfNetLoc
 }
@@ -128,6 +231,10 @@ func (c *Config) GetRate() int {
 	return c.TokenBucketLimit.Rate
 }
 
+func (c *Config) GetMaxWaitTime() time.Duration {
+	return time.Duration(c.TokenBucketLimit.MaxWaitTime) * time.Second
+}
+
 func (c *Config) GetHfScheme() string {
 	return c.Server.HfScheme
 }
@@ -168,6 +275,21 @@ func (c *Config) CacheCleanStrategy() string {
 	return c.DiskClean.CacheCleanStrategy
 }
 
+// GetBandwidthLimit 返回指定时刻的全局带宽上限
+func (c *Config) GetBandwidthLimit(now time.Time) int64 {
+	clock := now.Format("15:04")
+	for _, schedule := range c.Bandwidth.Schedule {
+		if schedule.Start <= schedule.End {
+			if clock >= schedule.Start && clock < schedule.End {
+				return schedule.Limit
+			}
+		} else if clock >= schedule.Start || clock < schedule.End {
+			return schedule.Limit
+		}
+	}
+	return c.Bandwidth.Limit
+}
+
 func (c *Config) SetDefaults() {
 	if c.Server.Port == 0 {
 		c.Server.Port = 8090
@@ -205,6 +327,24 @@ func (c *Config) SetDefaults() {
 	if c.DiskClean.CollectTimePeriod == 0 {
 		c.DiskClean.CollectTimePeriod = 1
 	}
+	if len(c.Upstream.Urls) == 0 && c.Server.HfNetLoc != "" {
+		c.Upstream.Urls = []string{fmt.Sprintf("%s://%s", c.Server.HfScheme, c.Server.HfNetLoc)}
+	}
+	if c.Upstream.HealthCheckPath == "" {
+		c.Upstream.HealthCheckPath = "/"
+	}
+	if c.Upstream.FailureThreshold == 0 {
+		c.Upstream.FailureThreshold = 3
+	}
+	if c.Upstream.BreakerOpenTime == 0 {
+		c.Upstream.BreakerOpenTime = 30
+	}
+	if c.Upstream.HedgeWindow == 0 {
+		c.Upstream.HedgeWindow = 5
+	}
+	if c.Prefetch.Concurrency == 0 {
+		c.Prefetch.Concurrency = 1
+	}
 }
 
 func Scan(path string) (*Config, error) {
@@ -33,12 +33,19 @@ func (a RepoType) Value() string {
 	return string(a)
 }
 
-const HUGGINGFACE_HEADER_X_REPO_COMMIT = "X-Repo-Commit"
+const (
+	HUGGINGFACE_HEADER_X_REPO_COMMIT = "X-Repo-Commit"
+	HUGGINGFACE_HEADER_X_LINKED_ETAG = "x-linked-etag"
+	HUGGINGFACE_HEADER_X_LINKED_SIZE = "x-linked-size"
+)
 
 const (
 	RequestTypeHead = "head"
 	RequestTypeGet  = "get"
+	RequestTypePost = "post"
 )
 
 const RespChanSize = 100
 const PromSource = "source"
+const ClientSession = "clientSession"    // 请求上下文中按客户端限流的会话
+const HeaderAdminToken = "X-Admin-Token" // 访问管理接口的token
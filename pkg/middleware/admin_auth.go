@@ -0,0 +1,50 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"crypto/subtle"
+	"net"
+
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/consts"
+	"dingospeed/pkg/util"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// AdminAuthMiddleware 管理接口的访问控制：配置了adminToken时请求需在X-Admin-Token头中携带该token，
+// 未配置时只允许本机访问。来源地址取自连接，不使用X-Forwarded-For，经反向代理访问时需配置adminToken。
+func AdminAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if token := config.SysConfig.GetAdminToken(); token != "" {
+			if subtle.ConstantTimeCompare([]byte(c.Request().Header.Get(consts.HeaderAdminToken)), []byte(token)) != 1 {
+				zap.S().Warnf("admin request %s %s from %s with invalid token", c.Request().Method, c.Request().URL.Path, c.Request().RemoteAddr)
+				return util.ErrorUnauthorized(c)
+			}
+			return next(c)
+		}
+		source, _, err := net.SplitHostPort(c.Request().RemoteAddr)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(source); ip == nil || !ip.IsLoopback() {
+			zap.S().Warnf("admin request %s %s from %s is rejected, only localhost is allowed without adminToken", c.Request().Method, c.Request().URL.Path, source)
+			return util.ErrorForbidden(c)
+		}
+		return next(c)
+	}
+}
@@ -0,0 +1,64 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/consts"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		adminToken string
+		remoteAddr string
+		header     string
+		status     int
+	}{
+		{"localhost without token", "", "127.0.0.1:1234", "", http.StatusOK},
+		{"ipv6 localhost without token", "", "[::1]:1234", "", http.StatusOK},
+		// X-Forwarded-For可以伪造，不作为来源地址
+		{"remote without token", "", "10.0.0.2:1234", "", http.StatusForbidden},
+		{"remote with token", "secret", "10.0.0.2:1234", "secret", http.StatusOK},
+		{"remote with wrong token", "secret", "10.0.0.2:1234", "other", http.StatusUnauthorized},
+		{"localhost without header", "secret", "127.0.0.1:1234", "", http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config.SysConfig.Server.AdminToken = tc.adminToken
+			t.Cleanup(func() { config.SysConfig.Server.AdminToken = "" })
+			e := echo.New()
+			e.Group("/admin", AdminAuthMiddleware).GET("/prefetch", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/admin/prefetch", nil)
+			req.RemoteAddr = tc.remoteAddr
+			req.Header.Set("X-Forwarded-For", "127.0.0.1")
+			if tc.header != "" {
+				req.Header.Set(consts.HeaderAdminToken, tc.header)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tc.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.status)
+			}
+		})
+	}
+}
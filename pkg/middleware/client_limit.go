@@ -0,0 +1,72 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/consts"
+	"dingospeed/pkg/prom"
+	"dingospeed/pkg/ratelimit"
+	"dingospeed/pkg/util"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+var clientLimiter *ratelimit.ClientLimiter
+
+func initClientLimiter() {
+	limit := config.SysConfig.TokenBucketLimit
+	if limit.Rate <= 0 && limit.ByteRate <= 0 && limit.DailyQuota <= 0 {
+		return
+	}
+	clientLimiter = ratelimit.NewClientLimiter(config.SysConfig.GetCapacity(), config.SysConfig.GetRate(), limit.ByteRate, limit.DailyQuota)
+}
+
+// ClientLimitMiddleware 按来源IP限流，请求携带token时同时按token限流，避免单个客户端占满整个集群的资源。
+// 准入的请求在上下文中记录限流会话，响应数据时按字节速率等待，请求结束后结束会话。
+func ClientLimitMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if clientLimiter == nil || strings.Contains(c.Request().URL.Path, "metrics") {
+			return next(c)
+		}
+		source, _, err := net.SplitHostPort(c.Request().RemoteAddr)
+		if err != nil {
+			return err
+		}
+		keys := []string{"ip:" + source}
+		if authorization := c.Request().Header.Get("authorization"); authorization != "" {
+			// 不在内存中保存token原文
+			sum := sha256.Sum256([]byte(authorization))
+			keys = append(keys, "token:"+hex.EncodeToString(sum[:8]))
+		}
+		session, retryAfter := clientLimiter.Admit(keys)
+		if session == nil {
+			zap.S().Debugf("client %s is rate limited, retry after %s", source, retryAfter)
+			if config.SysConfig.EnableMetric() {
+				prom.PromSourceCounter(prom.RequestTooManyCnt, source)
+			}
+			return util.ErrorTooManyRequestRetryAfter(c, retryAfter)
+		}
+		defer session.Done()
+		c.Set(consts.ClientSession, session)
+		return next(c)
+	}
+}
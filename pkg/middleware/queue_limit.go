@@ -12,10 +12,11 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-var requestQueue chan struct{}
+var requestQueue *handlerQueue
 
 func InitMiddlewareConfig() {
-	requestQueue = make(chan struct{}, config.SysConfig.TokenBucketLimit.HandlerCapacity)
+	requestQueue = newHandlerQueue(config.SysConfig.TokenBucketLimit.HandlerCapacity, config.SysConfig.GetMaxWaitTime(), config.SysConfig.TokenBucketLimit.MaxQueueSize)
+	initClientLimiter()
 }
 
 func QueueLimitMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
@@ -35,22 +36,18 @@ func QueueLimitMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 			promFlag := strings.Contains(url, "resolve") || strings.Contains(url, "revision")
 			if promFlag {
 				prom.PromSourceCounter(prom.RequestTotalCnt, source)
-				select {
-				case requestQueue <- struct{}{}:
-					defer func() {
-						<-requestQueue
-					}()
-					if err = next(c); err != nil {
-						prom.PromSourceCounter(prom.RequestFailCnt, source)
-						return err
-					} else {
-						prom.PromSourceCounter(prom.RequestSuccessCnt, source)
-						return nil
-					}
-				default:
+				if !requestQueue.acquire(c.Request().Context(), requestPriority(c)) {
 					prom.PromSourceCounter(prom.RequestTooManyCnt, source)
 					return util.ErrorTooManyRequest(c)
 				}
+				defer requestQueue.release()
+				if err = next(c); err != nil {
+					prom.PromSourceCounter(prom.RequestFailCnt, source)
+					return err
+				} else {
+					prom.PromSourceCounter(prom.RequestSuccessCnt, source)
+					return nil
+				}
 			} else {
 				return nextRequest(c, next)
 			}
@@ -61,13 +58,9 @@ func QueueLimitMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 }
 
 func nextRequest(c echo.Context, next echo.HandlerFunc) error {
-	select {
-	case requestQueue <- struct{}{}:
-		defer func() {
-			<-requestQueue
-		}()
-		return next(c)
-	default:
+	if !requestQueue.acquire(c.Request().Context(), requestPriority(c)) {
 		return util.ErrorTooManyRequest(c)
 	}
+	defer requestQueue.release()
+	return next(c)
 }
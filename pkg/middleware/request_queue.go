@@ -0,0 +1,144 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/prom"
+
+	"github.com/labstack/echo/v4"
+)
+
+type priority int
+
+const (
+	priorityHigh priority = iota // 元数据请求，处理较快，优先执行
+	priorityLow                  // 文件下载
+)
+
+func (p priority) String() string {
+	if p == priorityHigh {
+		return "high"
+	}
+	return "low"
+}
+
+// requestPriority HEAD请求和api请求为元数据请求，其他为文件下载
+func requestPriority(c echo.Context) priority {
+	if c.Request().Method == http.MethodHead || strings.HasPrefix(c.Request().URL.Path, "/api/") {
+		return priorityHigh
+	}
+	return priorityLow
+}
+
+type queueWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// handlerQueue 限制同时处理的请求数，已满时请求按优先级排队，等待超过maxWait后放弃
+type handlerQueue struct {
+	mu       sync.Mutex
+	capacity int
+	running  int
+	waiters  [priorityLow + 1]*list.List
+	maxWait  time.Duration
+	maxSize  int
+}
+
+func newHandlerQueue(capacity int, maxWait time.Duration, maxSize int) *handlerQueue {
+	q := &handlerQueue{capacity: capacity, maxWait: maxWait, maxSize: maxSize}
+	for i := range q.waiters {
+		q.waiters[i] = list.New()
+	}
+	return q
+}
+
+func (q *handlerQueue) waiting() int {
+	n := 0
+	for _, l := range q.waiters {
+		n += l.Len()
+	}
+	return n
+}
+
+// acquire 占用一个处理任务，返回是否成功
+func (q *handlerQueue) acquire(ctx context.Context, p priority) bool {
+	q.mu.Lock()
+	depth := q.waiting()
+	if q.running < q.capacity && depth == 0 {
+		q.running++
+		q.mu.Unlock()
+		return true
+	}
+	if q.maxWait <= 0 || (q.maxSize > 0 && depth >= q.maxSize) {
+		q.mu.Unlock()
+		return false
+	}
+	w := &queueWaiter{ready: make(chan struct{})}
+	e := q.waiters[p].PushBack(w)
+	q.mu.Unlock()
+
+	start := time.Now()
+	if config.SysConfig.EnableMetric() {
+		prom.RequestQueueDepth.WithLabelValues(p.String()).Observe(float64(depth))
+	}
+	timer := time.NewTimer(q.maxWait)
+	defer timer.Stop()
+	ok := true
+	select {
+	case <-w.ready:
+	case <-timer.C:
+		ok = false
+	case <-ctx.Done():
+		ok = false
+	}
+	if !ok {
+		q.mu.Lock()
+		if w.granted {
+			// 超时的同时被唤醒，仍然占用了处理任务
+			ok = true
+		} else {
+			q.waiters[p].Remove(e)
+		}
+		q.mu.Unlock()
+	}
+	if config.SysConfig.EnableMetric() {
+		prom.RequestQueueWaitSeconds.WithLabelValues(p.String()).Observe(time.Since(start).Seconds())
+	}
+	return ok
+}
+
+// release 释放处理任务，有请求排队时直接交给优先级最高的请求
+func (q *handlerQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, l := range q.waiters {
+		if e := l.Front(); e != nil {
+			w := l.Remove(e).(*queueWaiter)
+			w.granted = true
+			close(w.ready)
+			return
+		}
+	}
+	q.running--
+}
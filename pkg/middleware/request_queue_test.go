@@ -0,0 +1,137 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"dingospeed/pkg/config"
+)
+
+func TestMain(m *testing.M) {
+	config.SysConfig = &config.Config{}
+	os.Exit(m.Run())
+}
+
+// 排队超过maxWait后放弃，超时的请求不占用处理任务
+func TestHandlerQueueTimeout(t *testing.T) {
+	q := newHandlerQueue(1, 50*time.Millisecond, 0)
+	if !q.acquire(context.Background(), priorityLow) {
+		t.Fatal("first request is rejected")
+	}
+	start := time.Now()
+	if q.acquire(context.Background(), priorityLow) {
+		t.Fatal("queued request is admitted while the queue is full")
+	}
+	if cost := time.Since(start); cost < 50*time.Millisecond || cost > time.Second {
+		t.Fatalf("queued request gave up after %s, want about 50ms", cost)
+	}
+	if q.waiting() != 0 {
+		t.Fatalf("%d timed out waiters left in the queue", q.waiting())
+	}
+	q.release()
+	if !q.acquire(context.Background(), priorityLow) || q.running != 1 {
+		t.Fatalf("request is rejected after release, running = %d", q.running)
+	}
+}
+
+// 请求取消后立即放弃排队
+func TestHandlerQueueContextCancelled(t *testing.T) {
+	q := newHandlerQueue(1, time.Minute, 0)
+	q.acquire(context.Background(), priorityLow)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if q.acquire(ctx, priorityLow) {
+		t.Fatal("cancelled request is admitted")
+	}
+	if cost := time.Since(start); cost > time.Second {
+		t.Fatalf("cancelled request gave up after %s", cost)
+	}
+}
+
+// 队列已满或不允许等待时立即拒绝
+func TestHandlerQueueRejectImmediately(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		maxWait time.Duration
+		maxSize int
+	}{
+		{"no wait", 0, 0},
+		{"queue full", time.Minute, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newHandlerQueue(1, tc.maxWait, tc.maxSize)
+			q.acquire(context.Background(), priorityLow)
+			if tc.maxSize > 0 {
+				go q.acquire(context.Background(), priorityLow)
+				for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+					q.mu.Lock()
+					n := q.waiting()
+					q.mu.Unlock()
+					if n == tc.maxSize {
+						break
+					}
+				}
+			}
+			start := time.Now()
+			if q.acquire(context.Background(), priorityHigh) {
+				t.Fatal("request is admitted")
+			}
+			if cost := time.Since(start); cost > 100*time.Millisecond {
+				t.Fatalf("request is rejected after %s, want immediately", cost)
+			}
+		})
+	}
+}
+
+// 释放处理任务时优先交给元数据请求，同优先级按到达顺序
+func TestHandlerQueuePriority(t *testing.T) {
+	q := newHandlerQueue(1, time.Minute, 0)
+	q.acquire(context.Background(), priorityLow)
+	order := make(chan string, 3)
+	// 等待请求进入队列后再加入下一个，保证到达顺序
+	enqueue := func(name string, p priority) {
+		q.mu.Lock()
+		n := q.waiting()
+		q.mu.Unlock()
+		go func() {
+			if q.acquire(context.Background(), p) {
+				order <- name
+			}
+		}()
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			q.mu.Lock()
+			queued := q.waiting() > n
+			q.mu.Unlock()
+			if queued {
+				return
+			}
+		}
+		t.Fatalf("%s is not queued", name)
+	}
+	enqueue("low1", priorityLow)
+	enqueue("high", priorityHigh)
+	enqueue("low2", priorityLow)
+	for _, want := range []string{"high", "low1", "low2"} {
+		q.release()
+		if got := <-order; got != want {
+			t.Fatalf("granted %s, want %s", got, want)
+		}
+	}
+}
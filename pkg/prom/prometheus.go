@@ -49,12 +49,87 @@ var (
 	RequestRemoteByte = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "request_remote_byte",
 		Help: "Total number of request remote byte",
-	}, []string{"source"})
+	}, []string{"source", "upstream"})
 
 	RequestResponseByte = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "request_response_byte",
 		Help: "Total number of request response byte",
 	}, []string{"source"})
+
+	// 缓存数据块校验失败数
+
+	CacheBlockCorruptedCnt = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cache_block_corrupted_cnt",
+		Help: "Total number of corrupted cache blocks detected by checksum",
+	})
+
+	// blob文件完整性校验结果统计
+
+	BlobVerifyCnt = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "blob_verify_cnt",
+		Help: "Total number of blob verification by result status",
+	}, []string{"status"})
+
+	// 上游请求结果统计，result为success或failure
+
+	UpstreamRequestCnt = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "upstream_request_cnt",
+		Help: "Total number of upstream request by result",
+	}, []string{"upstream", "result"})
+
+	// 上游熔断状态，0正常，1熔断，2试探恢复
+
+	UpstreamState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "upstream_state",
+		Help: "Circuit breaker state of upstream",
+	}, []string{"upstream"})
+
+	// 对冲请求统计，result为win（先于原请求完成）或lose
+
+	HedgeRequestCnt = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hedge_request_cnt",
+		Help: "Total number of hedged range request by result",
+	}, []string{"upstream", "result"})
+
+	// 所有文件正在进行的分段下载数，配置了globalRemoteConcurrency时统计
+
+	RemoteRangeRunning = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "remote_range_running",
+		Help: "Number of running remote range download",
+	})
+
+	// 上游吞吐的指数加权平均值，单位字节/秒
+
+	UpstreamThroughput = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "upstream_throughput",
+		Help: "Smoothed throughput of upstream in bytes per second",
+	}, []string{"upstream"})
+
+	// 带宽限制，limiter为global或上游host
+
+	BandwidthLimit = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "bandwidth_limit",
+		Help: "Current bandwidth limit in bytes per second, 0 means unlimited",
+	}, []string{"limiter"})
+
+	BandwidthThrottledSeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bandwidth_throttled_seconds",
+		Help: "Total time remote reads waited for bandwidth tokens",
+	}, []string{"limiter"})
+
+	// 请求排队，priority为high（元数据请求）或low（文件下载）
+
+	RequestQueueDepth = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "request_queue_depth",
+		Help:    "Number of requests already waiting when a request is queued",
+		Buckets: []float64{0, 1, 5, 10, 50, 100, 500, 1000},
+	}, []string{"priority"})
+
+	RequestQueueWaitSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "request_queue_wait_seconds",
+		Help:    "Time requests waited in queue for a handler",
+		Buckets: []float64{0.01, 0.1, 0.5, 1, 5, 10, 30, 60},
+	}, []string{"priority"})
 )
 
 func PromSourceCounter(vec *prometheus.GaugeVec, source string) {
@@ -68,3 +143,10 @@ func PromRequestByteCounter(vec *prometheus.CounterVec, source string, len int64
 	labels["source"] = source
 	vec.With(labels).Add(float64(len))
 }
+
+func PromRemoteByteCounter(source, upstream string, len int64) {
+	labels := prometheus.Labels{}
+	labels["source"] = source
+	labels["upstream"] = upstream
+	RequestRemoteByte.With(labels).Add(float64(len))
+}
@@ -0,0 +1,218 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	clientIdleTTL       = 10 * time.Minute // 客户端空闲超过该时间后释放其状态
+	clientSweepInterval = time.Minute
+)
+
+// ClientLimiter 按客户端（来源IP、token等）限制请求速率、响应字节速率和每日下载量，各项为0表示不限制。
+// 一个请求可能属于多个客户端，需要同时满足每个客户端的限制。
+type ClientLimiter struct {
+	mu          sync.Mutex
+	requestRate float64 // 每秒允许的请求数
+	capacity    float64 // 请求令牌桶容量
+	byteRate    int64   // 每秒允许的响应字节数
+	dailyQuota  int64   // 每天允许的响应字节数
+	day         string
+	clients     map[string]*client
+	usage       map[string]int64 // 已释放的客户端当天已响应的字节数
+	lastSweep   time.Time
+	flowSeq     atomic.Int64
+}
+
+type client struct {
+	tokens float64
+	last   time.Time
+	bytes  *FairLimiter
+	used   int64     // 当天已响应的字节数
+	active int       // 未结束的请求数
+	seen   time.Time // 最后一次请求或请求结束的时间
+}
+
+func NewClientLimiter(capacity, requestRate int, byteRate, dailyQuota int64) *ClientLimiter {
+	if requestRate > 0 && capacity <= 0 {
+		capacity = requestRate
+	}
+	return &ClientLimiter{
+		requestRate: float64(requestRate),
+		capacity:    float64(capacity),
+		byteRate:    byteRate,
+		dailyQuota:  dailyQuota,
+		clients:     make(map[string]*client),
+		usage:       make(map[string]int64),
+		lastSweep:   time.Now(),
+	}
+}
+
+// Session 一个请求的限流状态，响应数据时按客户端的字节速率等待，并计入每日下载量
+type Session struct {
+	limiter *ClientLimiter
+	clients []*client
+	flow    int64
+	done    bool
+}
+
+// Admit 为keys对应的客户端准入一个新请求，超出限制时返回nil和建议的重试等待时间
+func (l *ClientLimiter) Admit(keys []string) (*Session, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.rollDay(now)
+	if now.Sub(l.lastSweep) >= clientSweepInterval {
+		l.sweep(now)
+	}
+	clients := make([]*client, 0, len(keys))
+	for _, key := range keys {
+		c, ok := l.clients[key]
+		if !ok {
+			c = &client{tokens: l.capacity, last: now, used: l.usage[key]}
+			if l.byteRate > 0 {
+				c.bytes = NewFairLimiter(l.byteRate)
+			}
+			delete(l.usage, key)
+			l.clients[key] = c
+		}
+		c.seen = now
+		clients = append(clients, c)
+	}
+	// 超出每日下载量时，等到第二天零点
+	if l.dailyQuota > 0 {
+		for _, c := range clients {
+			if c.used >= l.dailyQuota {
+				y, m, d := now.Date()
+				return nil, time.Date(y, m, d+1, 0, 0, 0, 0, now.Location()).Sub(now)
+			}
+		}
+	}
+	if l.requestRate > 0 {
+		var wait time.Duration
+		for _, c := range clients {
+			c.tokens = min(l.capacity, c.tokens+now.Sub(c.last).Seconds()*l.requestRate)
+			c.last = now
+			if c.tokens < 1 {
+				wait = max(wait, time.Duration((1-c.tokens)/l.requestRate*float64(time.Second)))
+			}
+		}
+		if wait > 0 {
+			return nil, wait
+		}
+		for _, c := range clients {
+			c.tokens--
+		}
+	}
+	for _, c := range clients {
+		c.active++
+	}
+	return &Session{limiter: l, clients: clients, flow: l.flowSeq.Add(1)}, 0
+}
+
+// rollDay 跨天时清空客户端状态，重新统计每日下载量，调用方需持有l.mu
+func (l *ClientLimiter) rollDay(now time.Time) {
+	if day := now.Format(time.DateOnly); day != l.day {
+		l.day = day
+		l.clients = make(map[string]*client)
+		l.usage = make(map[string]int64)
+	}
+}
+
+// sweep 释放空闲的客户端，避免来源IP和token众多时状态无限增长，调用方需持有l.mu。
+// 空闲时间超过令牌桶充满所需的时间后，重新创建的客户端与原状态等价，只需保留当天的下载量。
+func (l *ClientLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+	ttl := clientIdleTTL
+	if l.requestRate > 0 {
+		ttl = max(ttl, time.Duration(l.capacity/l.requestRate*float64(time.Second)))
+	}
+	for key, c := range l.clients {
+		if c.active > 0 || now.Sub(c.seen) < ttl {
+			continue
+		}
+		if l.dailyQuota > 0 && c.used > 0 {
+			l.usage[key] = c.used
+		}
+		delete(l.clients, key)
+	}
+}
+
+// Done 请求结束后调用，之后客户端空闲超过一定时间即可被释放
+func (s *Session) Done() {
+	s.limiter.mu.Lock()
+	defer s.limiter.mu.Unlock()
+	if s.done {
+		return
+	}
+	s.done = true
+	now := time.Now()
+	for _, c := range s.clients {
+		c.active--
+		c.seen = now
+	}
+}
+
+// Throttled 是否需要按字节速率等待
+func (s *Session) Throttled() bool {
+	return s.limiter.byteRate > 0
+}
+
+// Wait 响应n个字节后调用，计入每日下载量并按客户端的字节速率等待。
+// 请求开始后超出每日下载量时不中断当前响应。
+func (s *Session) Wait(ctx context.Context, n int64) error {
+	if n <= 0 {
+		return nil
+	}
+	s.limiter.mu.Lock()
+	for _, c := range s.clients {
+		c.used += n
+	}
+	s.limiter.mu.Unlock()
+	for _, c := range s.clients {
+		if c.bytes == nil {
+			continue
+		}
+		if _, err := c.bytes.Wait(ctx, s.flow, int(n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reader 返回读取后按字节速率等待的Reader
+func (s *Session) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return &sessionReader{ctx: ctx, r: r, s: s}
+}
+
+type sessionReader struct {
+	ctx context.Context
+	r   io.Reader
+	s   *Session
+}
+
+func (r *sessionReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if waitErr := r.s.Wait(r.ctx, int64(n)); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return n, err
+}
@@ -0,0 +1,111 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// 每个客户端单独计算请求速率，一个请求需要同时满足所属的每个客户端
+func TestClientLimiterRequestRate(t *testing.T) {
+	l := NewClientLimiter(2, 1, 0, 0)
+	for i := 0; i < 2; i++ {
+		if s, _ := l.Admit([]string{"ip:a"}); s == nil {
+			t.Fatalf("request %d is rejected", i)
+		}
+	}
+	s, retryAfter := l.Admit([]string{"ip:a"})
+	if s != nil || retryAfter <= 0 || retryAfter > time.Second {
+		t.Fatalf("third request: session=%v, retryAfter=%s", s, retryAfter)
+	}
+	if s, _ = l.Admit([]string{"ip:b"}); s == nil {
+		t.Fatal("another client is rejected")
+	}
+	if s, _ = l.Admit([]string{"ip:c", "ip:a"}); s != nil {
+		t.Fatal("request of a limited client is admitted")
+	}
+}
+
+// 超出每日下载量后拒绝新请求直到第二天，当前请求不中断，其他客户端不受影响
+func TestClientLimiterDailyQuota(t *testing.T) {
+	l := NewClientLimiter(0, 0, 0, 1000)
+	keys := []string{"ip:a", "token:x"}
+	s, _ := l.Admit(keys)
+	if s == nil {
+		t.Fatal("first request is rejected")
+	}
+	for i := 0; i < 3; i++ {
+		if err := s.Wait(context.Background(), 400); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Done()
+	now := time.Now()
+	y, m, d := now.Date()
+	tomorrow := time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+	for _, keys := range [][]string{{"ip:a"}, {"ip:b", "token:x"}} {
+		s, retryAfter := l.Admit(keys)
+		if s != nil || retryAfter <= 0 || retryAfter > tomorrow.Sub(now) {
+			t.Fatalf("%v: session=%v, retryAfter=%s", keys, s, retryAfter)
+		}
+	}
+	if s, _ = l.Admit([]string{"ip:b"}); s == nil {
+		t.Fatal("another client is rejected")
+	}
+
+	// 跨天后重新统计
+	l.day = "2000-01-01"
+	if s, _ = l.Admit(keys); s == nil {
+		t.Fatal("request is rejected after the day rolls over")
+	}
+}
+
+// 空闲的客户端被释放，正在请求的客户端保留，释放后仍计入当天的下载量
+func TestClientLimiterEvictIdleClients(t *testing.T) {
+	l := NewClientLimiter(0, 0, 1024, 1000)
+	active, _ := l.Admit([]string{"ip:active"})
+	idle, _ := l.Admit([]string{"ip:idle"})
+	if err := idle.Wait(context.Background(), 1000); err != nil {
+		t.Fatal(err)
+	}
+	idle.Done()
+	idle.Done()
+	for i := 0; i < 100; i++ {
+		s, _ := l.Admit([]string{"ip:" + string(rune('A'+i))})
+		s.Done()
+	}
+
+	l.mu.Lock()
+	l.sweep(time.Now().Add(clientIdleTTL))
+	clients, usage := len(l.clients), l.usage["ip:idle"]
+	l.mu.Unlock()
+	if clients != 1 || usage != 1000 {
+		t.Fatalf("%d clients and usage %d left after sweep, want 1 and 1000", clients, usage)
+	}
+	if s, _ := l.Admit([]string{"ip:idle"}); s != nil {
+		t.Fatal("evicted client exceeding the quota is admitted")
+	}
+
+	active.Done()
+	l.mu.Lock()
+	l.sweep(time.Now().Add(clientIdleTTL))
+	clients = len(l.clients)
+	l.mu.Unlock()
+	if clients != 0 {
+		t.Fatalf("%d clients left after all requests are done", clients)
+	}
+}
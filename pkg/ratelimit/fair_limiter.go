@@ -0,0 +1,171 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+const burstDuration = 100 * time.Millisecond // 令牌桶容量为burstDuration内产生的令牌
+
+type waiter struct {
+	n       float64
+	ready   chan struct{}
+	granted bool
+}
+
+// FairLimiter 按字节计数的令牌桶。令牌不足时请求按流排队，各流轮流获得令牌，
+// 每次请求的数据量相近时，同时等待的流平均分享带宽，未在等待的流不占用带宽。
+type FairLimiter struct {
+	mu          sync.Mutex
+	rate        float64 // 每秒产生的令牌数，0表示不限制
+	burst       float64
+	tokens      float64
+	last        time.Time
+	flows       map[int64]*list.List // 各流等待中的请求
+	order       []int64              // 有请求在等待的流，按轮转顺序排列
+	dispatching bool
+}
+
+func NewFairLimiter(rate int64) *FairLimiter {
+	l := &FairLimiter{flows: make(map[int64]*list.List), last: time.Now()}
+	l.SetRate(rate)
+	l.tokens = l.burst
+	return l
+}
+
+// SetRate 修改每秒产生的令牌数，0表示不限制
+func (l *FairLimiter) SetRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.rate = float64(max(rate, 0))
+	l.burst = l.rate * burstDuration.Seconds()
+	l.tokens = min(l.tokens, l.burst)
+}
+
+func (l *FairLimiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+// refill 调用方需持有l.mu
+func (l *FairLimiter) refill(now time.Time) {
+	if elapsed := now.Sub(l.last).Seconds(); elapsed > 0 {
+		l.tokens = min(l.burst, l.tokens+elapsed*l.rate)
+	}
+	l.last = now
+}
+
+// need 请求的数据量超过桶容量时，桶满即可放行，令牌余额允许为负，平均速率不变
+func (l *FairLimiter) need(n float64) float64 {
+	return min(n, l.burst)
+}
+
+// Wait 为flow获取n个令牌，返回等待的时间。ctx取消时放弃等待并返回ctx的错误。
+func (l *FairLimiter) Wait(ctx context.Context, flow int64, n int) (time.Duration, error) {
+	l.mu.Lock()
+	if l.rate == 0 {
+		l.mu.Unlock()
+		return 0, nil
+	}
+	l.refill(time.Now())
+	// 没有其他请求排队时直接获取，否则排在后面，保证轮转的公平性
+	if len(l.order) == 0 && l.tokens >= l.need(float64(n)) {
+		l.tokens -= float64(n)
+		l.mu.Unlock()
+		return 0, nil
+	}
+	w := &waiter{n: float64(n), ready: make(chan struct{})}
+	q, ok := l.flows[flow]
+	if !ok {
+		q = list.New()
+		l.flows[flow] = q
+		l.order = append(l.order, flow)
+	}
+	e := q.PushBack(w)
+	if !l.dispatching {
+		l.dispatching = true
+		go l.dispatch()
+	}
+	l.mu.Unlock()
+
+	start := time.Now()
+	select {
+	case <-w.ready:
+		return time.Since(start), nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		if !w.granted {
+			q.Remove(e)
+			if q.Len() == 0 {
+				l.removeFlow(flow)
+			}
+		}
+		l.mu.Unlock()
+		return time.Since(start), ctx.Err()
+	}
+}
+
+// removeFlow 调用方需持有l.mu
+func (l *FairLimiter) removeFlow(flow int64) {
+	delete(l.flows, flow)
+	for i, f := range l.order {
+		if f == flow {
+			l.order = append(l.order[:i], l.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// dispatch 按轮转顺序为各流的第一个请求分配令牌，没有请求等待时退出
+func (l *FairLimiter) dispatch() {
+	for {
+		l.mu.Lock()
+		if len(l.order) == 0 {
+			l.dispatching = false
+			l.mu.Unlock()
+			return
+		}
+		l.refill(time.Now())
+		flow := l.order[0]
+		q := l.flows[flow]
+		w := q.Front().Value.(*waiter)
+		if l.rate != 0 && l.tokens < l.need(w.n) {
+			// 等待时间不超过burstDuration，及时响应速率的修改
+			wait := min(time.Duration((l.need(w.n)-l.tokens)/l.rate*float64(time.Second)), burstDuration)
+			l.mu.Unlock()
+			time.Sleep(wait)
+			continue
+		}
+		if l.rate != 0 {
+			l.tokens -= w.n
+		}
+		w.granted = true
+		close(w.ready)
+		q.Remove(q.Front())
+		l.order = l.order[1:]
+		if q.Len() > 0 {
+			l.order = append(l.order, flow)
+		} else {
+			delete(l.flows, flow)
+		}
+		l.mu.Unlock()
+	}
+}
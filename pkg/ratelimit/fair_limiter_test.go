@@ -0,0 +1,103 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 同时等待的流平均分享带宽，与各流并发的请求数无关，总速率不超过限制
+func TestFairLimiterSharesRateBetweenFlows(t *testing.T) {
+	const (
+		rate     = 200 * 1024
+		n        = 1024
+		duration = 500 * time.Millisecond
+	)
+	l := NewFairLimiter(rate)
+	// 先用完初始的令牌，之后的请求都需要排队
+	if _, err := l.Wait(context.Background(), 0, int(l.burst)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	var greedy, single atomic.Int64
+	var wg sync.WaitGroup
+	run := func(flow int64, granted *atomic.Int64) {
+		defer wg.Done()
+		for {
+			if _, err := l.Wait(ctx, flow, n); err != nil {
+				return
+			}
+			granted.Add(n)
+		}
+	}
+	// 流1有4个并发请求，流2只有1个
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go run(1, &greedy)
+	}
+	wg.Add(1)
+	go run(2, &single)
+	wg.Wait()
+
+	a, b := greedy.Load(), single.Load()
+	if a == 0 || b == 0 || float64(max(a, b))/float64(min(a, b)) > 1.3 {
+		t.Fatalf("flow 1 got %d bytes, flow 2 got %d bytes, want about the same", a, b)
+	}
+	if limit := int64(rate*duration.Seconds()) + n; a+b > limit {
+		t.Fatalf("got %d bytes in %s, want at most %d", a+b, duration, limit)
+	}
+}
+
+// 没有其他流等待时，单个流可以使用全部带宽
+func TestFairLimiterIdleFlowsDoNotReserve(t *testing.T) {
+	const (
+		rate     = 200 * 1024
+		n        = 1024
+		duration = 300 * time.Millisecond
+	)
+	l := NewFairLimiter(rate)
+	if _, err := l.Wait(context.Background(), 0, int(l.burst)); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	var granted int64
+	for {
+		if _, err := l.Wait(ctx, 1, n); err != nil {
+			break
+		}
+		granted += n
+	}
+	if want := int64(rate * duration.Seconds() * 0.7); granted < want {
+		t.Fatalf("got %d bytes in %s, want at least %d", granted, duration, want)
+	}
+}
+
+func TestFairLimiterUnlimited(t *testing.T) {
+	l := NewFairLimiter(0)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 0; i < 1000; i++ {
+		if wait, err := l.Wait(ctx, 1, 1<<20); err != nil || wait != 0 {
+			t.Fatalf("Wait() = %s, %v", wait, err)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package upstream
+
+// 多个上游Hub之间的故障切换：按配置顺序选择可用的上游，请求失败时切换到下一个。
+// 每个上游独立熔断，连续失败达到阈值后在熔断时间内不再优先使用，到期后放行一个请求试探，
+// 后台健康检查使无请求时也能及时发现上游的故障和恢复。
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"dingospeed/pkg/common"
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/prom"
+	"dingospeed/pkg/util"
+
+	"go.uber.org/zap"
+)
+
+const (
+	StateClosed   = iota // 正常
+	StateOpen            // 熔断
+	StateHalfOpen        // 熔断到期，放行一个请求试探
+
+	healthCheckTimeout = 10 * time.Second
+)
+
+var (
+	ErrNoUpstream          = errors.New("no upstream configured")
+	ErrNoAvailableUpstream = errors.New("no available upstream")
+)
+
+type Upstream struct {
+	Url  string // scheme://host，不带末尾的/
+	Host string // 用于监控标签及日志
+
+	mu       sync.Mutex
+	state    int
+	failures int // 连续失败次数
+	openedAt time.Time
+}
+
+var (
+	upstreams []*Upstream
+	initOnce  sync.Once
+)
+
+// List 返回按优先级排列的所有上游
+func List() []*Upstream {
+	initOnce.Do(func() {
+		for _, rawUrl := range config.SysConfig.Upstream.Urls {
+			rawUrl = strings.TrimRight(rawUrl, "/")
+			host := rawUrl
+			if u, err := url.Parse(rawUrl); err == nil && u.Host != "" {
+				host = u.Host
+			}
+			upstreams = append(upstreams, &Upstream{Url: rawUrl, Host: host})
+		}
+	})
+	return upstreams
+}
+
+// IsFailure 判断上游的响应是否视为失败，5xx及429说明该上游当前无法服务，其他响应码由调用方处理
+func IsFailure(statusCode int) bool {
+	return statusCode >= http.StatusInternalServerError || statusCode == http.StatusTooManyRequests
+}
+
+// Do 依次向可用的上游发送请求，出错或响应失败时切换到下一个上游。所有上游都处于熔断状态时，
+// 仍按顺序尝试全部上游。都失败时返回最后一次的结果。
+func Do(f func(u *Upstream) (*common.Response, error)) (*common.Response, error) {
+	return DoFrom(0, f)
+}
+
+// DoFrom 与Do相同，但从第start个上游开始轮换优先级，用于将同一文件的分段请求分散到多个上游
+func DoFrom(start int, f func(u *Upstream) (*common.Response, error)) (*common.Response, error) {
+	all := List()
+	if len(all) == 0 {
+		return nil, ErrNoUpstream
+	}
+	start %= len(all)
+	ordered := make([]*Upstream, 0, len(all))
+	ordered = append(append(ordered, all[start:]...), all[:start]...)
+	// 选择候选上游时不改变熔断状态，实际发送请求时才放行试探请求
+	candidates := make([]*Upstream, 0, len(all))
+	for _, u := range ordered {
+		if u.allow() {
+			candidates = append(candidates, u)
+		}
+	}
+	fallback := len(candidates) == 0
+	if fallback {
+		candidates = ordered
+	}
+	var (
+		resp *common.Response
+		err  = ErrNoAvailableUpstream
+	)
+	for i, u := range candidates {
+		probe := false
+		if !fallback {
+			var ok bool
+			// 其他请求已占用试探机会时跳过该上游
+			if ok, probe = u.acquire(); !ok {
+				continue
+			}
+		}
+		resp, err = f(u)
+		if errors.Is(err, context.Canceled) {
+			// 调用方取消的请求不计入上游的失败，也不再切换，试探请求被取消时交还试探机会
+			u.Release(probe)
+			return resp, err
+		}
+		if u.Report(resp, err) {
+			return resp, nil
+		}
+		if i < len(candidates)-1 {
+			if err != nil {
+				zap.S().Warnf("upstream %s err.%v, failover to %s", u.Host, err, candidates[i+1].Host)
+			} else {
+				zap.S().Warnf("upstream %s statusCode:%d, failover to %s", u.Host, resp.StatusCode, candidates[i+1].Host)
+			}
+		}
+	}
+	return resp, err
+}
+
+// Pick 返回除exclude外优先级最高的可用上游，没有时返回nil。probe表示该请求是否为熔断到期后的试探请求，
+// 调用方需在请求结束后调用Report，请求被取消时调用Release
+func Pick(exclude *Upstream) (u *Upstream, probe bool) {
+	for _, u = range List() {
+		if u == exclude {
+			continue
+		}
+		if ok, probe := u.acquire(); ok {
+			return u, probe
+		}
+	}
+	return nil, false
+}
+
+// Release 试探请求未调用Report就结束时（如被调用方取消），将上游恢复为熔断状态，
+// 熔断时间已到期，之后的请求可以重新试探。probe为false时不做处理
+func (u *Upstream) Release(probe bool) {
+	if !probe {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.state == StateHalfOpen {
+		u.setState(StateOpen)
+	}
+}
+
+// Report 记录请求的结果并返回是否成功，不经过Do发出的请求需自行调用
+func (u *Upstream) Report(resp *common.Response, err error) bool {
+	if err == nil && !IsFailure(resp.StatusCode) {
+		u.succeed()
+		countRequest(u, "success")
+		return true
+	}
+	u.fail()
+	countRequest(u, "failure")
+	return false
+}
+
+// RetryDo 每次重试都按优先级重新选择上游
+func RetryDo(f func(u *Upstream) (*common.Response, error)) (*common.Response, error) {
+	return util.RetryRequest(func() (*common.Response, error) {
+		return Do(f)
+	})
+}
+
+// allow 判断是否可以向该上游发送请求，只用于选择候选上游，不改变熔断状态
+func (u *Upstream) allow() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	switch u.state {
+	case StateClosed:
+		return true
+	case StateOpen:
+		return time.Since(u.openedAt) >= config.SysConfig.GetBreakerOpenTime()
+	default:
+		return false
+	}
+}
+
+// acquire 向该上游发送请求前调用，熔断到期后只放行一个试探请求并进入HalfOpen，
+// 返回是否可以发送及该请求是否为试探请求
+func (u *Upstream) acquire() (ok, probe bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	switch u.state {
+	case StateClosed:
+		return true, false
+	case StateOpen:
+		if time.Since(u.openedAt) < config.SysConfig.GetBreakerOpenTime() {
+			return false, false
+		}
+		u.setState(StateHalfOpen)
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+func (u *Upstream) succeed() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.failures = 0
+	if u.state != StateClosed {
+		zap.S().Infof("upstream %s recovered", u.Host)
+		u.setState(StateClosed)
+	}
+}
+
+func (u *Upstream) fail() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.failures++
+	if u.state == StateClosed && u.failures < config.SysConfig.Upstream.FailureThreshold {
+		return
+	}
+	// 试探失败或熔断期间仍然失败，重新计算熔断时间
+	if u.state != StateOpen {
+		zap.S().Warnf("upstream %s is unavailable, failures:%d", u.Host, u.failures)
+	}
+	u.openedAt = time.Now()
+	u.setState(StateOpen)
+}
+
+// setState 调用方需持有u.mu
+func (u *Upstream) setState(state int) {
+	u.state = state
+	if config.SysConfig.EnableMetric() {
+		prom.UpstreamState.WithLabelValues(u.Host).Set(float64(state))
+	}
+}
+
+func countRequest(u *Upstream, result string) {
+	if config.SysConfig.EnableMetric() {
+		prom.UpstreamRequestCnt.WithLabelValues(u.Host, result).Inc()
+	}
+}
+
+// HealthCheck 定期检查所有上游，响应码小于500即认为可用
+func HealthCheck() {
+	ticker := time.NewTicker(config.SysConfig.GetHealthCheckPeriod())
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, u := range List() {
+			u.check()
+		}
+	}
+}
+
+func (u *Upstream) check() {
+	resp, err := util.Head(u.Url+config.SysConfig.Upstream.HealthCheckPath, nil, healthCheckTimeout)
+	if err != nil {
+		zap.S().Warnf("upstream %s health check err.%v", u.Host, err)
+		u.fail()
+		return
+	}
+	if IsFailure(resp.StatusCode) {
+		zap.S().Warnf("upstream %s health check statusCode:%d", u.Host, resp.StatusCode)
+		u.fail()
+		return
+	}
+	u.succeed()
+}
@@ -0,0 +1,165 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package upstream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dingospeed/pkg/common"
+	"dingospeed/pkg/config"
+	"dingospeed/pkg/util"
+)
+
+// testServer 记录请求次数，failing为true时返回500
+type testServer struct {
+	*httptest.Server
+	requests atomic.Int64
+	failing  atomic.Bool
+}
+
+func newTestServer() *testServer {
+	s := &testServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if s.failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(r.Host))
+	}))
+	return s
+}
+
+var primary, secondary *testServer
+
+func TestMain(m *testing.M) {
+	primary, secondary = newTestServer(), newTestServer()
+	config.SysConfig = &config.Config{}
+	config.SysConfig.Upstream.Urls = []string{primary.URL, secondary.URL}
+	config.SysConfig.Upstream.FailureThreshold = 2
+	config.SysConfig.Upstream.BreakerOpenTime = 30
+	code := m.Run()
+	primary.Close()
+	secondary.Close()
+	os.Exit(code)
+}
+
+func get(u *Upstream) (*common.Response, error) {
+	return util.Get(u.Url+"/api/models/org/repo", nil, time.Second)
+}
+
+// 一个上游持续失败时请求切换到下一个上游，连续失败达到阈值后熔断，熔断到期后试探成功即恢复
+func TestBreakerOpensOnFailingUpstream(t *testing.T) {
+	all := List()
+	primary.failing.Store(true)
+	for i := 0; i < config.SysConfig.Upstream.FailureThreshold; i++ {
+		resp, err := Do(get)
+		if err != nil || resp.StatusCode != http.StatusOK || string(resp.Body) != all[1].Host {
+			t.Fatalf("request %d is not failed over: %v, %+v", i, err, resp)
+		}
+	}
+	if all[0].state != StateOpen {
+		t.Fatalf("primary state = %d, want open", all[0].state)
+	}
+	primaryRequests := primary.requests.Load()
+	for i := 0; i < 3; i++ {
+		if resp, err := Do(get); err != nil || string(resp.Body) != all[1].Host {
+			t.Fatalf("request is not served by secondary: %v, %+v", err, resp)
+		}
+	}
+	if got := primary.requests.Load(); got != primaryRequests {
+		t.Fatalf("open breaker still sends %d requests to primary", got-primaryRequests)
+	}
+	if u, _ := Pick(nil); u != all[1] {
+		t.Fatal("Pick should skip the open upstream")
+	}
+
+	// 熔断到期后放行一个请求试探，成功后恢复为正常状态
+	primary.failing.Store(false)
+	all[0].mu.Lock()
+	all[0].openedAt = time.Now().Add(-config.SysConfig.GetBreakerOpenTime())
+	all[0].mu.Unlock()
+	if resp, err := Do(get); err != nil || string(resp.Body) != all[0].Host {
+		t.Fatalf("half-open probe is not sent to primary: %v, %+v", err, resp)
+	}
+	if all[0].state != StateClosed || all[0].failures != 0 {
+		t.Fatalf("primary state = %d, failures = %d after recovery", all[0].state, all[0].failures)
+	}
+}
+
+// 只有实际发送请求的上游进入HalfOpen，试探请求被取消或未记录结果时交还试探机会
+func TestProbeReleased(t *testing.T) {
+	all := List()
+	expire := func() {
+		all[0].mu.Lock()
+		all[0].openedAt = time.Now().Add(-config.SysConfig.GetBreakerOpenTime())
+		all[0].setState(StateOpen)
+		all[0].mu.Unlock()
+	}
+	defer func() {
+		all[0].mu.Lock()
+		all[0].failures = 0
+		all[0].setState(StateClosed)
+		all[0].mu.Unlock()
+	}()
+
+	// 从secondary开始且secondary成功时，primary只是候选，不应占用试探机会
+	expire()
+	if resp, err := DoFrom(1, get); err != nil || string(resp.Body) != all[1].Host {
+		t.Fatalf("request is not served by secondary: %v, %+v", err, resp)
+	}
+	if all[0].state != StateOpen {
+		t.Fatalf("primary state = %d after being a candidate, want open", all[0].state)
+	}
+
+	// 试探请求被调用方取消
+	_, err := Do(func(u *Upstream) (*common.Response, error) {
+		return nil, context.Canceled
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if all[0].state != StateOpen {
+		t.Fatalf("primary state = %d after cancelled probe, want open", all[0].state)
+	}
+
+	// 对冲请求选中试探机会后被取消
+	u, probe := Pick(all[1])
+	if u != all[0] || !probe || all[0].state != StateHalfOpen {
+		t.Fatalf("Pick = %v, probe = %v, state = %d", u, probe, all[0].state)
+	}
+	if again, _ := Pick(all[1]); again != nil {
+		t.Fatal("Pick should not hand out a second probe")
+	}
+	u.Release(probe)
+	if all[0].state != StateOpen {
+		t.Fatalf("primary state = %d after released probe, want open", all[0].state)
+	}
+
+	// 交还后仍可试探并恢复
+	if resp, err := Do(get); err != nil || string(resp.Body) != all[0].Host {
+		t.Fatalf("probe is not sent to primary after release: %v, %+v", err, resp)
+	}
+	if all[0].state != StateClosed {
+		t.Fatalf("primary state = %d after recovery", all[0].state)
+	}
+}
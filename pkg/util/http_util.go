@@ -16,15 +16,22 @@ package util
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"os"
+	"path"
+	"strings"
 	"time"
 
 	"dingospeed/pkg/common"
 	"dingospeed/pkg/config"
 	"dingospeed/pkg/consts"
 	"dingospeed/pkg/prom"
+	"dingospeed/pkg/ratelimit"
 
 	"github.com/avast/retry-go"
 	"github.com/labstack/echo/v4"
@@ -48,6 +55,15 @@ func RetryRequest(f func() (*common.Response, error)) (*common.Response, error)
 
 // Head 方法用于发送带请求头的 HEAD 请求
 func Head(url string, headers map[string]string, timeout time.Duration) (*common.Response, error) {
+	return head(url, headers, timeout, true)
+}
+
+// HeadNoRedirect 发送 HEAD 请求但不跟随重定向，用于获取上游返回的Location
+func HeadNoRedirect(url string, headers map[string]string, timeout time.Duration) (*common.Response, error) {
+	return head(url, headers, timeout, false)
+}
+
+func head(url string, headers map[string]string, timeout time.Duration, followRedirect bool) (*common.Response, error) {
 	req, err := http.NewRequest("HEAD", url, nil)
 	if err != nil {
 		return nil, err
@@ -57,6 +73,11 @@ func Head(url string, headers map[string]string, timeout time.Duration) (*common
 	}
 	client := &http.Client{}
 	client.Timeout = timeout
+	if !followRedirect {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
@@ -71,6 +92,14 @@ func Head(url string, headers map[string]string, timeout time.Duration) (*common
 	}, nil
 }
 
+// ExternalUrl 返回本服务上path对应的绝对地址，优先使用配置的externalUrl
+func ExternalUrl(c echo.Context, path string) string {
+	if base := config.SysConfig.GetExternalUrl(); base != "" {
+		return base + path
+	}
+	return fmt.Sprintf("%s://%s%s", c.Scheme(), c.Request().Host, path)
+}
+
 // Get 方法用于发送带请求头的 GET 请求
 func Get(url string, headers map[string]string, timeout time.Duration) (*common.Response, error) {
 	req, err := http.NewRequest("GET", url, nil)
@@ -102,10 +131,11 @@ func Get(url string, headers map[string]string, timeout time.Duration) (*common.
 	}, nil
 }
 
-func GetStream(url string, headers map[string]string, timeout time.Duration, f func(r *http.Response)) error {
+// GetStream 发送GET请求并由f读取响应体，ctx取消时正在进行的读取会立即返回
+func GetStream(ctx context.Context, url string, headers map[string]string, timeout time.Duration, f func(r *http.Response)) error {
 	client := &http.Client{}
 	client.Timeout = timeout
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return err
 	}
@@ -157,17 +187,23 @@ func Post(url string, contentType string, data []byte, headers map[string]string
 }
 
 func ResponseStream(c echo.Context, fileName string, headers map[string]string, content <-chan []byte) error {
-	c.Response().Header().Set("Content-Type", "text/event-stream")
+	return ResponseStreamWithCode(c, http.StatusOK, fileName, headers, content)
+}
+
+// ResponseStreamWithCode 以指定的状态码流式返回数据，如分段下载时返回206
+func ResponseStreamWithCode(c echo.Context, statusCode int, fileName string, headers map[string]string, content <-chan []byte) error {
+	c.Response().Header().Set("Content-Type", "application/octet-stream")
 	c.Response().Header().Set("Cache-Control", "no-cache")
 	c.Response().Header().Set("Connection", "keep-alive")
 	for k, v := range headers {
 		c.Response().Header().Set(k, v)
 	}
-	c.Response().WriteHeader(http.StatusOK)
+	c.Response().WriteHeader(statusCode)
 	flusher, ok := c.Response().Writer.(http.Flusher)
 	if !ok {
 		return c.String(http.StatusInternalServerError, "Streaming unsupported!")
 	}
+	session, _ := c.Get(consts.ClientSession).(*ratelimit.Session)
 	for {
 		select {
 		case b, ok := <-content:
@@ -187,10 +223,103 @@ func ResponseStream(c echo.Context, fileName string, headers map[string]string,
 				}
 			}
 			flusher.Flush()
+			if session != nil {
+				if err := session.Wait(c.Request().Context(), int64(len(b))); err != nil {
+					zap.S().Warnf("ResponseStream wait client limit err,file:%s,%v", fileName, err)
+					return nil
+				}
+			}
 		}
 	}
 }
 
+// ResponseFile 通过http.ServeContent返回本地文件，由其处理Range、If-Range、If-None-Match等条件请求
+func ResponseFile(c echo.Context, fileName string, headers map[string]string, content *os.File) error {
+	for k, v := range headers {
+		c.Response().Header().Set(k, v)
+	}
+	w := &fileResponseWriter{Response: c.Response(), source: Itoa(c.Get(consts.PromSource)), ctx: c.Request().Context()}
+	w.session, _ = c.Get(consts.ClientSession).(*ratelimit.Session)
+	http.ServeContent(w, c.Request(), fileName, time.Time{}, content)
+	zap.S().Infof("ResponseFile complete, %s, status:%d, size:%d.", fileName, c.Response().Status, c.Response().Size)
+	return nil
+}
+
+// fileResponseWriter 保留echo.Response的状态记录，同时将io.ReaderFrom交给底层的http.ResponseWriter，
+// 使文件内容可以通过sendfile由内核零拷贝发送
+type fileResponseWriter struct {
+	*echo.Response
+	source  string
+	ctx     context.Context
+	session *ratelimit.Session // 按客户端限流时，需要按字节速率等待，不能使用sendfile
+}
+
+func (w *fileResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.Response.Write(b)
+	w.addResponseByte(int64(n))
+	if w.session != nil && err == nil {
+		err = w.session.Wait(w.ctx, int64(n))
+	}
+	return n, err
+}
+
+func (w *fileResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !w.Committed {
+		w.WriteHeader(http.StatusOK)
+	}
+	var (
+		n   int64
+		err error
+	)
+	if w.session != nil && w.session.Throttled() {
+		r = w.session.Reader(w.ctx, r)
+	}
+	if rf, ok := w.Writer.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+		w.Size += n
+	} else {
+		n, err = io.Copy(w.Response, r)
+	}
+	w.addResponseByte(n)
+	if w.session != nil && !w.session.Throttled() {
+		_ = w.session.Wait(w.ctx, n) // 只计入每日下载量
+	}
+	return n, err
+}
+
+func (w *fileResponseWriter) addResponseByte(n int64) {
+	if n > 0 && config.SysConfig.EnableMetric() {
+		prom.PromRequestByteCounter(prom.RequestResponseByte, w.source, n)
+	}
+}
+
+// GetContentType 根据文件名推断Content-Type，无法推断时按二进制流处理
+func GetContentType(fileName string) string {
+	ext := strings.ToLower(path.Ext(fileName))
+	if contentType, ok := contentTypes[ext]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// 模型仓库中常见、但系统mime表中可能缺失的文件类型
+var contentTypes = map[string]string{
+	".json":        "application/json",
+	".jsonl":       "application/jsonl",
+	".txt":         "text/plain; charset=utf-8",
+	".md":          "text/markdown; charset=utf-8",
+	".py":          "text/x-python; charset=utf-8",
+	".yaml":        "application/yaml",
+	".yml":         "application/yaml",
+	".csv":         "text/csv; charset=utf-8",
+	".parquet":     "application/octet-stream",
+	".safetensors": "application/octet-stream",
+	".bin":         "application/octet-stream",
+}
+
 func GetDomain(hfURL string) (string, error) {
 	parsedURL, err := url.Parse(hfURL)
 	if err != nil {
@@ -0,0 +1,96 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CompilePattern 将fnmatch风格的模式转换为正则表达式，与huggingface_hub的allow_patterns一致：
+// *和?可以匹配/，以/结尾的模式匹配该目录下的所有文件
+func CompilePattern(pattern string) (*regexp.Regexp, error) {
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "*"
+	}
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// FilterPaths 保留匹配任一allow模式（未配置时保留全部）且不匹配任何ignore模式的路径
+func FilterPaths(paths, allow, ignore []string) ([]string, error) {
+	compile := func(patterns []string) ([]*regexp.Regexp, error) {
+		res := make([]*regexp.Regexp, 0, len(patterns))
+		for _, p := range patterns {
+			re, err := CompilePattern(p)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, re)
+		}
+		return res, nil
+	}
+	matchAny := func(res []*regexp.Regexp, p string) bool {
+		for _, re := range res {
+			if re.MatchString(p) {
+				return true
+			}
+		}
+		return false
+	}
+	allowRes, err := compile(allow)
+	if err != nil {
+		return nil, err
+	}
+	ignoreRes, err := compile(ignore)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if len(allowRes) > 0 && !matchAny(allowRes, p) {
+			continue
+		}
+		if matchAny(ignoreRes, p) {
+			continue
+		}
+		ret = append(ret, p)
+	}
+	return ret, nil
+}
@@ -0,0 +1,48 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterPaths(t *testing.T) {
+	paths := []string{"config.json", "model.safetensors", "onnx/model.onnx", "data/train/0.parquet", "README.md"}
+	cases := []struct {
+		allow  []string
+		ignore []string
+		want   []string
+	}{
+		{nil, nil, paths},
+		{[]string{"*.json", "*.safetensors"}, nil, []string{"config.json", "model.safetensors"}},
+		{[]string{"*.onnx"}, nil, []string{"onnx/model.onnx"}},
+		{[]string{"data/"}, nil, []string{"data/train/0.parquet"}},
+		{nil, []string{"onnx/*", "*.md"}, []string{"config.json", "model.safetensors", "data/train/0.parquet"}},
+		{[]string{"[cm]*"}, []string{"model.*"}, []string{"config.json"}},
+		{[]string{"[!cmo]*"}, nil, []string{"data/train/0.parquet", "README.md"}},
+		{[]string{"config.?son"}, nil, []string{"config.json"}},
+	}
+	for _, c := range cases {
+		got, err := FilterPaths(paths, c.allow, c.ignore)
+		if err != nil {
+			t.Errorf("FilterPaths(%v, %v) err %v", c.allow, c.ignore, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("FilterPaths(%v, %v) = %v, want %v", c.allow, c.ignore, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrRangeInvalid Range头语法错误，按照RFC 7233需忽略该头，返回完整内容
+	ErrRangeInvalid = errors.New("invalid range")
+	// ErrRangeNotSatisfiable 所有区间均超出文件范围，需返回416
+	ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// ByteRange 表示文件的一个字节区间，Start包含，End不包含。
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+func (r ByteRange) Length() int64 {
+	return r.End - r.Start
+}
+
+// ContentRange 返回Content-Range头的值，如bytes 0-99/1000
+func (r ByteRange) ContentRange(fileSize int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.End-1, fileSize)
+}
+
+// ParseRange 解析Range头（RFC 7233），支持bytes=a-b、bytes=a-、bytes=-n及多个区间。
+// 无法满足的区间会被丢弃，若全部无法满足则返回ErrRangeNotSatisfiable。
+func ParseRange(rangeHeader string, fileSize int64) ([]ByteRange, error) {
+	const prefix = "bytes="
+	rangeHeader = strings.TrimSpace(rangeHeader)
+	if !strings.HasPrefix(rangeHeader, prefix) {
+		return nil, ErrRangeInvalid
+	}
+	ranges := make([]ByteRange, 0)
+	specNum := 0
+	for _, spec := range strings.Split(rangeHeader[len(prefix):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		specNum++
+		startStr, endStr, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, ErrRangeInvalid
+		}
+		startStr, endStr = strings.TrimSpace(startStr), strings.TrimSpace(endStr)
+		var r ByteRange
+		if startStr == "" {
+			// 后缀区间，bytes=-n表示最后n个字节
+			suffix, err := strconv.ParseInt(endStr, 10, 64)
+			if err != nil || suffix < 0 {
+				return nil, ErrRangeInvalid
+			}
+			if suffix == 0 || fileSize == 0 {
+				continue
+			}
+			r = ByteRange{Start: max(fileSize-suffix, 0), End: fileSize}
+		} else {
+			start, err := strconv.ParseInt(startStr, 10, 64)
+			if err != nil || start < 0 {
+				return nil, ErrRangeInvalid
+			}
+			end := fileSize
+			if endStr != "" {
+				last, err := strconv.ParseInt(endStr, 10, 64)
+				if err != nil || last < start {
+					return nil, ErrRangeInvalid
+				}
+				end = min(last+1, fileSize)
+			}
+			if start >= fileSize {
+				continue
+			}
+			r = ByteRange{Start: start, End: end}
+		}
+		ranges = append(ranges, r)
+	}
+	if specNum == 0 {
+		return nil, ErrRangeInvalid
+	}
+	if len(ranges) == 0 {
+		return nil, ErrRangeNotSatisfiable
+	}
+	return ranges, nil
+}
+
+// IfRangeMatch 判断If-Range头是否与当前etag匹配。If-Range只允许强比较，
+// 弱etag及日期格式（本服务不提供Last-Modified）均视为不匹配。
+func IfRangeMatch(ifRange, etag string) bool {
+	ifRange = strings.TrimSpace(ifRange)
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, "W/") {
+		return false
+	}
+	return strings.Trim(ifRange, `"`) == strings.Trim(etag, `"`)
+}
+
+// MultipartRanges 多区间请求的multipart/byteranges响应体的分隔信息
+type MultipartRanges struct {
+	Boundary    string
+	ContentType string
+	FileSize    int64
+	Ranges      []ByteRange
+}
+
+func NewMultipartRanges(ranges []ByteRange, contentType string, fileSize int64) *MultipartRanges {
+	return &MultipartRanges{
+		Boundary:    strings.ReplaceAll(UUID(), "-", ""),
+		ContentType: contentType,
+		FileSize:    fileSize,
+		Ranges:      ranges,
+	}
+}
+
+// MediaType 返回响应的Content-Type
+func (m *MultipartRanges) MediaType() string {
+	return fmt.Sprintf("multipart/byteranges; boundary=%s", m.Boundary)
+}
+
+// PartHeader 返回第i个区间数据前的分隔符及头信息
+func (m *MultipartRanges) PartHeader(i int) []byte {
+	var sb strings.Builder
+	if i > 0 {
+		sb.WriteString("\r\n")
+	}
+	sb.WriteString(fmt.Sprintf("--%s\r\n", m.Boundary))
+	if m.ContentType != "" {
+		sb.WriteString(fmt.Sprintf("Content-Type: %s\r\n", m.ContentType))
+	}
+	sb.WriteString(fmt.Sprintf("Content-Range: %s\r\n\r\n", m.Ranges[i].ContentRange(m.FileSize)))
+	return []byte(sb.String())
+}
+
+// Tail 返回响应体的结束分隔符
+func (m *MultipartRanges) Tail() []byte {
+	return []byte(fmt.Sprintf("\r\n--%s--\r\n", m.Boundary))
+}
+
+// ContentLength 计算整个multipart响应体的长度
+func (m *MultipartRanges) ContentLength() int64 {
+	var length int64
+	for i, r := range m.Ranges {
+		length += int64(len(m.PartHeader(i))) + r.Length()
+	}
+	return length + int64(len(m.Tail()))
+}
@@ -0,0 +1,110 @@
+//  Copyright (c) 2025 dingodb.com, Inc. All Rights Reserved
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http:www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package util
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"reflect"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		header string
+		size   int64
+		want   []ByteRange
+		err    error
+	}{
+		{"bytes=0-99", 1000, []ByteRange{{0, 100}}, nil},
+		{"bytes=100-", 1000, []ByteRange{{100, 1000}}, nil},
+		{"bytes=-100", 1000, []ByteRange{{900, 1000}}, nil},
+		{"bytes=-2000", 1000, []ByteRange{{0, 1000}}, nil},
+		{"bytes=900-2000", 1000, []ByteRange{{900, 1000}}, nil},
+		{"bytes=0-7, 100-200", 1000, []ByteRange{{0, 8}, {100, 201}}, nil},
+		{"bytes=1000-", 1000, nil, ErrRangeNotSatisfiable},
+		{"bytes=-0", 1000, nil, ErrRangeNotSatisfiable},
+		{"bytes=0-0", 0, nil, ErrRangeNotSatisfiable},
+		{"bytes=5-1", 1000, nil, ErrRangeInvalid},
+		{"bytes=a-b", 1000, nil, ErrRangeInvalid},
+		{"items=0-1", 1000, nil, ErrRangeInvalid},
+		{"bytes=", 1000, nil, ErrRangeInvalid},
+	}
+	for _, c := range cases {
+		got, err := ParseRange(c.header, c.size)
+		if !errors.Is(err, c.err) {
+			t.Errorf("ParseRange(%q, %d) err = %v, want %v", c.header, c.size, err, c.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseRange(%q, %d) = %v, want %v", c.header, c.size, got, c.want)
+		}
+	}
+}
+
+func TestIfRangeMatch(t *testing.T) {
+	if !IfRangeMatch("", "abc") || !IfRangeMatch(`"abc"`, "abc") || !IfRangeMatch("abc", `"abc"`) {
+		t.Error("expected If-Range to match")
+	}
+	if IfRangeMatch(`W/"abc"`, "abc") || IfRangeMatch("Wed, 21 Oct 2015 07:28:00 GMT", "abc") {
+		t.Error("expected If-Range not to match")
+	}
+}
+
+// multipart响应体可以按boundary解析出每个区间的头信息和数据，ContentLength与响应体的长度一致
+func TestMultipartRanges(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	ranges := []ByteRange{{0, 5}, {10, 11}, {30, 36}}
+	for _, contentType := range []string{"application/octet-stream", ""} {
+		m := NewMultipartRanges(ranges, contentType, int64(len(content)))
+		var body bytes.Buffer
+		for i, r := range ranges {
+			body.Write(m.PartHeader(i))
+			body.Write(content[r.Start:r.End])
+		}
+		body.Write(m.Tail())
+		if got := m.ContentLength(); got != int64(body.Len()) {
+			t.Fatalf("ContentLength() = %d, body length %d", got, body.Len())
+		}
+
+		mediaType, params, err := mime.ParseMediaType(m.MediaType())
+		if err != nil || mediaType != "multipart/byteranges" || params["boundary"] != m.Boundary {
+			t.Fatalf("MediaType() = %q, err %v", m.MediaType(), err)
+		}
+		reader := multipart.NewReader(&body, params["boundary"])
+		for i, r := range ranges {
+			part, err := reader.NextPart()
+			if err != nil {
+				t.Fatalf("part %d err.%v", i, err)
+			}
+			if got := part.Header.Get("Content-Range"); got != r.ContentRange(int64(len(content))) {
+				t.Errorf("part %d Content-Range = %q", i, got)
+			}
+			if got := part.Header.Get("Content-Type"); got != contentType {
+				t.Errorf("part %d Content-Type = %q, want %q", i, got, contentType)
+			}
+			data, err := io.ReadAll(part)
+			if err != nil || !bytes.Equal(data, content[r.Start:r.End]) {
+				t.Errorf("part %d data = %q, err %v", i, data, err)
+			}
+		}
+		if _, err = reader.NextPart(); err != io.EOF {
+			t.Fatalf("after the last part err = %v, want EOF", err)
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"syscall"
 	"time"
 
@@ -36,6 +37,19 @@ func GetOrgRepo(org, repo string) string {
 	}
 }
 
+// ValidRepoPath 仓库内的相对路径，用于拼接缓存路径，不能为空或包含.、..
+func ValidRepoPath(p string) bool {
+	if p == "" {
+		return false
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	return true
+}
+
 // MakeDirs 确保指定路径对应的目录存在
 func MakeDirs(path string) error {
 	fileInfo, err := os.Stat(path)
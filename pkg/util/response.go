@@ -16,7 +16,10 @@ package util
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
@@ -122,9 +125,50 @@ func ErrorTooManyRequest(ctx echo.Context) error {
 	return Response(ctx, http.StatusTooManyRequests, nil, content)
 }
 
+// ErrorTooManyRequestRetryAfter 返回429，并通过Retry-After告知客户端需要等待的秒数
+func ErrorTooManyRequestRetryAfter(ctx echo.Context, retryAfter time.Duration) error {
+	content := map[string]string{
+		"error": "Too many requests",
+	}
+	headers := map[string]string{
+		"Retry-After": strconv.FormatInt(int64(math.Ceil(max(retryAfter.Seconds(), 1))), 10),
+	}
+	return Response(ctx, http.StatusTooManyRequests, headers, content)
+}
+
+func ErrorUnauthorized(ctx echo.Context) error {
+	content := map[string]string{
+		"error": "Invalid admin token",
+	}
+	return Response(ctx, http.StatusUnauthorized, nil, content)
+}
+
+func ErrorForbidden(ctx echo.Context) error {
+	content := map[string]string{
+		"error": "Admin API is only allowed from localhost",
+	}
+	return Response(ctx, http.StatusForbidden, nil, content)
+}
+
+func ErrorRangeNotSatisfiable(ctx echo.Context, fileSize int64) error {
+	content := map[string]string{
+		"error": "Requested range not satisfiable",
+	}
+	headers := map[string]string{
+		"accept-ranges": "bytes",
+		"content-range": fmt.Sprintf("bytes */%d", fileSize),
+	}
+	return Response(ctx, http.StatusRequestedRangeNotSatisfiable, headers, content)
+}
+
 func ResponseHeaders(ctx echo.Context, headers map[string]string) error {
+	return ResponseHeadersWithCode(ctx, http.StatusOK, headers)
+}
+
+// ResponseHeadersWithCode 用于HEAD请求，只返回响应头，不返回响应体
+func ResponseHeadersWithCode(ctx echo.Context, statusCode int, headers map[string]string) error {
 	fullHeaders(ctx, headers)
-	return ctx.JSON(http.StatusOK, nil)
+	return ctx.NoContent(statusCode)
 }
 
 func Response(ctx echo.Context, httpStatus int, headers map[string]string, data interface{}) error {